@@ -9,9 +9,13 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/ApexCorse/ephoros/schema"
+	"github.com/grafana/grafana-foundation-sdk/go/dashboard"
 )
 
 const (
@@ -22,10 +26,17 @@ const (
 	alertFolder              = "Ephoros Telemetry"
 	alertGroupName           = "Ephoros signal alerts"
 	alertDefaultLookbackSecs = 300
+	// alertStateTolerance absorbs float rounding of scaled state values.
+	alertStateTolerance = "0.000001"
+
+	panelOKColor       = "green"
+	panelWarningColor  = "orange"
+	panelCriticalColor = "red"
 )
 
 // AlertSignal is the dashboard-independent input used to provision alerts for
 // one telemetry topic. Nil threshold and staleness fields are not provisioned.
+// WarningStates and CriticalStates alert when the value equals one of them.
 // DashboardUID and PanelID are optional, but must be provided together.
 type AlertSignal struct {
 	Topic string
@@ -35,6 +46,9 @@ type AlertSignal struct {
 	CriticalLow  *float64
 	CriticalHigh *float64
 
+	WarningStates  []float64
+	CriticalStates []float64
+
 	StaleAfterSeconds *int
 	DashboardUID      string
 	PanelID           int
@@ -209,6 +223,15 @@ func validateAlertSignal(signal AlertSignal) error {
 		return fmt.Errorf("stale-after seconds must be positive for topic %q", signal.Topic)
 	}
 
+	if err := checkThresholds(signal); err != nil {
+		return fmt.Errorf("%w for topic %q", err, signal.Topic)
+	}
+	return nil
+}
+
+// checkThresholds requires finite thresholds and states, with thresholds in
+// ascending severity order and no state in both severities.
+func checkThresholds(signal AlertSignal) error {
 	orderedThresholds := []struct {
 		name  string
 		value *float64
@@ -227,21 +250,27 @@ func validateAlertSignal(signal AlertSignal) error {
 			continue
 		}
 		if math.IsNaN(*threshold.value) || math.IsInf(*threshold.value, 0) {
-			return fmt.Errorf("%s threshold must be finite for topic %q", threshold.name, signal.Topic)
+			return fmt.Errorf("%s threshold must be finite", threshold.name)
 		}
 		if previous != nil && previous.value > *threshold.value {
-			return fmt.Errorf(
-				"%s threshold must not exceed %s threshold for topic %q",
-				previous.name,
-				threshold.name,
-				signal.Topic,
-			)
+			return fmt.Errorf("%s threshold must not exceed %s threshold", previous.name, threshold.name)
 		}
 		previous = &struct {
 			name  string
 			value float64
 		}{threshold.name, *threshold.value}
 	}
+
+	for _, state := range append(append([]float64(nil), signal.WarningStates...), signal.CriticalStates...) {
+		if math.IsNaN(state) || math.IsInf(state, 0) {
+			return errors.New("alert states must be finite")
+		}
+	}
+	for _, warning := range signal.WarningStates {
+		if slices.Contains(signal.CriticalStates, warning) {
+			return fmt.Errorf("state %s cannot be both warning and critical", formatThreshold(warning))
+		}
+	}
 	return nil
 }
 
@@ -259,9 +288,19 @@ func newThresholdAlertRule(
 		"summary":     fmt.Sprintf("%s telemetry is outside its %s operating band", signal.Topic, severity),
 		"description": fmt.Sprintf("The latest stored value for %s breached its configured %s threshold.", signal.Topic, severity),
 	}
+	if !hasNumericThresholds(signal) {
+		rule.Annotations = map[string]string{
+			"summary":     fmt.Sprintf("%s telemetry is in a %s state", signal.Topic, severity),
+			"description": fmt.Sprintf("The latest stored value for %s equals one of its configured %s states.", signal.Topic, severity),
+		}
+	}
 	return rule
 }
 
+func hasNumericThresholds(signal AlertSignal) bool {
+	return signal.WarningLow != nil || signal.WarningHigh != nil || signal.CriticalLow != nil || signal.CriticalHigh != nil
+}
+
 func newStaleAlertRule(signal AlertSignal) alertRule {
 	rule := newAlertRule(signal, "stale", "warning")
 	rule.NoDataState = "Alerting"
@@ -347,10 +386,8 @@ func alertRuleData(topic string, condition string, lookbackSeconds int) []alertQ
 func alertInfluxQuery(topic string) string {
 	return fmt.Sprintf(`from(bucket: %q)
   |> range(start: v.timeRangeStart, stop: v.timeRangeStop)
-  |> filter(fn: (r) => r["_measurement"] == "can_signal")
-  |> filter(fn: (r) => r["_field"] == "value")
-  |> filter(fn: (r) => r["topic"] == %q)
-  |> last()`, influxDBBucket(), topic)
+  %s
+  |> last()`, influxDBBucket(), schema.FluxTopicFilter(topic))
 }
 
 func buildCriticalExpression(signal AlertSignal) string {
@@ -361,6 +398,7 @@ func buildCriticalExpression(signal AlertSignal) string {
 	if signal.CriticalHigh != nil {
 		conditions = append(conditions, "$B >= "+formatThreshold(*signal.CriticalHigh))
 	}
+	conditions = append(conditions, stateConditions(signal.CriticalStates)...)
 	return joinAlertConditions(conditions, " || ")
 }
 
@@ -380,9 +418,68 @@ func buildWarningExpression(signal AlertSignal) string {
 		}
 		conditions = append(conditions, high)
 	}
+	conditions = append(conditions, stateConditions(signal.WarningStates)...)
 	return joinAlertConditions(conditions, " || ")
 }
 
+// stateConditions match the value against each state. Math expressions have
+// no exact float equality that survives scaling, so states match within
+// alertStateTolerance.
+func stateConditions(states []float64) []string {
+	conditions := make([]string, 0, len(states))
+	for _, state := range states {
+		conditions = append(conditions, "abs($B - "+formatThreshold(state)+") < "+alertStateTolerance)
+	}
+	return conditions
+}
+
+// panelThresholdSteps turns the alert thresholds into panel color steps, so a
+// panel is amber or red on exactly the values the warning and critical rules
+// fire on. Grafana steps apply from their value upward while low rules fire at
+// or below theirs, so low steps start just above the threshold. Signals
+// without thresholds return nil.
+func panelThresholdSteps(signal AlertSignal) []dashboard.Threshold {
+	if signal.WarningLow == nil && signal.WarningHigh == nil && signal.CriticalLow == nil && signal.CriticalHigh == nil {
+		return nil
+	}
+
+	base := panelOKColor
+	if signal.CriticalLow != nil {
+		base = panelCriticalColor
+	} else if signal.WarningLow != nil {
+		base = panelWarningColor
+	}
+	steps := []dashboard.Threshold{{Color: base}}
+	// Equal thresholds collapse into one step, matching the expressions,
+	// which skip a warning that equals its critical threshold.
+	step := func(value float64, color string) {
+		last := &steps[len(steps)-1]
+		if last.Value != nil && value <= *last.Value {
+			last.Value, last.Color = &value, color
+			return
+		}
+		steps = append(steps, dashboard.Threshold{Value: &value, Color: color})
+	}
+
+	if signal.CriticalLow != nil {
+		color := panelOKColor
+		if signal.WarningLow != nil {
+			color = panelWarningColor
+		}
+		step(math.Nextafter(*signal.CriticalLow, math.Inf(1)), color)
+	}
+	if signal.WarningLow != nil {
+		step(math.Nextafter(*signal.WarningLow, math.Inf(1)), panelOKColor)
+	}
+	if signal.WarningHigh != nil {
+		step(*signal.WarningHigh, panelWarningColor)
+	}
+	if signal.CriticalHigh != nil {
+		step(*signal.CriticalHigh, panelCriticalColor)
+	}
+	return steps
+}
+
 func joinAlertConditions(conditions []string, separator string) string {
 	if len(conditions) == 0 {
 		return ""
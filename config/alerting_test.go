@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/grafana/grafana-foundation-sdk/go/dashboard"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -172,6 +173,8 @@ func TestBuildAlertProvisioningRejectsInvalidSignals(t *testing.T) {
 		{name: "negative stale interval", signals: []AlertSignal{{Topic: "data/a/value", StaleAfterSeconds: intPointer(-1)}}, want: "must be positive"},
 		{name: "NaN threshold", signals: []AlertSignal{{Topic: "data/a/value", CriticalHigh: float64Pointer(math.NaN())}}, want: "must be finite"},
 		{name: "infinite threshold", signals: []AlertSignal{{Topic: "data/a/value", WarningLow: float64Pointer(math.Inf(1))}}, want: "must be finite"},
+		{name: "NaN state", signals: []AlertSignal{{Topic: "data/a/value", CriticalStates: []float64{math.NaN()}}}, want: "alert states must be finite"},
+		{name: "state in both severities", signals: []AlertSignal{{Topic: "data/a/value", WarningStates: []float64{2}, CriticalStates: []float64{2}}}, want: "state 2 cannot be both warning and critical"},
 		{name: "descending thresholds", signals: []AlertSignal{{Topic: "data/a/value", CriticalLow: float64Pointer(300), WarningLow: float64Pointer(200)}}, want: "critical low threshold must not exceed warning low threshold"},
 	}
 
@@ -197,6 +200,8 @@ func TestAlertExpressions(t *testing.T) {
 		{name: "both critical bounds", signal: AlertSignal{CriticalLow: float64Pointer(-2), CriticalHigh: float64Pointer(2)}, wantCritical: "($B <= -2 || $B >= 2)"},
 		{name: "equal low critical and warning limits omit warning low band", signal: AlertSignal{CriticalLow: float64Pointer(-2), WarningLow: float64Pointer(-2)}, wantCritical: "$B <= -2"},
 		{name: "equal high warning and critical limits omit warning high band", signal: AlertSignal{WarningHigh: float64Pointer(2), CriticalHigh: float64Pointer(2)}, wantCritical: "$B >= 2"},
+		{name: "states", signal: AlertSignal{WarningStates: []float64{1}, CriticalStates: []float64{2, 3}}, wantWarning: "abs($B - 1) < 0.000001", wantCritical: "(abs($B - 2) < 0.000001 || abs($B - 3) < 0.000001)"},
+		{name: "states beside thresholds", signal: AlertSignal{CriticalHigh: float64Pointer(10), CriticalStates: []float64{0}}, wantCritical: "($B >= 10 || abs($B - 0) < 0.000001)"},
 	}
 
 	for _, test := range tests {
@@ -229,3 +234,54 @@ func assertAlertData(t *testing.T, rule alertRule, wantLookback int, wantConditi
 	assert.Equal(t, wantCondition, condition.Expression)
 	assert.Equal(t, "C", rule.Condition)
 }
+
+func TestPanelThresholdSteps(t *testing.T) {
+	above := func(value float64) *float64 {
+		next := math.Nextafter(value, math.Inf(1))
+		return &next
+	}
+	tests := []struct {
+		name   string
+		signal AlertSignal
+		want   []dashboard.Threshold
+	}{
+		{name: "no thresholds", signal: AlertSignal{Topic: "data/a/b", StaleAfterSeconds: intPointer(5)}},
+		{
+			name:   "all thresholds",
+			signal: AlertSignal{CriticalLow: float64Pointer(300), WarningLow: float64Pointer(600), WarningHigh: float64Pointer(6500), CriticalHigh: float64Pointer(7000)},
+			want: []dashboard.Threshold{
+				{Color: "red"},
+				{Value: above(300), Color: "orange"},
+				{Value: above(600), Color: "green"},
+				{Value: float64Pointer(6500), Color: "orange"},
+				{Value: float64Pointer(7000), Color: "red"},
+			},
+		},
+		{
+			name:   "high side only",
+			signal: AlertSignal{CriticalHigh: float64Pointer(60)},
+			want:   []dashboard.Threshold{{Color: "green"}, {Value: float64Pointer(60), Color: "red"}},
+		},
+		{
+			name:   "warning low only",
+			signal: AlertSignal{WarningLow: float64Pointer(11.5)},
+			want:   []dashboard.Threshold{{Color: "orange"}, {Value: above(11.5), Color: "green"}},
+		},
+		{
+			name:   "warning equal to critical",
+			signal: AlertSignal{WarningLow: float64Pointer(10), CriticalLow: float64Pointer(10), WarningHigh: float64Pointer(90), CriticalHigh: float64Pointer(90)},
+			want:   []dashboard.Threshold{{Color: "red"}, {Value: above(10), Color: "green"}, {Value: float64Pointer(90), Color: "red"}},
+		},
+		{
+			name:   "warning band collapsed to a point",
+			signal: AlertSignal{WarningLow: float64Pointer(5), WarningHigh: float64Pointer(5)},
+			want:   []dashboard.Threshold{{Color: "orange"}, {Value: float64Pointer(5), Color: "orange"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, panelThresholdSteps(tt.signal))
+		})
+	}
+}
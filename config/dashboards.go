@@ -14,6 +14,7 @@ import (
 	"github.com/grafana/grafana-foundation-sdk/go/common"
 	"github.com/grafana/grafana-foundation-sdk/go/dashboard"
 	"github.com/grafana/grafana-foundation-sdk/go/stat"
+	"github.com/grafana/grafana-foundation-sdk/go/statetimeline"
 	"github.com/grafana/grafana-foundation-sdk/go/timeseries"
 )
 
@@ -56,6 +57,7 @@ type topicSignal struct {
 	label       string
 	detailLabel string
 	topic       string
+	display     signalDisplay
 }
 
 type topicModule struct {
@@ -63,12 +65,22 @@ type topicModule struct {
 	signals []topicSignal
 }
 
-// SignalTopic is the topic mapping needed to generate dashboards. It stays
-// local because Vera v0.14 exposes MQTT mappings as signal metadata instead
-// of the former SignalTopic collection.
+// SignalTopic is the topic mapping needed to generate dashboards, with the
+// DBC definition panels format values from. It stays local because Vera v0.14
+// exposes MQTT mappings as signal metadata instead of the former SignalTopic
+// collection.
 type SignalTopic struct {
-	Signal string
-	Topic  string
+	Signal  string
+	Message string
+	Topic   string
+	Unit    string
+	Min     float64
+	Max     float64
+	Factor  float64
+	Offset  float64
+	// States labels the values of enumerated and boolean signals, which get
+	// state panels instead of numeric ones.
+	States []SignalState
 }
 
 // alertListOptions mirrors Grafana's native alertlist panel options. It is
@@ -96,30 +108,30 @@ type alertListStateFilter struct {
 
 // parseSignalTopicHierarchy groups topics into dashboard sections. A valid topic
 // has either a section and signal or a section, module, and signal after the
-// required data/ prefix.
-func parseSignalTopicHierarchy(signalTopics []SignalTopic) ([]topicSection, error) {
+// required data/ prefix. Alert signals supply the panel thresholds, so panels
+// and alert rules share one definition.
+func parseSignalTopicHierarchy(signalTopics []SignalTopic, alertSignals []AlertSignal) ([]topicSection, error) {
 	type sectionContents struct {
 		signals       []topicSignal
 		modulesByName map[string][]topicSignal
 	}
 
+	alertsByTopic := make(map[string]AlertSignal, len(alertSignals))
+	for _, alert := range alertSignals {
+		if err := validateAlertSignal(alert); err != nil {
+			return nil, err
+		}
+		alertsByTopic[alert.Topic] = alert
+	}
+
 	sectionsByName := make(map[string]sectionContents)
 	seenTopics := make(map[string]struct{}, len(signalTopics))
 
 	for _, signalTopic := range signalTopics {
 		topic := signalTopic.Topic
-		if !strings.HasPrefix(topic, topicPrefix) {
-			return nil, fmt.Errorf("each topic must start with %q: %s", topicPrefix, topic)
-		}
-
-		parts := strings.Split(strings.TrimPrefix(topic, topicPrefix), "/")
-		if len(parts) != 2 && len(parts) != 3 {
-			return nil, fmt.Errorf("topic must have a section and signal, optionally preceded by one module, after %q: %s", topicPrefix, topic)
-		}
-		for _, part := range parts {
-			if part == "" {
-				return nil, fmt.Errorf("topic levels cannot be empty: %s", topic)
-			}
+		parts, err := topicLevels(topic)
+		if err != nil {
+			return nil, err
 		}
 		if _, exists := seenTopics[topic]; exists {
 			return nil, fmt.Errorf("duplicate topic: %s", topic)
@@ -132,6 +144,7 @@ func parseSignalTopicHierarchy(signalTopics []SignalTopic) ([]topicSection, erro
 			label:       humanizeTopicSegment(parts[len(parts)-1]),
 			detailLabel: humanizeTopicPath(parts[1:]),
 			topic:       topic,
+			display:     displayFromSignal(signalTopic, alertsByTopic[topic]),
 		}
 		if len(parts) == 2 {
 			contents.signals = append(contents.signals, signal)
@@ -160,6 +173,25 @@ func parseSignalTopicHierarchy(signalTopics []SignalTopic) ([]topicSection, erro
 	return sections, nil
 }
 
+// topicLevels returns the levels of a topic after the data/ prefix, which
+// must be a section and signal, optionally with one module between them.
+func topicLevels(topic string) ([]string, error) {
+	if !strings.HasPrefix(topic, topicPrefix) {
+		return nil, fmt.Errorf("each topic must start with %q: %s", topicPrefix, topic)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(topic, topicPrefix), "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("topic must have a section and signal, optionally preceded by one module, after %q: %s", topicPrefix, topic)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("topic levels cannot be empty: %s", topic)
+		}
+	}
+	return parts, nil
+}
+
 func sortTopicSignals(signals []topicSignal) {
 	sort.Slice(signals, func(i, j int) bool {
 		if signals[i].label == signals[j].label {
@@ -281,25 +313,75 @@ func buildTelemetryDashboard(sections []topicSection) (dashboard.Dashboard, erro
 }
 
 func addTelemetrySignalPanels(builder *dashboard.DashboardBuilder, signal topicSignal, span uint32) *dashboard.DashboardBuilder {
+	links := []cog.Builder[dashboard.DashboardLink]{detailDashboardLink(signal.topic)}
 	return builder.WithPanel(
-		stat.NewPanelBuilder().
+		withSignalDisplay(stat.NewPanelBuilder().
 			Id(stablePanelID(signal.topic, 'l')).
-			Title(signal.label + " (live)").
+			Title(signal.label+" (live)").
 			Span(span).
-			GraphMode(common.BigValueGraphModeArea).
+			GraphMode(liveGraphMode(signal.display)).
 			NoValue("No data").
 			Datasource(dataSourceRef).
-			DataLinks([]cog.Builder[dashboard.DashboardLink]{detailDashboardLink(signal.topic)}).
-			WithTarget(NewMQTTQueryBuilder(signal.topic)),
+			DataLinks(links).
+			WithTarget(NewMQTTQueryBuilder(signal.topic)), signal.display),
 	).WithPanel(
-		timeseries.NewPanelBuilder().
-			Id(stablePanelID(signal.topic, 'h')).
-			Title(signal.label + " (history)").
+		signalHistoryPanel(signal, 'h', signal.label+" (history)", "", span, links),
+	)
+}
+
+// liveGraphMode leaves the sparkline out of state panels, where it would
+// plot state numbers.
+func liveGraphMode(display signalDisplay) common.BigValueGraphMode {
+	if display.mappings != nil {
+		return common.BigValueGraphModeNone
+	}
+	return common.BigValueGraphModeArea
+}
+
+// signalHistoryPanel is a state timeline for enumerated and boolean signals
+// and a timeseries, with its threshold bands, for the others.
+func signalHistoryPanel(signal topicSignal, kind byte, title string, description string, span uint32, links []cog.Builder[dashboard.DashboardLink]) cog.Builder[dashboard.Panel] {
+	if signal.display.mappings != nil {
+		panel := statetimeline.NewPanelBuilder().
+			Id(stablePanelID(signal.topic, kind)).
+			Title(title).
 			Span(span).
+			ShowValue(common.VisibilityModeAuto).
+			MergeValues(true).
 			Datasource(influxDBDataSourceRef).
-			DataLinks([]cog.Builder[dashboard.DashboardLink]{detailDashboardLink(signal.topic)}).
-			WithTarget(NewInfluxDBQueryBuilder(signal.topic)),
-	)
+			WithTarget(NewInfluxDBStateQueryBuilder(signal.topic))
+		if description != "" {
+			panel = panel.Description(description)
+		}
+		if links != nil {
+			panel = panel.DataLinks(links)
+		}
+		return withSignalDisplay(panel, signal.display)
+	}
+
+	panel := timeseries.NewPanelBuilder().
+		Id(stablePanelID(signal.topic, kind)).
+		Title(title).
+		Span(span).
+		Datasource(influxDBDataSourceRef).
+		WithTarget(NewInfluxDBQueryBuilder(signal.topic))
+	if description != "" {
+		panel = panel.Description(description)
+	}
+	if links != nil {
+		panel = panel.DataLinks(links)
+	}
+	return withThresholdsStyle(withSignalDisplay(panel, signal.display), signal.display)
+}
+
+// withThresholdsStyle draws the threshold steps as lines and bands on a
+// history panel, for signals with alert thresholds.
+func withThresholdsStyle(builder *timeseries.PanelBuilder, display signalDisplay) *timeseries.PanelBuilder {
+	if display.thresholds == nil {
+		return builder
+	}
+	return builder.ThresholdsStyle(common.NewGraphThresholdsStyleConfigBuilder().
+		Mode(common.GraphThresholdsStyleModeLineAndArea))
 }
 
 // buildSignalDetailDashboard creates a dedicated, literal-topic dashboard.
@@ -313,32 +395,26 @@ func buildSignalDetailDashboard(signal topicSignal) (dashboard.Dashboard, error)
 		LiveNow(true).
 		Time("now-24h", "now").
 		WithPanel(
-			stat.NewPanelBuilder().
+			withSignalDisplay(stat.NewPanelBuilder().
 				Id(stablePanelID(signal.topic, 'd')).
-				Title(signal.detailLabel + " (live)").
-				Description("Latest value from MQTT topic: " + signal.topic).
+				Title(signal.detailLabel+" (live)").
+				Description("Latest value from MQTT topic: "+signal.topic).
 				Span(24).
-				GraphMode(common.BigValueGraphModeArea).
+				GraphMode(liveGraphMode(signal.display)).
 				NoValue("No data").
 				Datasource(dataSourceRef).
-				WithTarget(NewMQTTQueryBuilder(signal.topic)),
+				WithTarget(NewMQTTQueryBuilder(signal.topic)), signal.display),
 		).
 		WithPanel(
-			timeseries.NewPanelBuilder().
-				Id(stablePanelID(signal.topic, 'D')).
-				Title(signal.detailLabel + " (history)").
-				Description("24-hour InfluxDB history for MQTT topic: " + signal.topic).
-				Span(24).
-				Datasource(influxDBDataSourceRef).
-				WithTarget(NewInfluxDBQueryBuilder(signal.topic)),
+			signalHistoryPanel(signal, 'D', signal.detailLabel+" (history)", "24-hour InfluxDB history for MQTT topic: "+signal.topic, 24, nil),
 		).
 		Build()
 }
 
 // createDashboardsWithSignalTopics generates a stable overview and one
 // deterministic drill-down dashboard per DBC signal-topic mapping.
-func createDashboardsWithSignalTopics(signalTopics []SignalTopic) (map[string]dashboard.Dashboard, error) {
-	sections, err := parseSignalTopicHierarchy(signalTopics)
+func createDashboardsWithSignalTopics(signalTopics []SignalTopic, alertSignals []AlertSignal) (map[string]dashboard.Dashboard, error) {
+	sections, err := parseSignalTopicHierarchy(signalTopics, alertSignals)
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +39,7 @@ func TestCreateDashboardsWithSignalTopics(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			dashboards, err := createDashboardsWithSignalTopics(test.topics)
+			dashboards, err := createDashboardsWithSignalTopics(test.topics, nil)
 			require.NoError(t, err)
 			require.Len(t, dashboards, test.wantCount)
 			telemetryDashboard, ok := dashboards["telemetry"]
@@ -74,6 +74,72 @@ func TestCreateDashboardsWithSignalTopics(t *testing.T) {
 	}
 }
 
+func TestSignalPanelsUseDBCDisplay(t *testing.T) {
+	topic := SignalTopic{Signal: "EngineSpeed", Topic: "data/powertrain/engine-speed", Unit: "rpm", Min: 0, Max: 8000, Factor: 0.25}
+	dashboards, err := createDashboardsWithSignalTopics([]SignalTopic{topic}, nil)
+	require.NoError(t, err)
+
+	for _, key := range []string{"telemetry", detailDashboardKey(topic.Topic)} {
+		encoded, err := json.Marshal(dashboards[key])
+		require.NoError(t, err)
+		generated := string(encoded)
+		for _, expected := range []string{`"unit":"rpm"`, `"decimals":2`, `"min":0`, `"max":8000`} {
+			assert.Equal(t, 2, strings.Count(generated, expected), "%s in %s", expected, key)
+		}
+	}
+}
+
+func TestSignalPanelsUseAlertThresholds(t *testing.T) {
+	topics := []SignalTopic{
+		{Signal: "EngineSpeed", Topic: "data/powertrain/engine-speed", Factor: 1},
+		{Signal: "OilPressure", Topic: "data/powertrain/oil-pressure", Factor: 1},
+	}
+	alerts := []AlertSignal{{Topic: "data/powertrain/engine-speed", WarningHigh: float64Pointer(6500), CriticalHigh: float64Pointer(7000)}}
+	dashboards, err := createDashboardsWithSignalTopics(topics, alerts)
+	require.NoError(t, err)
+
+	encoded, err := json.Marshal(dashboards[detailDashboardKey("data/powertrain/engine-speed")])
+	require.NoError(t, err)
+	generated := string(encoded)
+	steps := `"steps":[{"value":null,"color":"green"},{"value":6500,"color":"orange"},{"value":7000,"color":"red"}]`
+	assert.Equal(t, 2, strings.Count(generated, steps), "live and history panels")
+	assert.Equal(t, 1, strings.Count(generated, `"thresholdsStyle":{"mode":"line+area"}`))
+
+	encoded, err = json.Marshal(dashboards[detailDashboardKey("data/powertrain/oil-pressure")])
+	require.NoError(t, err)
+	generated = string(encoded)
+	assert.Equal(t, 2, strings.Count(generated, `"steps":[{"value":null,"color":"green"}]`), "no default red step")
+	assert.NotContains(t, generated, "thresholdsStyle")
+
+	_, err = createDashboardsWithSignalTopics(topics, []AlertSignal{{Topic: "data/powertrain/engine-speed", WarningHigh: float64Pointer(7000), CriticalHigh: float64Pointer(6500)}})
+	require.ErrorContains(t, err, "warning high threshold must not exceed critical high threshold")
+}
+
+func TestStateSignalPanels(t *testing.T) {
+	topics := []SignalTopic{{
+		Signal: "DrsState",
+		Topic:  "data/dynamics/drs",
+		Factor: 1,
+		States: []SignalState{{0, "DRS CLOSED"}, {1, "DRS OPEN"}, {2, "DRS FAULT"}},
+	}}
+	alerts := []AlertSignal{{Topic: "data/dynamics/drs", CriticalStates: []float64{2}}}
+	dashboards, err := createDashboardsWithSignalTopics(topics, alerts)
+	require.NoError(t, err)
+
+	for _, key := range []string{"telemetry", detailDashboardKey("data/dynamics/drs")} {
+		encoded, err := json.Marshal(dashboards[key])
+		require.NoError(t, err)
+		generated := string(encoded)
+		mapping := `"mappings":[{"type":"value","options":{"0":{"text":"DRS CLOSED","index":0},"1":{"text":"DRS OPEN","index":1},"2":{"text":"DRS FAULT","color":"red","index":2}}}]`
+		assert.Equal(t, 2, strings.Count(generated, mapping), "live and history panels in %s", key)
+		assert.Equal(t, 1, strings.Count(generated, `"type":"state-timeline"`), key)
+		assert.Equal(t, 1, strings.Count(generated, `"graphMode":"none"`), key)
+		assert.NotContains(t, generated, `"type":"timeseries"`, key)
+		assert.Equal(t, 1, strings.Count(generated, "fn: last"), "the state timeline keeps the last state of each window in %s", key)
+		assert.NotContains(t, generated, "fn: mean", key)
+	}
+}
+
 func TestParseSignalTopicHierarchy(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -99,7 +165,7 @@ func TestParseSignalTopicHierarchy(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got, err := parseSignalTopicHierarchy(test.topics)
+			got, err := parseSignalTopicHierarchy(test.topics, nil)
 			if test.wantError != "" {
 				require.ErrorContains(t, err, test.wantError)
 				return
@@ -116,7 +182,7 @@ func TestBuildTelemetryDashboardUsesCompactModuleGrid(t *testing.T) {
 		{Topic: "data/battery/m1/s3"},
 		{Topic: "data/battery/m1/s1"},
 		{Topic: "data/battery/m1/s2"},
-	})
+	}, nil)
 	require.NoError(t, err)
 
 	telemetry, err := buildTelemetryDashboard(sections)
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+// provisioningDiff is what regenerating the provisioning folders would change.
+type provisioningDiff struct {
+	Dashboards []dashboardChange `json:"dashboards"`
+	AlertRules []alertRuleChange `json:"alertRules"`
+}
+
+func (d provisioningDiff) empty() bool {
+	return len(d.Dashboards) == 0 && len(d.AlertRules) == 0
+}
+
+type dashboardChange struct {
+	Key    string `json:"key"`
+	Title  string `json:"title"`
+	Change string `json:"change"`
+	// Settings lists the changed dashboard fields other than panels.
+	Settings []string      `json:"settings,omitempty"`
+	Panels   []panelChange `json:"panels,omitempty"`
+}
+
+type panelChange struct {
+	Key    string `json:"key"`
+	Title  string `json:"title"`
+	Change string `json:"change"`
+	// Fields lists the changed panel fields, such as fieldConfig or targets.
+	Fields []string `json:"fields,omitempty"`
+}
+
+type alertRuleChange struct {
+	UID    string `json:"uid"`
+	Title  string `json:"title"`
+	Change string `json:"change"`
+	// PreviousUID is set when a rule with the same title changes UID, which
+	// Grafana treats as deleting one rule and creating another.
+	PreviousUID string   `json:"previousUid,omitempty"`
+	Details     []string `json:"details,omitempty"`
+}
+
+// runDiff renders the provisioning files into memory and prints how they
+// differ from the provisioning folders, without writing anything. Like diff,
+// it returns 0 without changes, 1 with changes and 2 on errors.
+func runDiff(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dbcFilePath := flags.String("dbc-file", os.Getenv("DBC_FILE_PATH"), "path to the DBC file")
+	dashboardsPath := flags.String("dashboards-path", os.Getenv("DASHBOARDS_PATH"), "dashboard provisioning folder to compare with")
+	alertsPath := flags.String("alerts-path", os.Getenv("ALERTS_PATH"), "alert provisioning folder to compare with")
+	format := flags.String("format", "human", "output format: human or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "human" && *format != "json" {
+		fmt.Fprintf(stderr, "unknown format %q, expected human or json\n", *format)
+		return 2
+	}
+	for _, required := range []struct{ name, value string }{
+		{"DBC_FILE_PATH or --dbc-file", *dbcFilePath},
+		{"DASHBOARDS_PATH or --dashboards-path", *dashboardsPath},
+		{"ALERTS_PATH or --alerts-path", *alertsPath},
+	} {
+		if required.value == "" {
+			fmt.Fprintf(stderr, "%s is required\n", required.name)
+			return 2
+		}
+	}
+
+	diff, err := diffProvisioningFolders(*dbcFilePath, *dashboardsPath, *alertsPath)
+	if err != nil {
+		fmt.Fprintln(stderr, strings.TrimSpace(err.Error()))
+		return 2
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diff); err != nil {
+			fmt.Fprintln(stderr, err.Error())
+			return 2
+		}
+	} else {
+		printProvisioningDiff(stdout, diff)
+	}
+
+	if !diff.empty() {
+		return 1
+	}
+	return 0
+}
+
+func diffProvisioningFolders(dbcFilePath string, dashboardsPath string, alertsPath string) (provisioningDiff, error) {
+	config, extensions, err := readDbcFile(dbcFilePath)
+	if err != nil {
+		return provisioningDiff{}, err
+	}
+	dashboards, alertSignals, err := renderProvisioning(config, extensions)
+	if err != nil {
+		return provisioningDiff{}, err
+	}
+	alerts, err := buildAlertProvisioning(alertSignals)
+	if err != nil {
+		return provisioningDiff{}, err
+	}
+
+	rendered := make(map[string]map[string]any, len(dashboards))
+	for key, dashboard := range dashboards {
+		if rendered[key], err = normalizeJSON(dashboard); err != nil {
+			return provisioningDiff{}, fmt.Errorf("render dashboard %s: %w", key, err)
+		}
+	}
+	var renderedRules []map[string]any
+	for _, group := range alerts.Groups {
+		for _, rule := range group.Rules {
+			normalized, err := normalizeJSON(rule)
+			if err != nil {
+				return provisioningDiff{}, fmt.Errorf("render alert rule %s: %w", rule.UID, err)
+			}
+			renderedRules = append(renderedRules, normalized)
+		}
+	}
+
+	current, err := readProvisionedDashboards(dashboardsPath)
+	if err != nil {
+		return provisioningDiff{}, err
+	}
+	currentRules, err := readProvisionedAlertRules(filepath.Join(alertsPath, "alerts.json"))
+	if err != nil {
+		return provisioningDiff{}, err
+	}
+
+	return provisioningDiff{
+		Dashboards: diffDashboards(current, rendered),
+		AlertRules: diffAlertRules(currentRules, renderedRules),
+	}, nil
+}
+
+// normalizeJSON round-trips a value through JSON, so rendered and provisioned
+// files compare as the same generic maps.
+func normalizeJSON(value any) (map[string]any, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var normalized map[string]any
+	if err := json.Unmarshal(encoded, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// readProvisionedDashboards reads the dashboard files the generator wrote,
+// keyed like createDashboardsWithSignalTopics. A missing folder has none.
+func readProvisionedDashboards(path string) (map[string]map[string]any, error) {
+	entries, err := os.ReadDir(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]map[string]any{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read dashboards folder: %w", err)
+	}
+
+	dashboards := make(map[string]map[string]any)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		contents, err := os.ReadFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read dashboard %s: %w", entry.Name(), err)
+		}
+		var dashboard map[string]any
+		if err := json.Unmarshal(contents, &dashboard); err != nil {
+			return nil, fmt.Errorf("parse dashboard %s: %w", entry.Name(), err)
+		}
+		dashboards[strings.TrimSuffix(entry.Name(), ".json")] = dashboard
+	}
+	return dashboards, nil
+}
+
+// readProvisionedAlertRules reads the rules of the alert file the generator
+// wrote. A missing file has none.
+func readProvisionedAlertRules(path string) ([]map[string]any, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read alert provisioning: %w", err)
+	}
+
+	var provisioning struct {
+		Groups []struct {
+			Rules []map[string]any `json:"rules"`
+		} `json:"groups"`
+	}
+	if err := json.Unmarshal(contents, &provisioning); err != nil {
+		return nil, fmt.Errorf("parse alert provisioning: %w", err)
+	}
+	var rules []map[string]any
+	for _, group := range provisioning.Groups {
+		rules = append(rules, group.Rules...)
+	}
+	return rules, nil
+}
+
+func diffDashboards(current map[string]map[string]any, rendered map[string]map[string]any) []dashboardChange {
+	changes := make([]dashboardChange, 0)
+	for _, key := range sortedUnion(current, rendered) {
+		before, existed := current[key]
+		after, exists := rendered[key]
+		switch {
+		case !existed:
+			changes = append(changes, dashboardChange{Key: key, Title: stringField(after, "title"), Change: changeAdded})
+		case !exists:
+			changes = append(changes, dashboardChange{Key: key, Title: stringField(before, "title"), Change: changeRemoved})
+		default:
+			change := dashboardChange{
+				Key:      key,
+				Title:    stringField(after, "title"),
+				Change:   changeChanged,
+				Settings: changedFields(before, after, "panels"),
+				Panels:   diffPanels(before["panels"], after["panels"]),
+			}
+			if len(change.Settings) > 0 || len(change.Panels) > 0 {
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes
+}
+
+// diffPanels matches panels by ID, and rows, whose ID is zero, by title. It
+// lists panels in dashboard order, then removed ones.
+func diffPanels(current any, rendered any) []panelChange {
+	index := func(value any) ([]string, map[string]map[string]any) {
+		var keys []string
+		panels := make(map[string]map[string]any)
+		list, _ := value.([]any)
+		for _, item := range list {
+			panel, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			key := "row " + stringField(panel, "title")
+			if id, ok := panel["id"].(float64); ok && id != 0 {
+				key = fmt.Sprintf("panel %d", int64(id))
+			}
+			// Module rows of different sections can share a title.
+			for occurrence := 2; panels[key] != nil; occurrence++ {
+				key = fmt.Sprintf("row %s #%d", stringField(panel, "title"), occurrence)
+			}
+			keys = append(keys, key)
+			panels[key] = panel
+		}
+		return keys, panels
+	}
+	currentKeys, before := index(current)
+	renderedKeys, after := index(rendered)
+
+	changes := make([]panelChange, 0)
+	for _, key := range renderedKeys {
+		updated := after[key]
+		old, existed := before[key]
+		if !existed {
+			changes = append(changes, panelChange{Key: key, Title: stringField(updated, "title"), Change: changeAdded})
+			continue
+		}
+		// Adding a signal moves the panels after it; only moving is not
+		// worth a review.
+		if fields := changedFields(old, updated, "gridPos"); len(fields) > 0 {
+			changes = append(changes, panelChange{Key: key, Title: stringField(updated, "title"), Change: changeChanged, Fields: fields})
+		}
+	}
+	for _, key := range currentKeys {
+		if _, exists := after[key]; !exists {
+			changes = append(changes, panelChange{Key: key, Title: stringField(before[key], "title"), Change: changeRemoved})
+		}
+	}
+	return changes
+}
+
+// diffAlertRules matches rules by UID. A rule whose title is kept under a new
+// UID is reported once, as a UID change.
+func diffAlertRules(current []map[string]any, rendered []map[string]any) []alertRuleChange {
+	index := func(rules []map[string]any) map[string]map[string]any {
+		byUID := make(map[string]map[string]any, len(rules))
+		for _, rule := range rules {
+			byUID[stringField(rule, "uid")] = rule
+		}
+		return byUID
+	}
+	before, after := index(current), index(rendered)
+
+	removedByTitle := make(map[string]string)
+	for uid, rule := range before {
+		if _, exists := after[uid]; !exists {
+			removedByTitle[stringField(rule, "title")] = uid
+		}
+	}
+
+	changes := make([]alertRuleChange, 0)
+	for _, uid := range sortedUnion(before, after) {
+		old, existed := before[uid]
+		updated, exists := after[uid]
+		switch {
+		case !existed:
+			title := stringField(updated, "title")
+			if previousUID, renamed := removedByTitle[title]; renamed {
+				delete(removedByTitle, title)
+				changes = append(changes, alertRuleChange{
+					UID:         uid,
+					Title:       title,
+					Change:      changeChanged,
+					PreviousUID: previousUID,
+					Details:     append([]string{fmt.Sprintf("uid: %s -> %s", previousUID, uid)}, alertRuleDetails(before[previousUID], updated)...),
+				})
+				continue
+			}
+			changes = append(changes, alertRuleChange{UID: uid, Title: title, Change: changeAdded, Details: []string{"condition: " + alertCondition(updated)}})
+		case !exists:
+			// Reported below, unless a rendered rule kept its title.
+		default:
+			if details := alertRuleDetails(old, updated); len(details) > 0 {
+				changes = append(changes, alertRuleChange{UID: uid, Title: stringField(updated, "title"), Change: changeChanged, Details: details})
+			}
+		}
+	}
+	for title, uid := range removedByTitle {
+		changes = append(changes, alertRuleChange{UID: uid, Title: title, Change: changeRemoved})
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Title < changes[j].Title })
+	return changes
+}
+
+// alertRuleDetails describes a changed condition and lookback explicitly,
+// and other changes by field name.
+func alertRuleDetails(current map[string]any, rendered map[string]any) []string {
+	var details []string
+	if before, after := alertCondition(current), alertCondition(rendered); before != after {
+		details = append(details, fmt.Sprintf("condition: %s -> %s", before, after))
+	}
+	if before, after := alertLookback(current), alertLookback(rendered); before != after {
+		details = append(details, fmt.Sprintf("lookback: %ds -> %ds", before, after))
+	}
+	for _, field := range changedFields(current, rendered, "uid", "data") {
+		details = append(details, field+" changed")
+	}
+	if len(details) == 0 && !reflect.DeepEqual(current["data"], rendered["data"]) {
+		details = append(details, "query changed")
+	}
+	return details
+}
+
+// alertCondition is the math expression of a rule's condition query.
+func alertCondition(rule map[string]any) string {
+	for _, query := range alertQueries(rule) {
+		if stringField(query, "refId") == stringField(rule, "condition") {
+			model, _ := query["model"].(map[string]any)
+			return stringField(model, "expression")
+		}
+	}
+	return ""
+}
+
+// alertLookback is the time range of a rule's InfluxDB query, in seconds.
+func alertLookback(rule map[string]any) int {
+	for _, query := range alertQueries(rule) {
+		if stringField(query, "datasourceUid") != alertDatasourceUID {
+			continue
+		}
+		timeRange, _ := query["relativeTimeRange"].(map[string]any)
+		from, _ := timeRange["from"].(float64)
+		return int(from)
+	}
+	return 0
+}
+
+func alertQueries(rule map[string]any) []map[string]any {
+	list, _ := rule["data"].([]any)
+	queries := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		if query, ok := item.(map[string]any); ok {
+			queries = append(queries, query)
+		}
+	}
+	return queries
+}
+
+// changedFields lists the top-level fields that differ, except ignored ones.
+func changedFields(current map[string]any, rendered map[string]any, ignored ...string) []string {
+	var fields []string
+	for _, field := range sortedUnion(current, rendered) {
+		if slices.Contains(ignored, field) {
+			continue
+		}
+		if !reflect.DeepEqual(current[field], rendered[field]) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func stringField(object map[string]any, field string) string {
+	value, _ := object[field].(string)
+	return value
+}
+
+func sortedUnion[V any](first map[string]V, second map[string]V) []string {
+	keys := make([]string, 0, len(first)+len(second))
+	for key := range first {
+		keys = append(keys, key)
+	}
+	for key := range second {
+		if _, exists := first[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func printProvisioningDiff(w io.Writer, diff provisioningDiff) {
+	if diff.empty() {
+		fmt.Fprintln(w, "Grafana provisioning is up to date")
+		return
+	}
+	symbols := map[string]string{changeAdded: "+", changeRemoved: "-", changeChanged: "~"}
+
+	if len(diff.Dashboards) > 0 {
+		fmt.Fprintln(w, "Dashboards:")
+		for _, change := range diff.Dashboards {
+			fmt.Fprintf(w, "  %s %s (%s)\n", symbols[change.Change], change.Title, change.Key)
+			if len(change.Settings) > 0 {
+				fmt.Fprintf(w, "      ~ settings: %s\n", strings.Join(change.Settings, ", "))
+			}
+			for _, panel := range change.Panels {
+				line := fmt.Sprintf("      %s %s %q", symbols[panel.Change], panel.Key, panel.Title)
+				if len(panel.Fields) > 0 {
+					line += ": " + strings.Join(panel.Fields, ", ")
+				}
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+	if len(diff.AlertRules) > 0 {
+		fmt.Fprintln(w, "Alert rules:")
+		for _, change := range diff.AlertRules {
+			fmt.Fprintf(w, "  %s %s (%s)\n", symbols[change.Change], change.Title, change.UID)
+			for _, detail := range change.Details {
+				fmt.Fprintf(w, "      %s\n", detail)
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d dashboards and %d alert rules would change\n", len(diff.Dashboards), len(diff.AlertRules))
+}
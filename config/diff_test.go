@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const diffBaseDBC = `VERSION "test"
+NS_ :
+BS_:
+BU_: ECU
+BO_ 256 Powertrain: 8 ECU
+ SG_ EngineSpeed : 0|16@1+ (1,0) [0|8000] "rpm" ECU
+ SG_ OilPressure : 16|16@1+ (0.1,0) [0|400] "kPa" ECU
+BA_DEF_ SG_ "VeraMqttTopic" STRING ;
+BA_ "VeraMqttTopic" SG_ 256 EngineSpeed "data/powertrain/engine-speed";
+BA_ "VeraMqttTopic" SG_ 256 OilPressure "data/powertrain/oil-pressure";
+BA_ "VeraCriticalHigh" SG_ 256 EngineSpeed 7000;
+`
+
+// provisionFolders provisions dbc the way main does, and returns the DBC,
+// dashboards and alerts paths.
+func provisionFolders(t *testing.T, dbc string) (string, string, string) {
+	t.Helper()
+	root := t.TempDir()
+	dbcPath := filepath.Join(root, "vehicle.dbc")
+	require.NoError(t, os.WriteFile(dbcPath, []byte(dbc), 0o600))
+	dashboardsPath := filepath.Join(root, "dashboards")
+	alertsPath := filepath.Join(root, "alerts")
+	require.NoError(t, os.MkdirAll(dashboardsPath, 0o755))
+	require.NoError(t, os.MkdirAll(alertsPath, 0o755))
+
+	config, extensions, err := readDbcFile(dbcPath)
+	require.NoError(t, err)
+	dashboards, alerts, err := renderProvisioning(config, extensions)
+	require.NoError(t, err)
+	require.NoError(t, createProviderFile(dashboardsPath+string(os.PathSeparator)))
+	require.NoError(t, writeProvisioning(dashboards, alerts, dashboardsPath, alertsPath))
+	return dbcPath, dashboardsPath, alertsPath
+}
+
+func TestDiffProvisioningFolders(t *testing.T) {
+	dbcPath, dashboardsPath, alertsPath := provisionFolders(t, diffBaseDBC)
+
+	unchanged, err := diffProvisioningFolders(dbcPath, dashboardsPath, alertsPath)
+	require.NoError(t, err)
+	assert.True(t, unchanged.empty(), "%+v", unchanged)
+
+	changedDBC := strings.NewReplacer(
+		`"data/powertrain/oil-pressure"`, `"data/powertrain/oil"`,
+		`EngineSpeed 7000;`, "EngineSpeed 7500;\nBA_ \"VeraWarningHigh\" SG_ 256 EngineSpeed 6500;",
+	).Replace(diffBaseDBC)
+	require.NoError(t, os.WriteFile(dbcPath, []byte(changedDBC), 0o600))
+
+	diff, err := diffProvisioningFolders(dbcPath, dashboardsPath, alertsPath)
+	require.NoError(t, err)
+
+	changes := make(map[string]dashboardChange)
+	for _, change := range diff.Dashboards {
+		changes[change.Key] = change
+	}
+	assert.Equal(t, changeAdded, changes[detailDashboardKey("data/powertrain/oil")].Change)
+	assert.Equal(t, changeRemoved, changes[detailDashboardKey("data/powertrain/oil-pressure")].Change)
+	engine := changes[detailDashboardKey("data/powertrain/engine-speed")]
+	assert.Equal(t, []panelChange{
+		{Key: fmt.Sprintf("panel %d", stablePanelID("data/powertrain/engine-speed", 'd')), Title: "Engine Speed (live)", Change: changeChanged, Fields: []string{"fieldConfig"}},
+		{Key: fmt.Sprintf("panel %d", stablePanelID("data/powertrain/engine-speed", 'D')), Title: "Engine Speed (history)", Change: changeChanged, Fields: []string{"fieldConfig"}},
+	}, engine.Panels, "threshold steps changed")
+	telemetry := changes["telemetry"]
+	var telemetryPanels []string
+	for _, panel := range telemetry.Panels {
+		telemetryPanels = append(telemetryPanels, panel.Change+" "+panel.Title)
+	}
+	assert.Equal(t, []string{
+		"changed Engine Speed (live)", "changed Engine Speed (history)",
+		"added Oil (live)", "added Oil (history)",
+		"removed Oil Pressure (live)", "removed Oil Pressure (history)",
+	}, telemetryPanels)
+
+	assert.Equal(t, []alertRuleChange{
+		{UID: alertRuleUID("data/powertrain/engine-speed", "critical"), Title: "data/powertrain/engine-speed critical", Change: changeChanged, Details: []string{"condition: $B >= 7000 -> $B >= 7500"}},
+		{UID: alertRuleUID("data/powertrain/engine-speed", "warning"), Title: "data/powertrain/engine-speed warning", Change: changeAdded, Details: []string{"condition: ($B >= 6500 && $B < 7500)"}},
+	}, diff.AlertRules)
+}
+
+func TestDiffAlertRules(t *testing.T) {
+	rule := func(uid string, title string, expression string, lookback int) map[string]any {
+		normalized, err := normalizeJSON(alertRule{
+			UID:       uid,
+			Title:     title,
+			Condition: "C",
+			Data:      alertRuleData("data/a/b", expression, lookback),
+			For:       "0s",
+		})
+		require.NoError(t, err)
+		return normalized
+	}
+	paused := rule("paused", "data/a/paused critical", "$B >= 1", 300)
+	paused["isPaused"] = true
+
+	diff := diffAlertRules(
+		[]map[string]any{
+			rule("old-uid", "data/a/b critical", "$B >= 1", 300),
+			rule("lookback", "data/a/lookback stale", "is_number($B) == 0", 5),
+			rule("removed", "data/a/removed warning", "$B >= 1", 300),
+			rule("paused", "data/a/paused critical", "$B >= 1", 300),
+		},
+		[]map[string]any{
+			rule("new-uid", "data/a/b critical", "$B >= 1", 300),
+			rule("lookback", "data/a/lookback stale", "is_number($B) == 0", 2),
+			paused,
+		},
+	)
+
+	assert.Equal(t, []alertRuleChange{
+		{UID: "new-uid", Title: "data/a/b critical", Change: changeChanged, PreviousUID: "old-uid", Details: []string{"uid: old-uid -> new-uid"}},
+		{UID: "lookback", Title: "data/a/lookback stale", Change: changeChanged, Details: []string{"lookback: 5s -> 2s"}},
+		{UID: "paused", Title: "data/a/paused critical", Change: changeChanged, Details: []string{"isPaused changed"}},
+		{UID: "removed", Title: "data/a/removed warning", Change: changeRemoved},
+	}, diff)
+}
+
+func TestRunDiff(t *testing.T) {
+	dbcPath, dashboardsPath, alertsPath := provisionFolders(t, diffBaseDBC)
+	changedPath := filepath.Join(t.TempDir(), "changed.dbc")
+	require.NoError(t, os.WriteFile(changedPath, []byte(strings.Replace(diffBaseDBC, "EngineSpeed 7000;", "EngineSpeed 7500;", 1)), 0o600))
+	folders := []string{"--dashboards-path", dashboardsPath, "--alerts-path", alertsPath}
+	listing := func() map[string]string {
+		files := make(map[string]string)
+		for _, folder := range []string{dashboardsPath, alertsPath} {
+			entries, err := os.ReadDir(folder)
+			require.NoError(t, err)
+			for _, entry := range entries {
+				contents, err := os.ReadFile(filepath.Join(folder, entry.Name()))
+				require.NoError(t, err)
+				files[entry.Name()] = string(contents)
+			}
+		}
+		return files
+	}
+	before := listing()
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{name: "up to date", args: append([]string{"--dbc-file", dbcPath}, folders...), wantCode: 0, wantStdout: "Grafana provisioning is up to date\n"},
+		{name: "changes", args: append([]string{"--dbc-file", changedPath}, folders...), wantCode: 1, wantStdout: "condition: $B >= 7000 -> $B >= 7500\n2 dashboards and 1 alert rules would change\n"},
+		{name: "json", args: append([]string{"--dbc-file", changedPath, "--format", "json"}, folders...), wantCode: 1, wantStdout: `"alertRules": [`},
+		{name: "missing folders", args: []string{"--dbc-file", dbcPath}, wantCode: 2, wantStderr: "DASHBOARDS_PATH or --dashboards-path is required"},
+		{name: "unreadable DBC", args: append([]string{"--dbc-file", filepath.Join(t.TempDir(), "missing.dbc")}, folders...), wantCode: 2, wantStderr: "error while opening DBC file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("DASHBOARDS_PATH", "")
+			t.Setenv("ALERTS_PATH", "")
+			var stdout, stderr bytes.Buffer
+
+			code := runDiff(test.args, &stdout, &stderr)
+
+			assert.Equal(t, test.wantCode, code)
+			assert.Contains(t, stdout.String(), test.wantStdout)
+			assert.Contains(t, stderr.String(), test.wantStderr)
+		})
+	}
+	assert.Equal(t, before, listing(), "a dry run writes nothing")
+}
+
+func TestDiffAgainstEmptyFolders(t *testing.T) {
+	dbcPath, _, _ := provisionFolders(t, diffBaseDBC)
+	root := t.TempDir()
+
+	diff, err := diffProvisioningFolders(dbcPath, filepath.Join(root, "dashboards"), filepath.Join(root, "alerts"))
+
+	require.NoError(t, err)
+	require.Len(t, diff.Dashboards, 3)
+	for _, change := range diff.Dashboards {
+		assert.Equal(t, changeAdded, change.Change)
+	}
+	require.Len(t, diff.AlertRules, 1)
+	assert.Equal(t, changeAdded, diff.AlertRules[0].Change)
+}
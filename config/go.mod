@@ -2,6 +2,8 @@ module github.com/ApexCorse/ephoros/config
 
 go 1.25.1
 
+require github.com/ApexCorse/ephoros/schema v0.0.0
+
 require github.com/ApexCorse/vera v0.14.0
 
 require github.com/grafana/grafana-foundation-sdk/go v0.0.0-20251008104357-2e5c9f991a96
@@ -12,3 +14,5 @@ require (
 	github.com/stretchr/testify v1.11.1
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/ApexCorse/ephoros/schema => ../schema
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -9,9 +10,17 @@ import (
 	"github.com/ApexCorse/vera"
 	"github.com/grafana/grafana-foundation-sdk/go/cog"
 	"github.com/grafana/grafana-foundation-sdk/go/cog/plugins"
+	"github.com/grafana/grafana-foundation-sdk/go/dashboard"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	dashboardsPath := os.Getenv("DASHBOARDS_PATH")
 	if dashboardsPath == "" {
 		fmt.Println("missing env DASHBOARDS_PATH")
@@ -38,54 +47,53 @@ func main() {
 		os.Exit(1)
 	}
 
-	config, err := getDbcConfig()
+	config, extensions, err := getDbcConfig()
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
 
-	signalTopics, alertSignals, err := signalsFromMetadata(config)
+	dashboards, alertSignals, err := renderProvisioning(config, extensions)
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
 
-	dashboards, err := createDashboardsWithSignalTopics(signalTopics)
-	if err != nil {
+	if err := writeProvisioning(dashboards, alertSignals, dashboardsPath, alertsPath); err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
+}
 
-	for key, dashboard := range dashboards {
-		file, err := os.Create(dashboardsPath + key + ".json")
-		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(1)
-		}
+// renderProvisioning builds the dashboards and the alert signals for the DBC,
+// for main to write and for diff to compare with the folders.
+func renderProvisioning(config *vera.Config, extensions dbcSignalExtensions) (map[string]dashboard.Dashboard, []AlertSignal, error) {
+	signalTopics, alertSignals, err := signalsFromMetadata(config, extensions)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		json, err := json.MarshalIndent(dashboard, "", "  ")
-		if err != nil {
-			fmt.Println(err.Error())
-			file.Close()
-			os.Exit(1)
-		}
+	dashboards, err := createDashboardsWithSignalTopics(signalTopics, alertSignals)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dashboards, alertSignals, nil
+}
 
-		_, err = file.Write(json)
+// writeProvisioning writes one file per dashboard and the alert rules into
+// folders that already exist.
+func writeProvisioning(dashboards map[string]dashboard.Dashboard, alertSignals []AlertSignal, dashboardsPath string, alertsPath string) error {
+	for key, generated := range dashboards {
+		encoded, err := json.MarshalIndent(generated, "", "  ")
 		if err != nil {
-			fmt.Println(err.Error())
-			file.Close()
-			os.Exit(1)
+			return err
 		}
-		if err := file.Close(); err != nil {
-			fmt.Println(err.Error())
-			os.Exit(1)
+		if err := os.WriteFile(filepath.Join(dashboardsPath, key+".json"), encoded, 0o644); err != nil {
+			return err
 		}
 	}
 
-	if err := WriteAlertProvisioning(filepath.Join(alertsPath, "alerts.json"), alertSignals); err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
-	}
+	return WriteAlertProvisioning(filepath.Join(alertsPath, "alerts.json"), alertSignals)
 }
 
 func preconfigGrafana() {
@@ -97,27 +105,37 @@ func preconfigGrafana() {
 	cog.NewRuntime().RegisterDataqueryVariant(InfluxDBQueryVariantConfig())
 }
 
-func getDbcConfig() (*vera.Config, error) {
+func getDbcConfig() (*vera.Config, dbcSignalExtensions, error) {
 	dbcFilePath := os.Getenv("DBC_FILE_PATH")
 	if dbcFilePath == "" {
-		return nil, fmt.Errorf("DBC_FILE_PATH env var is not set")
+		return nil, dbcSignalExtensions{}, fmt.Errorf("DBC_FILE_PATH env var is not set")
 	}
-
-	dbcFile, err := os.Open(dbcFilePath)
-	if os.IsNotExist(err) && filepath.Base(dbcFilePath) == "config.dbc" {
+	// Generation falls back to the example so a fresh checkout still gets
+	// dashboards; validate and diff check exactly the file they are given.
+	if _, err := os.Stat(dbcFilePath); os.IsNotExist(err) && filepath.Base(dbcFilePath) == "config.dbc" {
 		dbcFilePath = filepath.Join(filepath.Dir(dbcFilePath), "config.example.dbc")
-		dbcFile, err = os.Open(dbcFilePath)
 	}
+	return readDbcFile(dbcFilePath)
+}
+
+// readDbcFile parses the DBC file with Vera, and for the value tables, state
+// alerts and cycle times Vera does not read.
+func readDbcFile(dbcFilePath string) (*vera.Config, dbcSignalExtensions, error) {
+	contents, err := os.ReadFile(dbcFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("error while opening DBC file: %w\n", err)
+		return nil, dbcSignalExtensions{}, fmt.Errorf("error while opening DBC file: %w\n", err)
 	}
 
-	config, err := vera.Parse(dbcFile)
+	config, err := vera.Parse(bytes.NewReader(contents))
+	if err != nil {
+		return nil, dbcSignalExtensions{}, fmt.Errorf("error in parsing DBC file: %w\n", err)
+	}
+	extensions, err := parseSignalExtensions(bytes.NewReader(contents))
 	if err != nil {
-		return nil, fmt.Errorf("error in parsing DBC file: %w\n", err)
+		return nil, dbcSignalExtensions{}, fmt.Errorf("error in parsing DBC file: %w\n", err)
 	}
 
-	return config, nil
+	return config, extensions, nil
 }
 
 func cleanProvisioningFolder(path string) error {
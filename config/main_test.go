@@ -60,7 +60,7 @@ func TestGetDbcConfig(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			t.Setenv("DBC_FILE_PATH", test.setup(t))
-			config, err := getDbcConfig()
+			config, extensions, err := getDbcConfig()
 			if test.wantError != "" {
 				require.ErrorContains(t, err, test.wantError)
 				assert.Nil(t, config)
@@ -68,7 +68,7 @@ func TestGetDbcConfig(t *testing.T) {
 			}
 			require.NoError(t, err)
 			require.NotNil(t, config)
-			topics, _, err := signalsFromMetadata(config)
+			topics, _, err := signalsFromMetadata(config, extensions)
 			require.NoError(t, err)
 			assert.Len(t, topics, test.wantTopics)
 			assert.Equal(t, "data/powertrain/engine-speed", topics[0].Topic)
@@ -133,3 +133,22 @@ func TestCreateProviderFile(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteProvisioning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicle.dbc")
+	require.NoError(t, os.WriteFile(path, []byte(validDBC), 0o600))
+	config, extensions, err := readDbcFile(path)
+	require.NoError(t, err)
+	dashboards, alerts, err := renderProvisioning(config, extensions)
+	require.NoError(t, err)
+	// Without the trailing separator the compose default has.
+	dashboardsPath, alertsPath := t.TempDir(), t.TempDir()
+
+	require.NoError(t, writeProvisioning(dashboards, alerts, dashboardsPath, alertsPath))
+
+	for key := range dashboards {
+		assert.FileExists(t, filepath.Join(dashboardsPath, key+".json"))
+	}
+	assert.FileExists(t, filepath.Join(alertsPath, "alerts.json"))
+	require.Error(t, writeProvisioning(dashboards, alerts, filepath.Join(dashboardsPath, "missing"), alertsPath))
+}
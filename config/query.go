@@ -5,17 +5,16 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ApexCorse/ephoros/schema"
 	"github.com/grafana/grafana-foundation-sdk/go/cog"
 	"github.com/grafana/grafana-foundation-sdk/go/cog/variants"
 )
 
 const influxDBQueryTemplate = `from(bucket: %q)
   |> range(start: v.timeRangeStart, stop: v.timeRangeStop)
-  |> filter(fn: (r) => r["_measurement"] == "can_signal")
-  |> filter(fn: (r) => r["_field"] == "value")
-  |> filter(fn: (r) => r["topic"] == %q)
-  |> aggregateWindow(every: v.windowPeriod, fn: mean, createEmpty: false)
-  |> yield(name: "mean")`
+  %s
+  |> aggregateWindow(every: v.windowPeriod, fn: %[3]s, createEmpty: false)
+  |> yield(name: "%[3]s")`
 
 type InfluxDBQuery struct {
 	RefId        string `json:"refId"`
@@ -53,8 +52,18 @@ var _ cog.Builder[variants.Dataquery] = (*InfluxDBQueryBuilder)(nil)
 type InfluxDBQueryBuilder struct{ internal *InfluxDBQuery }
 
 func NewInfluxDBQueryBuilder(topic string) *InfluxDBQueryBuilder {
+	return newInfluxDBQueryBuilder(topic, "mean")
+}
+
+// NewInfluxDBStateQueryBuilder keeps the last value of every window, as the
+// mean of enumerated states is no state at all.
+func NewInfluxDBStateQueryBuilder(topic string) *InfluxDBQueryBuilder {
+	return newInfluxDBQueryBuilder(topic, "last")
+}
+
+func newInfluxDBQueryBuilder(topic string, aggregate string) *InfluxDBQueryBuilder {
 	return &InfluxDBQueryBuilder{internal: &InfluxDBQuery{
-		Query:    fmt.Sprintf(influxDBQueryTemplate, influxDBBucket(), topic),
+		Query:    fmt.Sprintf(influxDBQueryTemplate, influxDBBucket(), schema.FluxTopicFilter(topic), aggregate),
 		RawQuery: true, ResultFormat: "time_series",
 	}}
 }
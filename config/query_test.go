@@ -37,12 +37,23 @@ func TestInfluxDBQueryBuilder(t *testing.T) {
 			assert.Contains(t, got.Query, `from(bucket: "`+test.wantBucket+`")`)
 			assert.Contains(t, got.Query, `r["topic"] == `)
 			assert.Contains(t, got.Query, strconv.Quote(test.topic))
+			assert.Contains(t, got.Query, "fn: mean")
 			assert.Equal(t, "influxdb", got.DataqueryType())
 			require.NoError(t, got.Validate())
 		})
 	}
 }
 
+func TestInfluxDBStateQueryBuilder(t *testing.T) {
+	query, err := NewInfluxDBStateQueryBuilder("data/dynamics/drs").Build()
+	require.NoError(t, err)
+
+	got := query.(InfluxDBQuery)
+	assert.Contains(t, got.Query, `|> aggregateWindow(every: v.windowPeriod, fn: last, createEmpty: false)`)
+	assert.Contains(t, got.Query, `|> yield(name: "last")`)
+	assert.NotContains(t, got.Query, "mean")
+}
+
 func TestInfluxDBQueryEquals(t *testing.T) {
 	base := InfluxDBQuery{RefId: "A", Query: "query", RawQuery: true, ResultFormat: "time_series"}
 	tests := []struct {
@@ -2,16 +2,18 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/ApexCorse/vera"
 )
 
-// signalsFromMetadata converts Vera's signal-scoped metadata into the compact
-// inputs consumed by dashboard and alert provisioning. Signals without an MQTT
-// topic are irrelevant to Grafana unless they define an alert or stale policy;
-// in that case failing is safer than silently omitting the policy.
-func signalsFromMetadata(config *vera.Config) ([]SignalTopic, []AlertSignal, error) {
+// signalsFromMetadata converts Vera's signal-scoped metadata, with the value
+// tables and state alerts Vera does not parse, into the compact inputs
+// consumed by dashboard and alert provisioning. Signals without an MQTT topic
+// are irrelevant to Grafana unless they define an alert or stale policy; in
+// that case failing is safer than silently omitting the policy.
+func signalsFromMetadata(config *vera.Config, extensions dbcSignalExtensions) ([]SignalTopic, []AlertSignal, error) {
 	if config == nil {
 		return nil, nil, fmt.Errorf("Vera config cannot be nil")
 	}
@@ -21,11 +23,8 @@ func signalsFromMetadata(config *vera.Config) ([]SignalTopic, []AlertSignal, err
 	for _, message := range config.Messages {
 		for _, signal := range message.Signals {
 			metadata := signal.Metadata
-			hasAlertPolicy := metadata.WarningLow != nil ||
-				metadata.WarningHigh != nil ||
-				metadata.CriticalLow != nil ||
-				metadata.CriticalHigh != nil ||
-				metadata.StaleAfterMs != nil
+			key := signalKey{messageID: message.ID, signal: signal.Name}
+			hasAlertPolicy := hasAlertPolicy(signal, extensions.warningStates[key], extensions.criticalStates[key])
 			topic := strings.TrimSpace(metadata.MQTTTopic)
 
 			if topic == "" {
@@ -39,17 +38,39 @@ func signalsFromMetadata(config *vera.Config) ([]SignalTopic, []AlertSignal, err
 				continue
 			}
 
-			topics = append(topics, SignalTopic{Topic: topic})
+			states := signalStates(signal, extensions.valueTables[key])
+			topics = append(topics, SignalTopic{
+				Signal:  signal.Name,
+				Message: message.Name,
+				Topic:   topic,
+				Unit:    signal.Unit,
+				Min:     dbcFloat(signal.Min),
+				Max:     dbcFloat(signal.Max),
+				Factor:  dbcFloat(signal.Factor),
+				Offset:  dbcFloat(signal.Offset),
+				States:  states,
+			})
 			if !hasAlertPolicy {
 				continue
 			}
 
+			warningStates, err := resolveStates(extensions.warningStates[key], signal, states)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s of signal %q in message %q: %w", warningStatesAttribute, signal.Name, message.Name, err)
+			}
+			criticalStates, err := resolveStates(extensions.criticalStates[key], signal, states)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s of signal %q in message %q: %w", criticalStatesAttribute, signal.Name, message.Name, err)
+			}
+
 			alerts = append(alerts, AlertSignal{
 				Topic:             topic,
 				WarningLow:        float64PointerFromFloat32(metadata.WarningLow),
 				WarningHigh:       float64PointerFromFloat32(metadata.WarningHigh),
 				CriticalLow:       float64PointerFromFloat32(metadata.CriticalLow),
 				CriticalHigh:      float64PointerFromFloat32(metadata.CriticalHigh),
+				WarningStates:     warningStates,
+				CriticalStates:    criticalStates,
 				StaleAfterSeconds: staleAfterSeconds(metadata.StaleAfterMs),
 				DashboardUID:      detailDashboardKey(topic),
 				PanelID:           int(stablePanelID(topic, 'D')),
@@ -60,6 +81,19 @@ func signalsFromMetadata(config *vera.Config) ([]SignalTopic, []AlertSignal, err
 	return topics, alerts, nil
 }
 
+// hasAlertPolicy reports whether a signal defines thresholds, state alerts or
+// a stale policy.
+func hasAlertPolicy(signal vera.Signal, warningStates string, criticalStates string) bool {
+	metadata := signal.Metadata
+	return metadata.WarningLow != nil ||
+		metadata.WarningHigh != nil ||
+		metadata.CriticalLow != nil ||
+		metadata.CriticalHigh != nil ||
+		metadata.StaleAfterMs != nil ||
+		warningStates != "" ||
+		criticalStates != ""
+}
+
 func float64PointerFromFloat32(value *float32) *float64 {
 	if value == nil {
 		return nil
@@ -68,6 +102,13 @@ func float64PointerFromFloat32(value *float32) *float64 {
 	return &converted
 }
 
+// dbcFloat widens a DBC number through its shortest decimal form, so a factor
+// of 0.1 reaches Grafana as 0.1 rather than 0.10000000149011612.
+func dbcFloat(value float32) float64 {
+	widened, _ := strconv.ParseFloat(strconv.FormatFloat(float64(value), 'g', -1, 32), 64)
+	return widened
+}
+
 // staleAfterSeconds rounds upward so that Grafana never considers a signal
 // stale sooner than the DBC's millisecond policy permits.
 func staleAfterSeconds(milliseconds *uint32) *int {
@@ -17,7 +17,11 @@ func TestSignalsFromMetadata(t *testing.T) {
 		Name: "Powertrain",
 		Signals: []vera.Signal{
 			{
-				Name: "EngineSpeed",
+				Name:   "EngineSpeed",
+				Unit:   "rpm",
+				Factor: 0.25,
+				Min:    0,
+				Max:    8000,
 				Metadata: vera.SignalMetadata{
 					MQTTTopic:    "data/powertrain/engine-speed",
 					WarningLow:   float32PointerForMetadata(600),
@@ -29,17 +33,20 @@ func TestSignalsFromMetadata(t *testing.T) {
 			},
 			{
 				Name:     "AmbientLight",
+				Unit:     "%",
+				Factor:   0.1,
+				Offset:   -40,
 				Metadata: vera.SignalMetadata{MQTTTopic: "data/interior/ambient-light"},
 			},
 			{Name: "Unpublished"},
 		},
 	}}}
 
-	topics, alerts, err := signalsFromMetadata(config)
+	topics, alerts, err := signalsFromMetadata(config, dbcSignalExtensions{})
 	require.NoError(t, err)
 	assert.Equal(t, []SignalTopic{
-		{Topic: "data/powertrain/engine-speed"},
-		{Topic: "data/interior/ambient-light"},
+		{Signal: "EngineSpeed", Message: "Powertrain", Topic: "data/powertrain/engine-speed", Unit: "rpm", Max: 8000, Factor: 0.25},
+		{Signal: "AmbientLight", Message: "Powertrain", Topic: "data/interior/ambient-light", Unit: "%", Factor: 0.1, Offset: -40},
 	}, topics)
 	require.Len(t, alerts, 1)
 	assert.Equal(t, "data/powertrain/engine-speed", alerts[0].Topic)
@@ -66,10 +73,57 @@ func TestSignalsFromMetadataRejectsPolicyWithoutTopic(t *testing.T) {
 		}},
 	}}}
 
-	_, _, err := signalsFromMetadata(config)
+	_, _, err := signalsFromMetadata(config, dbcSignalExtensions{})
 	require.EqualError(t, err, `signal "EngineSpeed" in message "Powertrain" defines alert metadata but has no MQTT topic`)
 }
 
+func TestSignalsFromMetadataStates(t *testing.T) {
+	drs := signalKey{messageID: 258, signal: "DrsState"}
+	config := &vera.Config{Messages: []vera.Message{{
+		ID:   258,
+		Name: "VehicleDynamics",
+		Signals: []vera.Signal{
+			{Name: "DrsState", Length: 2, Factor: 1, Metadata: vera.SignalMetadata{MQTTTopic: "data/dynamics/drs"}},
+			{Name: "BrakeLight", Length: 1, Factor: 1, Metadata: vera.SignalMetadata{MQTTTopic: "data/dynamics/brake-light"}},
+			{Name: "VehicleSpeed", Length: 16, Factor: 0.01, Metadata: vera.SignalMetadata{MQTTTopic: "data/dynamics/speed"}},
+		},
+	}}}
+	extensions := dbcSignalExtensions{
+		valueTables:    map[signalKey][]rawState{drs: {{0, "DRS CLOSED"}, {1, "DRS OPEN"}, {2, "DRS FAULT"}}},
+		warningStates:  map[signalKey]string{drs: "1"},
+		criticalStates: map[signalKey]string{drs: "drs fault"},
+	}
+
+	topics, alerts, err := signalsFromMetadata(config, extensions)
+	require.NoError(t, err)
+	require.Len(t, topics, 3)
+	assert.Equal(t, []SignalState{{0, "DRS CLOSED"}, {1, "DRS OPEN"}, {2, "DRS FAULT"}}, topics[0].States)
+	assert.Equal(t, []SignalState{{0, "Off"}, {1, "On"}}, topics[1].States, "1-bit signals are boolean")
+	assert.Nil(t, topics[2].States)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, []float64{1}, alerts[0].WarningStates)
+	assert.Equal(t, []float64{2}, alerts[0].CriticalStates)
+
+	tests := []struct {
+		name       string
+		signal     signalKey
+		states     string
+		wantErrMsg string
+	}{
+		{name: "unknown state", signal: drs, states: "DRS STUCK", wantErrMsg: `EphorosCriticalStates of signal "DrsState" in message "VehicleDynamics": unknown state "DRS STUCK"`},
+		{name: "numeric signal", signal: signalKey{messageID: 258, signal: "VehicleSpeed"}, states: "1", wantErrMsg: "only enumerated and 1-bit signals can alert on states"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			invalid := extensions
+			invalid.criticalStates = map[signalKey]string{test.signal: test.states}
+
+			_, _, err := signalsFromMetadata(config, invalid)
+			require.ErrorContains(t, err, test.wantErrMsg)
+		})
+	}
+}
+
 func TestStaleAfterSecondsRoundsUp(t *testing.T) {
 	tests := []struct {
 		milliseconds *uint32
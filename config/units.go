@@ -0,0 +1,197 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-foundation-sdk/go/cog"
+	"github.com/grafana/grafana-foundation-sdk/go/dashboard"
+)
+
+// maxPanelDecimals bounds the decimals derived from a DBC scaling, so a
+// factor such as 0.0001 still reads well on a stat panel.
+const maxPanelDecimals = 6
+
+// grafanaUnits maps the units DBC files use to Grafana unit IDs. Other units,
+// including ambiguous ones such as C (coulomb or Celsius) and g (gram or
+// acceleration), are shown as a custom suffix. Units are case-sensitive: S is
+// siemens, not seconds.
+var grafanaUnits = map[string]string{
+	"%":     "percent",
+	"rpm":   "rpm",
+	"RPM":   "rpm",
+	"degC":  "celsius",
+	"°C":    "celsius",
+	"degF":  "fahrenheit",
+	"°F":    "fahrenheit",
+	"K":     "kelvin",
+	"deg":   "degree",
+	"°":     "degree",
+	"rad":   "radian",
+	"Pa":    "pressurepa",
+	"hPa":   "pressurehpa",
+	"kPa":   "pressurekpa",
+	"bar":   "pressurebar",
+	"mbar":  "pressurembar",
+	"psi":   "pressurepsi",
+	"km/h":  "velocitykmh",
+	"kph":   "velocitykmh",
+	"m/s":   "velocityms",
+	"mph":   "velocitymph",
+	"m/s^2": "accMS2",
+	"m/s²":  "accMS2",
+	"V":     "volt",
+	"mV":    "mvolt",
+	"A":     "amp",
+	"mA":    "mamp",
+	"W":     "watt",
+	"kW":    "kwatt",
+	"Wh":    "watth",
+	"kWh":   "kwatth",
+	"Ah":    "amph",
+	"mAh":   "mamph",
+	"Hz":    "hertz",
+	"s":     "s",
+	"ms":    "ms",
+	"us":    "µs",
+	"m":     "lengthm",
+	"mm":    "lengthmm",
+	"km":    "lengthkm",
+	"l":     "litre",
+	"L":     "litre",
+}
+
+// grafanaUnit returns the Grafana unit for a DBC unit, or "" for none.
+func grafanaUnit(dbcUnit string) string {
+	unit := strings.TrimSpace(dbcUnit)
+	if unit == "" {
+		return ""
+	}
+	if id, ok := grafanaUnits[unit]; ok {
+		return id
+	}
+	return "suffix: " + unit
+}
+
+// scalingDecimals is the number of decimals a DBC factor and offset can
+// produce: a factor of 0.25 gives values such as 4213.75, so two.
+func scalingDecimals(factor float64, offset float64) float64 {
+	decimals := 0
+	for _, value := range []float64{factor, offset} {
+		for decimals < maxPanelDecimals && !isWhole(value*math.Pow10(decimals)) {
+			decimals++
+		}
+	}
+	return float64(decimals)
+}
+
+// isWhole tolerates the float32 rounding of DBC factors, such as 0.1 stored
+// as 0.10000000149, but not a small factor rounding down to zero.
+func isWhole(value float64) bool {
+	rounded := math.Round(value)
+	return math.Abs(value-rounded) < 1e-6 && (rounded != 0 || value == 0)
+}
+
+// signalDisplay is how panels format one signal's values.
+type signalDisplay struct {
+	unit       string
+	min        *float64
+	max        *float64
+	decimals   *float64
+	thresholds []dashboard.Threshold
+	mappings   []dashboard.ValueMapping
+}
+
+// displayFromSignal derives the panel formatting from the DBC definition and
+// the alert thresholds. A `[0|0]` or inverted range means the DBC sets no
+// range, and a zero factor means the scaling is unknown. State signals show
+// their labels instead, so they get neither unit nor range.
+func displayFromSignal(signal SignalTopic, alert AlertSignal) signalDisplay {
+	if len(signal.States) > 0 {
+		return signalDisplay{thresholds: panelThresholdSteps(alert), mappings: stateMappings(signal, alert)}
+	}
+	display := signalDisplay{unit: grafanaUnit(signal.Unit), thresholds: panelThresholdSteps(alert)}
+	if signal.Max > signal.Min {
+		display.min, display.max = &signal.Min, &signal.Max
+	}
+	if signal.Factor != 0 {
+		decimals := scalingDecimals(signal.Factor, signal.Offset)
+		display.decimals = &decimals
+	}
+	return display
+}
+
+// stateMappings label each state, colored like the alert it raises, if any.
+// Grafana looks values up by their exact text, which a fractional scaling
+// does not reproduce: raw 3 with a factor of 0.1 arrives as
+// 0.30000000000000004. Such states match the half scaling step around them
+// instead.
+func stateMappings(signal SignalTopic, alert AlertSignal) []dashboard.ValueMapping {
+	wholeScaling := isWhole(signal.Factor) && isWhole(signal.Offset)
+	halfStep := math.Abs(signal.Factor) / 2
+	options := make(map[string]dashboard.ValueMappingResult, len(signal.States))
+	var ranges []dashboard.ValueMapping
+	for index, state := range signal.States {
+		result := dashboard.ValueMappingResult{Text: cog.ToPtr(state.Label), Index: cog.ToPtr(int32(index))}
+		if slices.Contains(alert.CriticalStates, state.Value) {
+			result.Color = cog.ToPtr(panelCriticalColor)
+		} else if slices.Contains(alert.WarningStates, state.Value) {
+			result.Color = cog.ToPtr(panelWarningColor)
+		}
+		if wholeScaling || halfStep == 0 {
+			// 'f' never uses an exponent, so a million is "1000000" as in
+			// JavaScript.
+			options[strconv.FormatFloat(state.Value, 'f', -1, 64)] = result
+			continue
+		}
+		ranges = append(ranges, dashboard.ValueMapping{RangeMap: &dashboard.RangeMap{
+			Type: dashboard.MappingTypeRangeToText,
+			Options: dashboard.DashboardRangeMapOptions{
+				From:   cog.ToPtr(state.Value - halfStep),
+				To:     cog.ToPtr(state.Value + halfStep),
+				Result: result,
+			},
+		}})
+	}
+	if ranges != nil {
+		return ranges
+	}
+	return []dashboard.ValueMapping{{ValueMap: &dashboard.ValueMap{Type: dashboard.MappingTypeValueToText, Options: options}}}
+}
+
+// fieldConfigBuilder is the field configuration shared by the stat and
+// timeseries panel builders.
+type fieldConfigBuilder[B any] interface {
+	Unit(unit string) B
+	Min(min float64) B
+	Max(max float64) B
+	Decimals(decimals float64) B
+	Thresholds(thresholds cog.Builder[dashboard.ThresholdsConfig]) B
+	Mappings(mappings []dashboard.ValueMapping) B
+}
+
+func withSignalDisplay[B fieldConfigBuilder[B]](builder B, display signalDisplay) B {
+	if display.unit != "" {
+		builder = builder.Unit(display.unit)
+	}
+	if display.min != nil && display.max != nil {
+		builder = builder.Min(*display.min).Max(*display.max)
+	}
+	if display.decimals != nil {
+		builder = builder.Decimals(*display.decimals)
+	}
+	if display.mappings != nil {
+		builder = builder.Mappings(display.mappings)
+	}
+	// Without steps Grafana applies its default ones, red from 80, which
+	// would mark an RPM panel critical at idle.
+	steps := display.thresholds
+	if steps == nil {
+		steps = []dashboard.Threshold{{Color: panelOKColor}}
+	}
+	return builder.Thresholds(dashboard.NewThresholdsConfigBuilder().
+		Mode(dashboard.ThresholdsModeAbsolute).
+		Steps(steps))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/grafana/grafana-foundation-sdk/go/cog"
+	"github.com/grafana/grafana-foundation-sdk/go/dashboard"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrafanaUnit(t *testing.T) {
+	tests := []struct {
+		dbcUnit string
+		want    string
+	}{
+		{dbcUnit: "rpm", want: "rpm"},
+		{dbcUnit: "RPM", want: "rpm"},
+		{dbcUnit: "degC", want: "celsius"},
+		{dbcUnit: "°C", want: "celsius"},
+		{dbcUnit: "kPa", want: "pressurekpa"},
+		{dbcUnit: "km/h", want: "velocitykmh"},
+		{dbcUnit: "%", want: "percent"},
+		{dbcUnit: "mA", want: "mamp"},
+		{dbcUnit: " V ", want: "volt"},
+		{dbcUnit: "Nm", want: "suffix: Nm"},
+		{dbcUnit: "C", want: "suffix: C"},
+		{dbcUnit: "g", want: "suffix: g"},
+		{dbcUnit: "S", want: "suffix: S"},
+		{dbcUnit: "KPA", want: "suffix: KPA"},
+		{dbcUnit: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dbcUnit, func(t *testing.T) {
+			assert.Equal(t, tt.want, grafanaUnit(tt.dbcUnit))
+		})
+	}
+}
+
+func TestScalingDecimals(t *testing.T) {
+	tests := []struct {
+		name   string
+		factor float64
+		offset float64
+		want   float64
+	}{
+		{name: "integer scaling", factor: 1, want: 0},
+		{name: "coarse integer scaling", factor: 5, offset: -40, want: 0},
+		{name: "tenths", factor: 0.1, want: 1},
+		{name: "float32 tenths", factor: float64(float32(0.1)), want: 1},
+		{name: "quarters", factor: 0.25, want: 2},
+		{name: "offset adds decimals", factor: 1, offset: -0.5, want: 1},
+		{name: "capped", factor: 1e-9, want: maxPanelDecimals},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, scalingDecimals(tt.factor, tt.offset))
+		})
+	}
+}
+
+// TestStateMappingsMatchPublishedValues looks states up the way Grafana does,
+// by exact text or by range, with the values the simulator and the bridge
+// write: the raw value times a float32 DBC factor.
+func TestStateMappingsMatchPublishedValues(t *testing.T) {
+	factor := float64(float32(0.1))
+	signal := SignalTopic{Factor: dbcFloat(float32(0.1)), States: []SignalState{{Value: 0, Label: "Off"}, {Value: 3 * dbcFloat(float32(0.1)), Label: "Boost"}}}
+	mappings := displayFromSignal(signal, AlertSignal{}).mappings
+
+	lookup := func(value float64) string {
+		for _, mapping := range mappings {
+			if mapping.ValueMap != nil {
+				if result, ok := mapping.ValueMap.Options[strconv.FormatFloat(value, 'g', -1, 64)]; ok {
+					return *result.Text
+				}
+			}
+			if options := mapping.RangeMap; options != nil && value >= *options.Options.From && value <= *options.Options.To {
+				return *options.Options.Result.Text
+			}
+		}
+		return ""
+	}
+
+	assert.Equal(t, "Off", lookup(0))
+	assert.Equal(t, "Boost", lookup(3*factor), "float32 factor")
+	assert.Equal(t, "Boost", lookup(3*0.1), "float64 factor")
+	assert.Equal(t, "", lookup(0.2))
+}
+
+func TestDisplayFromSignal(t *testing.T) {
+	floatPointer := func(value float64) *float64 { return &value }
+	tests := []struct {
+		name   string
+		signal SignalTopic
+		want   signalDisplay
+	}{
+		{
+			name:   "full definition",
+			signal: SignalTopic{Unit: "rpm", Min: 0, Max: 8000, Factor: 0.25},
+			want:   signalDisplay{unit: "rpm", min: floatPointer(0), max: floatPointer(8000), decimals: floatPointer(2)},
+		},
+		{
+			name:   "no range",
+			signal: SignalTopic{Unit: "Nm", Factor: 1},
+			want:   signalDisplay{unit: "suffix: Nm", decimals: floatPointer(0)},
+		},
+		{
+			name:   "inverted range",
+			signal: SignalTopic{Min: 10, Max: -10, Factor: 1},
+			want:   signalDisplay{decimals: floatPointer(0)},
+		},
+		{name: "unknown scaling", signal: SignalTopic{}, want: signalDisplay{}},
+		{
+			name:   "whole scaled states",
+			signal: SignalTopic{Factor: 1, Offset: -1, States: []SignalState{{Value: -1, Label: "Unknown"}, {Value: 1e6, Label: "Limp"}}},
+			want: signalDisplay{mappings: []dashboard.ValueMapping{{ValueMap: &dashboard.ValueMap{Type: dashboard.MappingTypeValueToText, Options: map[string]dashboard.ValueMappingResult{
+				"-1":      {Text: cog.ToPtr("Unknown"), Index: cog.ToPtr(int32(0))},
+				"1000000": {Text: cog.ToPtr("Limp"), Index: cog.ToPtr(int32(1))},
+			}}}}},
+		},
+		{
+			name:   "fractional scaled states",
+			signal: SignalTopic{Factor: 0.5, States: []SignalState{{Value: 0, Label: "Off"}, {Value: 1.5, Label: "Boost"}}},
+			want: signalDisplay{mappings: []dashboard.ValueMapping{
+				{RangeMap: &dashboard.RangeMap{Type: dashboard.MappingTypeRangeToText, Options: dashboard.DashboardRangeMapOptions{
+					From: floatPointer(-0.25), To: floatPointer(0.25), Result: dashboard.ValueMappingResult{Text: cog.ToPtr("Off"), Index: cog.ToPtr(int32(0))},
+				}}},
+				{RangeMap: &dashboard.RangeMap{Type: dashboard.MappingTypeRangeToText, Options: dashboard.DashboardRangeMapOptions{
+					From: floatPointer(1.25), To: floatPointer(1.75), Result: dashboard.ValueMappingResult{Text: cog.ToPtr("Boost"), Index: cog.ToPtr(int32(1))},
+				}}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, displayFromSignal(tt.signal, AlertSignal{}))
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ApexCorse/vera"
+)
+
+// validationProblem is one way a DBC breaks the Ephoros conventions.
+type validationProblem struct {
+	Message string `json:"message"`
+	Signal  string `json:"signal"`
+	Topic   string `json:"topic,omitempty"`
+	Problem string `json:"problem"`
+}
+
+func (p validationProblem) String() string {
+	location := p.Message + "." + p.Signal
+	if p.Topic != "" {
+		location += " (" + p.Topic + ")"
+	}
+	return location + ": " + p.Problem
+}
+
+type validationReport struct {
+	DBCFile  string              `json:"dbcFile"`
+	Valid    bool                `json:"valid"`
+	Problems []validationProblem `json:"problems"`
+}
+
+// runValidate lints the DBC and prints every problem. It returns 0 for a
+// valid DBC, 1 when it has problems and 2 when it cannot be read.
+func runValidate(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dbcFilePath := flags.String("dbc-file", os.Getenv("DBC_FILE_PATH"), "path to the DBC file")
+	format := flags.String("format", "human", "output format: human or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "human" && *format != "json" {
+		fmt.Fprintf(stderr, "unknown format %q, expected human or json\n", *format)
+		return 2
+	}
+	if *dbcFilePath == "" {
+		fmt.Fprintln(stderr, "DBC_FILE_PATH or --dbc-file is required")
+		return 2
+	}
+
+	config, extensions, err := readDbcFile(*dbcFilePath)
+	if err != nil {
+		fmt.Fprint(stderr, err.Error())
+		return 2
+	}
+
+	problems := validateDbc(config, extensions)
+	report := validationReport{DBCFile: *dbcFilePath, Valid: len(problems) == 0, Problems: problems}
+	if *format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintln(stderr, err.Error())
+			return 2
+		}
+	} else {
+		for _, problem := range problems {
+			fmt.Fprintln(stdout, problem.String())
+		}
+		if report.Valid {
+			fmt.Fprintf(stdout, "%s follows the Ephoros conventions\n", *dbcFilePath)
+		} else {
+			fmt.Fprintf(stdout, "%d problems in %s\n", len(problems), *dbcFilePath)
+		}
+	}
+
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// validateDbc checks every signal against the conventions generation relies
+// on, and reports all problems instead of stopping at the first.
+func validateDbc(config *vera.Config, extensions dbcSignalExtensions) []validationProblem {
+	problems := make([]validationProblem, 0)
+	topicOwners := make(map[string]string)
+
+	for _, message := range config.Messages {
+		for _, signal := range message.Signals {
+			key := signalKey{messageID: message.ID, signal: signal.Name}
+			topic := strings.TrimSpace(signal.Metadata.MQTTTopic)
+			report := func(format string, args ...any) {
+				problems = append(problems, validationProblem{
+					Message: message.Name,
+					Signal:  signal.Name,
+					Topic:   topic,
+					Problem: fmt.Sprintf(format, args...),
+				})
+			}
+
+			if end := signalEndByte(signal); end >= int(message.Length) {
+				report("signal ends in byte %d, beyond the %d-byte message", end+1, message.Length)
+			}
+
+			warningStates, criticalStates := extensions.warningStates[key], extensions.criticalStates[key]
+			if topic == "" {
+				if hasAlertPolicy(signal, warningStates, criticalStates) {
+					report("defines alert metadata but has no MQTT topic")
+				}
+			} else {
+				if _, err := topicLevels(topic); err != nil {
+					report("%s", err.Error())
+				}
+				if previous, exists := topicOwners[topic]; exists {
+					report("topic is also used by %s", previous)
+				} else {
+					topicOwners[topic] = message.Name + "." + signal.Name
+				}
+			}
+
+			states := signalStates(signal, extensions.valueTables[key])
+			alert := AlertSignal{
+				WarningLow:   dbcFloatPointer(signal.Metadata.WarningLow),
+				WarningHigh:  dbcFloatPointer(signal.Metadata.WarningHigh),
+				CriticalLow:  dbcFloatPointer(signal.Metadata.CriticalLow),
+				CriticalHigh: dbcFloatPointer(signal.Metadata.CriticalHigh),
+			}
+			var err error
+			if alert.WarningStates, err = resolveStates(warningStates, signal, states); err != nil {
+				report("%s: %s", warningStatesAttribute, err.Error())
+			}
+			if alert.CriticalStates, err = resolveStates(criticalStates, signal, states); err != nil {
+				report("%s: %s", criticalStatesAttribute, err.Error())
+			}
+			if err := checkThresholds(alert); err != nil {
+				report("%s", err.Error())
+			}
+
+			if minimum, maximum := dbcFloat(signal.Min), dbcFloat(signal.Max); maximum > minimum {
+				for _, threshold := range []struct {
+					name  string
+					value *float64
+				}{
+					{"critical low", alert.CriticalLow},
+					{"warning low", alert.WarningLow},
+					{"warning high", alert.WarningHigh},
+					{"critical high", alert.CriticalHigh},
+				} {
+					if threshold.value != nil && (*threshold.value < minimum || *threshold.value > maximum) {
+						report("%s threshold %s is outside the signal range [%s|%s]", threshold.name, formatThreshold(*threshold.value), formatThreshold(minimum), formatThreshold(maximum))
+					}
+				}
+			}
+
+			if staleAfter := signal.Metadata.StaleAfterMs; staleAfter != nil {
+				if cycleTime := extensions.cycleTimesMs[message.ID]; float64(*staleAfter) < cycleTime {
+					report("stale policy of %dms is shorter than the %sms message cycle time", *staleAfter, formatThreshold(cycleTime))
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+// dbcFloatPointer widens a threshold like the range it is compared with, so
+// a threshold equal to the DBC maximum is not reported as outside it.
+func dbcFloatPointer(value *float32) *float64 {
+	if value == nil {
+		return nil
+	}
+	widened := dbcFloat(*value)
+	return &widened
+}
+
+// signalEndByte is the highest byte a signal occupies, walking its bits the
+// way the simulator decodes them: Motorola signals start at their most
+// significant bit and continue into the next byte.
+func signalEndByte(signal vera.Signal) int {
+	position := int(signal.StartBit)
+	highest := position
+	for range int(signal.Length) - 1 {
+		if signal.Endianness == vera.BigEndian {
+			if position%8 == 0 {
+				position += 15
+			} else {
+				position--
+			}
+		} else {
+			position++
+		}
+		highest = max(highest, position)
+	}
+	return highest / 8
+}
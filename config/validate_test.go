@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ApexCorse/vera"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const problematicDBC = `VERSION "test"
+NS_ :
+BS_:
+BU_: ECU
+BO_ 256 Powertrain: 8 ECU
+ SG_ EngineSpeed : 0|16@1+ (1,0) [0|8000] "rpm" ECU
+ SG_ OilPressure : 16|16@1+ (0.1,0) [0|400] "kPa" ECU
+ SG_ Overflowing : 56|16@1+ (1,0) [0|100] "" ECU
+BO_ 257 Battery: 2 ECU
+ SG_ BatteryVoltage : 0|16@1+ (0.01,0) [0|65.535] "V" ECU
+ SG_ Unpublished : 0|8@1+ (1,0) [0|100] "" ECU
+BA_DEF_ SG_ "VeraMqttTopic" STRING ;
+BA_ "VeraMqttTopic" SG_ 256 EngineSpeed "powertrain/engine-speed";
+BA_ "VeraMqttTopic" SG_ 256 OilPressure "data/powertrain/oil-pressure";
+BA_ "VeraMqttTopic" SG_ 256 Overflowing "data/powertrain/oil-pressure";
+BA_ "VeraMqttTopic" SG_ 257 BatteryVoltage "data/battery/voltage";
+BA_ "VeraWarningHigh" SG_ 256 EngineSpeed 7000;
+BA_ "VeraCriticalHigh" SG_ 256 EngineSpeed 9000;
+BA_ "VeraWarningLow" SG_ 256 OilPressure 150;
+BA_ "VeraCriticalLow" SG_ 256 OilPressure 200;
+BA_ "VeraStaleAfterMs" SG_ 256 OilPressure 50;
+BA_ "VeraCriticalHigh" SG_ 257 BatteryVoltage 65.535;
+BA_ "VeraStaleAfterMs" SG_ 257 Unpublished 1000;
+BA_ "GenMsgCycleTime" BO_ 256 100;
+`
+
+func TestValidateDbc(t *testing.T) {
+	config, err := vera.Parse(strings.NewReader(problematicDBC))
+	require.NoError(t, err)
+	extensions, err := parseSignalExtensions(strings.NewReader(problematicDBC))
+	require.NoError(t, err)
+
+	problems := validateDbc(config, extensions)
+
+	assert.Equal(t, []validationProblem{
+		{Message: "Powertrain", Signal: "EngineSpeed", Topic: "powertrain/engine-speed", Problem: `each topic must start with "data/": powertrain/engine-speed`},
+		{Message: "Powertrain", Signal: "EngineSpeed", Topic: "powertrain/engine-speed", Problem: "critical high threshold 9000 is outside the signal range [0|8000]"},
+		{Message: "Powertrain", Signal: "OilPressure", Topic: "data/powertrain/oil-pressure", Problem: "critical low threshold must not exceed warning low threshold"},
+		{Message: "Powertrain", Signal: "OilPressure", Topic: "data/powertrain/oil-pressure", Problem: "stale policy of 50ms is shorter than the 100ms message cycle time"},
+		{Message: "Powertrain", Signal: "Overflowing", Topic: "data/powertrain/oil-pressure", Problem: "signal ends in byte 9, beyond the 8-byte message"},
+		{Message: "Powertrain", Signal: "Overflowing", Topic: "data/powertrain/oil-pressure", Problem: "topic is also used by Powertrain.OilPressure"},
+		{Message: "Battery", Signal: "Unpublished", Problem: "defines alert metadata but has no MQTT topic"},
+	}, problems, "a threshold at the range limit is inside it")
+}
+
+func TestSignalEndByte(t *testing.T) {
+	tests := []struct {
+		name   string
+		signal vera.Signal
+		want   int
+	}{
+		{name: "Intel within a byte", signal: vera.Signal{StartBit: 0, Length: 8}, want: 0},
+		{name: "Intel across bytes", signal: vera.Signal{StartBit: 4, Length: 8}, want: 1},
+		{name: "Intel last bit", signal: vera.Signal{StartBit: 63, Length: 1}, want: 7},
+		{name: "Motorola within a byte", signal: vera.Signal{StartBit: 7, Length: 8, Endianness: vera.BigEndian}, want: 0},
+		{name: "Motorola across bytes", signal: vera.Signal{StartBit: 7, Length: 16, Endianness: vera.BigEndian}, want: 1},
+		{name: "Motorola in the last byte", signal: vera.Signal{StartBit: 63, Length: 8, Endianness: vera.BigEndian}, want: 7},
+		{name: "Motorola past the end", signal: vera.Signal{StartBit: 59, Length: 8, Endianness: vera.BigEndian}, want: 8},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, signalEndByte(test.signal))
+		})
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	directory := t.TempDir()
+	problematic := filepath.Join(directory, "problematic.dbc")
+	require.NoError(t, os.WriteFile(problematic, []byte(problematicDBC), 0o600))
+	valid := filepath.Join(directory, "valid.dbc")
+	require.NoError(t, os.WriteFile(valid, []byte(validDBC), 0o600))
+	// Generation would fall back to this example; validate must not.
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "config.example.dbc"), []byte(validDBC), 0o600))
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{name: "valid", args: []string{"--dbc-file", valid}, wantCode: 0, wantStdout: valid + " follows the Ephoros conventions\n"},
+		{name: "problems", args: []string{"--dbc-file", problematic}, wantCode: 1, wantStdout: "Battery.Unpublished: defines alert metadata but has no MQTT topic\n7 problems in " + problematic + "\n"},
+		{name: "unknown format", args: []string{"--dbc-file", valid, "--format", "yaml"}, wantCode: 2, wantStderr: `unknown format "yaml"`},
+		{name: "missing file", args: []string{"--dbc-file", filepath.Join(directory, "missing.dbc")}, wantCode: 2, wantStderr: "error while opening DBC file"},
+		{name: "missing config dbc", args: []string{"--dbc-file", filepath.Join(directory, "config.dbc")}, wantCode: 2, wantStderr: "error while opening DBC file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			code := runValidate(test.args, &stdout, &stderr)
+
+			assert.Equal(t, test.wantCode, code)
+			assert.True(t, strings.HasSuffix(stdout.String(), test.wantStdout), stdout.String())
+			assert.Contains(t, stderr.String(), test.wantStderr)
+		})
+	}
+}
+
+func TestRunValidateJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "problematic.dbc")
+	require.NoError(t, os.WriteFile(path, []byte(problematicDBC), 0o600))
+	var stdout, stderr bytes.Buffer
+
+	code := runValidate([]string{"--dbc-file", path, "--format", "json"}, &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	var report validationReport
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.False(t, report.Valid)
+	assert.Equal(t, path, report.DBCFile)
+	assert.Len(t, report.Problems, 7)
+	assert.Contains(t, stdout.String(), `"problem": "stale policy of 50ms is shorter than the 100ms message cycle time"`)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ApexCorse/vera"
+)
+
+const (
+	// warningStatesAttribute and criticalStatesAttribute list, comma separated,
+	// the states of an enumerated signal that raise an alert, by label or raw
+	// value: BA_ "EphorosCriticalStates" SG_ 258 DrsState "FAULT";
+	warningStatesAttribute  = "EphorosWarningStates"
+	criticalStatesAttribute = "EphorosCriticalStates"
+	// cycleTimeAttribute is the message cycle time in milliseconds, as the
+	// simulator reads it by default.
+	cycleTimeAttribute = "GenMsgCycleTime"
+)
+
+// SignalState is one labelled value of an enumerated or boolean signal, at
+// its physical value, which is what MQTT and InfluxDB carry.
+type SignalState struct {
+	Value float64
+	Label string
+}
+
+// rawState is one VAL_ description, at the raw value the DBC declares it for.
+type rawState struct {
+	value int64
+	label string
+}
+
+type signalKey struct {
+	messageID uint32
+	signal    string
+}
+
+// dbcSignalExtensions holds what the generator reads from the DBC beside
+// Vera: VAL_ value descriptions, the state alert attributes and message
+// cycle times.
+type dbcSignalExtensions struct {
+	valueTables    map[signalKey][]rawState
+	warningStates  map[signalKey]string
+	criticalStates map[signalKey]string
+	cycleTimesMs   map[uint32]float64
+}
+
+func parseSignalExtensions(r io.Reader) (dbcSignalExtensions, error) {
+	extensions := dbcSignalExtensions{
+		valueTables:    make(map[signalKey][]rawState),
+		warningStates:  make(map[signalKey]string),
+		criticalStates: make(map[signalKey]string),
+		cycleTimesMs:   make(map[uint32]float64),
+	}
+	cycleTimePrefix := "BA_ " + strconv.Quote(cycleTimeAttribute) + " BO_ "
+	attributes := map[string]map[signalKey]string{
+		warningStatesAttribute:  extensions.warningStates,
+		criticalStatesAttribute: extensions.criticalStates,
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(line, "VAL_ "); ok {
+			key, states, ok, err := parseValueDescription(rest)
+			if err != nil {
+				return dbcSignalExtensions{}, fmt.Errorf("malformed value description: %s: %w", line, err)
+			}
+			if ok {
+				extensions.valueTables[key] = states
+			}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, cycleTimePrefix); ok {
+			fields := strings.Fields(strings.TrimSuffix(rest, ";"))
+			if len(fields) != 2 {
+				return dbcSignalExtensions{}, fmt.Errorf("malformed %s assignment: %s", cycleTimeAttribute, line)
+			}
+			id, err := strconv.ParseUint(fields[0], 10, 32)
+			if err != nil {
+				return dbcSignalExtensions{}, fmt.Errorf("malformed message ID in %s assignment: %s", cycleTimeAttribute, line)
+			}
+			milliseconds, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil || milliseconds < 0 {
+				return dbcSignalExtensions{}, fmt.Errorf("%s for message %d must be a non-negative number of milliseconds: %q", cycleTimeAttribute, id, fields[1])
+			}
+			extensions.cycleTimesMs[uint32(id)] = milliseconds
+			continue
+		}
+		for attribute, values := range attributes {
+			rest, ok := strings.CutPrefix(line, "BA_ "+strconv.Quote(attribute)+" SG_ ")
+			if !ok {
+				continue
+			}
+			fields := strings.SplitN(strings.TrimSuffix(rest, ";"), " ", 3)
+			if len(fields) != 3 {
+				return dbcSignalExtensions{}, fmt.Errorf("malformed %s assignment: %s", attribute, line)
+			}
+			id, err := strconv.ParseUint(fields[0], 10, 32)
+			if err != nil {
+				return dbcSignalExtensions{}, fmt.Errorf("malformed message ID in %s assignment: %s", attribute, line)
+			}
+			values[signalKey{messageID: uint32(id), signal: fields[1]}] = strings.Trim(strings.TrimSpace(fields[2]), `"`)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return dbcSignalExtensions{}, fmt.Errorf("read DBC file: %w", err)
+	}
+
+	return extensions, nil
+}
+
+// parseValueDescription parses `<message id> <signal> <value> "<label>" ...;`.
+// Descriptions of environment variables have no message ID and are skipped.
+func parseValueDescription(description string) (signalKey, []rawState, bool, error) {
+	fields := strings.Fields(description)
+	if len(fields) < 2 {
+		return signalKey{}, nil, false, fmt.Errorf("missing signal")
+	}
+	id, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return signalKey{}, nil, false, nil
+	}
+	key := signalKey{messageID: uint32(id), signal: fields[1]}
+
+	rest := strings.TrimSpace(description)
+	rest = strings.TrimSpace(rest[len(fields[0]):])
+	rest = strings.TrimSpace(rest[len(fields[1]):])
+	rest = strings.TrimSpace(strings.TrimSuffix(rest, ";"))
+	var states []rawState
+	for rest != "" {
+		valueText, after, ok := strings.Cut(rest, " ")
+		if !ok {
+			return signalKey{}, nil, false, fmt.Errorf("value %s has no label", valueText)
+		}
+		value, err := strconv.ParseInt(valueText, 10, 64)
+		if err != nil {
+			return signalKey{}, nil, false, fmt.Errorf("value must be an integer: %s", valueText)
+		}
+		after = strings.TrimSpace(after)
+		if !strings.HasPrefix(after, `"`) {
+			return signalKey{}, nil, false, fmt.Errorf("label of value %d must be quoted", value)
+		}
+		label, remaining, ok := strings.Cut(after[1:], `"`)
+		if !ok {
+			return signalKey{}, nil, false, fmt.Errorf("label of value %d is not terminated", value)
+		}
+		states = append(states, rawState{value: value, label: label})
+		rest = strings.TrimSpace(remaining)
+	}
+	return key, states, true, nil
+}
+
+// signalStates returns the labelled states of an enumerated signal, or Off and
+// On for a 1-bit signal without a value table. Other signals have none.
+func signalStates(signal vera.Signal, table []rawState) []SignalState {
+	if len(table) == 0 && signal.Length == 1 {
+		table = []rawState{{value: 0, label: "Off"}, {value: 1, label: "On"}}
+	}
+	if len(table) == 0 {
+		return nil
+	}
+
+	factor, offset := dbcFloat(signal.Factor), dbcFloat(signal.Offset)
+	states := make([]SignalState, 0, len(table))
+	for _, state := range table {
+		states = append(states, SignalState{Value: float64(state.value)*factor + offset, Label: state.label})
+	}
+	return states
+}
+
+// resolveStates turns a state attribute into physical values. States are
+// named by label, case-insensitively, or by raw value.
+func resolveStates(list string, signal vera.Signal, states []SignalState) ([]float64, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	if len(states) == 0 {
+		return nil, fmt.Errorf("only enumerated and 1-bit signals can alert on states")
+	}
+
+	factor, offset := dbcFloat(signal.Factor), dbcFloat(signal.Offset)
+	var values []float64
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, state := range states {
+			raw, err := strconv.ParseInt(name, 10, 64)
+			if strings.EqualFold(state.Label, name) || (err == nil && float64(raw)*factor+offset == state.Value) {
+				values = append(values, state.Value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown state %q", name)
+		}
+	}
+	return values, nil
+}
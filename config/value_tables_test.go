@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ApexCorse/vera"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSignalExtensions(t *testing.T) {
+	dbc := `BO_ 258 VehicleDynamics: 8 ECU
+ SG_ DrsState : 40|2@1+ (1,0) [0|2] "" DASH
+ SG_ Gear : 42|4@1+ (1,0) [0|8] "" DASH
+BA_DEF_ SG_ "EphorosCriticalStates" STRING ;
+BA_ "EphorosCriticalStates" SG_ 258 DrsState "DRS FAULT";
+BA_ "EphorosWarningStates" SG_ 258 Gear "0, 8";
+VAL_ 258 DrsState 0 "DRS CLOSED" 1 "DRS OPEN" 2 "DRS FAULT" ;
+VAL_ 258 Gear 0 "Neutral" 1 "Gear 1";
+VAL_ IgnitionEnv 0 "Off" 1 "On" ;
+BA_ "GenMsgCycleTime" BO_ 258 20;
+`
+
+	extensions, err := parseSignalExtensions(strings.NewReader(dbc))
+
+	require.NoError(t, err)
+	drs := signalKey{messageID: 258, signal: "DrsState"}
+	gear := signalKey{messageID: 258, signal: "Gear"}
+	assert.Equal(t, map[signalKey][]rawState{
+		drs:  {{0, "DRS CLOSED"}, {1, "DRS OPEN"}, {2, "DRS FAULT"}},
+		gear: {{0, "Neutral"}, {1, "Gear 1"}},
+	}, extensions.valueTables, "environment variable descriptions are skipped")
+	assert.Equal(t, map[signalKey]string{drs: "DRS FAULT"}, extensions.criticalStates)
+	assert.Equal(t, map[signalKey]string{gear: "0, 8"}, extensions.warningStates)
+	assert.Equal(t, map[uint32]float64{258: 20}, extensions.cycleTimesMs)
+}
+
+func TestParseSignalExtensionsRejectsMalformedLines(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{name: "value without label", line: `VAL_ 258 DrsState 0 "Closed" 1 ;`, want: "has no label"},
+		{name: "unquoted label", line: `VAL_ 258 DrsState 0 Closed ;`, want: "must be quoted"},
+		{name: "unterminated label", line: `VAL_ 258 DrsState 0 "Closed ;`, want: "is not terminated"},
+		{name: "fractional value", line: `VAL_ 258 DrsState 0.5 "Half" ;`, want: "must be an integer"},
+		{name: "malformed attribute", line: `BA_ "EphorosWarningStates" SG_ 258;`, want: "malformed EphorosWarningStates assignment"},
+		{name: "negative cycle time", line: `BA_ "GenMsgCycleTime" BO_ 258 -1;`, want: "must be a non-negative number of milliseconds"},
+		{name: "malformed attribute ID", line: `BA_ "EphorosWarningStates" SG_ x DrsState "1";`, want: "malformed message ID"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseSignalExtensions(strings.NewReader(test.line))
+			require.ErrorContains(t, err, test.want)
+		})
+	}
+}
+
+func TestSignalStatesAreScaled(t *testing.T) {
+	signal := vera.Signal{Length: 4, Factor: 0.5, Offset: -1}
+
+	states := signalStates(signal, []rawState{{0, "Low"}, {4, "High"}})
+	values, err := resolveStates("high, 0", signal, states)
+
+	require.NoError(t, err)
+	assert.Equal(t, []SignalState{{-1, "Low"}, {1, "High"}}, states)
+	assert.Equal(t, []float64{1, -1}, values, "labels and raw values both resolve to physical values")
+}
@@ -0,0 +1,88 @@
+// Package schema describes how decoded CAN signals are stored in InfluxDB. The
+// simulator writes points with it and the config generator queries them with
+// it, so the two always agree on the measurement, field and tag names.
+package schema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Measurement holds every decoded CAN signal sample.
+	Measurement = "can_signal"
+	// Field holds the physical value of the sample.
+	Field = "value"
+
+	TagMessage   = "message"
+	TagMessageID = "message_id"
+	TagName      = "name"
+	TagTopic     = "topic"
+	TagUnit      = "unit"
+)
+
+// extendedFrameFlag marks extended CAN IDs in DBC files and is not part of the
+// identifier on the bus.
+const extendedFrameFlag = 0x80000000
+
+// Tags identifies the signal a point belongs to. Empty tags are omitted from
+// the point, as line protocol does not allow empty tag values.
+type Tags struct {
+	Topic     string
+	Name      string
+	Unit      string
+	Message   string
+	MessageID string
+}
+
+// FormatMessageID renders a DBC message ID the way it is tagged, for example
+// 0x18FF00FA, dropping the DBC extended frame flag.
+func FormatMessageID(id uint32) string {
+	return fmt.Sprintf("0x%X", id&^extendedFrameFlag)
+}
+
+// Line renders one newline-terminated line of line protocol with the tags
+// sorted by key, as InfluxDB recommends.
+func Line(tags Tags, value float64, timestamp time.Time) string {
+	var line strings.Builder
+	line.WriteString(Measurement)
+	for _, tag := range []struct{ key, value string }{
+		{TagMessage, tags.Message},
+		{TagMessageID, tags.MessageID},
+		{TagName, tags.Name},
+		{TagTopic, tags.Topic},
+		{TagUnit, tags.Unit},
+	} {
+		if tag.value == "" {
+			continue
+		}
+		line.WriteString(",")
+		line.WriteString(tag.key)
+		line.WriteString("=")
+		line.WriteString(EscapeTag(tag.value))
+	}
+	line.WriteString(" ")
+	line.WriteString(Field)
+	line.WriteString("=")
+	line.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	line.WriteString(" ")
+	line.WriteString(strconv.FormatInt(timestamp.UnixNano(), 10))
+	line.WriteString("\n")
+	return line.String()
+}
+
+// EscapeTag escapes a tag value for line protocol.
+func EscapeTag(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", ",", "\\,", "=", "\\=", " ", "\\ ")
+	return replacer.Replace(value)
+}
+
+// FluxTopicFilter returns the Flux pipeline stages that select the values
+// stored for topic.
+func FluxTopicFilter(topic string) string {
+	return fmt.Sprintf(`|> filter(fn: (r) => r["_measurement"] == %q)
+  |> filter(fn: (r) => r["_field"] == %q)
+  |> filter(fn: (r) => r[%q] == %q)`, Measurement, Field, TagTopic, topic)
+}
@@ -0,0 +1,72 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLine(t *testing.T) {
+	timestamp := time.Date(2026, 8, 10, 12, 30, 0, 123456789, time.UTC)
+	tests := []struct {
+		name  string
+		tags  Tags
+		value float64
+		want  string
+	}{
+		{
+			name:  "all tags sorted by key",
+			tags:  Tags{Topic: "data/battery/voltage", Name: "PackVoltage", Unit: "V", Message: "Battery", MessageID: "0x100"},
+			value: 12.5,
+			want:  "can_signal,message=Battery,message_id=0x100,name=PackVoltage,topic=data/battery/voltage,unit=V value=12.5 1786365000123456789\n",
+		},
+		{
+			name:  "empty tags are omitted",
+			tags:  Tags{Topic: "data/speed"},
+			value: -3,
+			want:  "can_signal,topic=data/speed value=-3 1786365000123456789\n",
+		},
+		{
+			name:  "tag values are escaped",
+			tags:  Tags{Topic: `data/battery voltage,primary=main\bus`, Unit: "°C"},
+			value: 0.1,
+			want:  "can_signal,topic=data/battery\\ voltage\\,primary\\=main\\\\bus,unit=°C value=0.1 1786365000123456789\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Line(tt.tags, tt.value, timestamp))
+		})
+	}
+}
+
+func TestFormatMessageID(t *testing.T) {
+	assert.Equal(t, "0x100", FormatMessageID(256))
+	assert.Equal(t, "0x18FF00FA", FormatMessageID(0x18FF00FA|extendedFrameFlag))
+}
+
+func TestEscapeTag(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "plain", value: "vehicle/speed", want: "vehicle/speed"},
+		{name: "reserved characters", value: `a,b=c d\e`, want: `a\,b\=c\ d\\e`},
+		{name: "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, EscapeTag(tt.value))
+		})
+	}
+}
+
+func TestFluxTopicFilter(t *testing.T) {
+	assert.Equal(t, `|> filter(fn: (r) => r["_measurement"] == "can_signal")
+  |> filter(fn: (r) => r["_field"] == "value")
+  |> filter(fn: (r) => r["topic"] == "data/speed")`, FluxTopicFilter("data/speed"))
+}
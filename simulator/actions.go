@@ -3,22 +3,118 @@ package main
 import (
 	"context"
 	"errors"
+	"math"
+	"slices"
+	"time"
 
 	"github.com/eclipse/paho.golang/paho"
 )
 
-func (c *MQTTClient) Publish(ctx context.Context, topic string, payload []byte) error {
+// PublishOptions control how a message is published. The MQTTClientBuilder
+// sets the defaults of a client; PublishOption values adjust them per publish.
+type PublishOptions struct {
+	QoS    byte `json:"qos,omitempty"`
+	Retain bool `json:"retain,omitempty"`
+	// MessageExpiry asks the broker to drop the message, including a retained
+	// one, once it is older than this. It is sent in whole seconds.
+	MessageExpiry  time.Duration       `json:"message_expiry,omitempty"`
+	ContentType    string              `json:"content_type,omitempty"`
+	UserProperties paho.UserProperties `json:"user_properties,omitempty"`
+}
+
+type PublishOption func(*PublishOptions)
+
+func WithQoS(qos byte) PublishOption {
+	return func(o *PublishOptions) { o.QoS = qos }
+}
+
+func WithRetain(retain bool) PublishOption {
+	return func(o *PublishOptions) { o.Retain = retain }
+}
+
+func WithMessageExpiry(expiry time.Duration) PublishOption {
+	return func(o *PublishOptions) { o.MessageExpiry = expiry }
+}
+
+func WithUserProperty(key string, value string) PublishOption {
+	return func(o *PublishOptions) {
+		o.UserProperties = append(o.UserProperties, paho.UserProperty{Key: key, Value: value})
+	}
+}
+
+// withPublishOptions applies the fields set in overrides: non-zero values
+// replace the current ones and user properties are added.
+func withPublishOptions(overrides PublishOptions) PublishOption {
+	return func(o *PublishOptions) {
+		if overrides.QoS != 0 {
+			o.QoS = overrides.QoS
+		}
+		if overrides.Retain {
+			o.Retain = true
+		}
+		if overrides.MessageExpiry != 0 {
+			o.MessageExpiry = overrides.MessageExpiry
+		}
+		if overrides.ContentType != "" {
+			o.ContentType = overrides.ContentType
+		}
+		o.UserProperties = append(o.UserProperties, overrides.UserProperties...)
+	}
+}
+
+// resolvePublishOptions applies options on top of base without modifying it.
+func resolvePublishOptions(base PublishOptions, options []PublishOption) PublishOptions {
+	resolved := base
+	resolved.UserProperties = slices.Clone(base.UserProperties)
+	for _, option := range options {
+		option(&resolved)
+	}
+	return resolved
+}
+
+func (o PublishOptions) validate() error {
+	if o.QoS > 2 {
+		return errors.New("QoS must be 0, 1 or 2")
+	}
+	if o.MessageExpiry < 0 {
+		return errors.New("message expiry cannot be negative")
+	}
+	return nil
+}
+
+func (o PublishOptions) properties() *paho.PublishProperties {
+	properties := &paho.PublishProperties{
+		ContentType: o.ContentType,
+		User:        o.UserProperties,
+	}
+	if o.MessageExpiry > 0 {
+		// Round up, so a sub-second expiry does not become "never expires".
+		seconds := uint32(min(math.Ceil(o.MessageExpiry.Seconds()), math.MaxUint32))
+		properties.MessageExpiry = &seconds
+	}
+	return properties
+}
+
+func (c *MQTTClient) Publish(ctx context.Context, topic string, payload []byte, options ...PublishOption) error {
 	if topic == "" {
-		return errors.New("topic cannot be empty")
+		return permanent(errors.New("topic cannot be empty"))
 	}
 
 	if len(payload) == 0 {
-		return errors.New("payload cannot be empty")
+		return permanent(errors.New("payload cannot be empty"))
+	}
+
+	resolved := resolvePublishOptions(c.defaults, options)
+	if err := resolved.validate(); err != nil {
+		return permanent(err)
 	}
 
 	p := &paho.Publish{
-		Topic:   topic,
-		Payload: payload,
+		QoS:        resolved.QoS,
+		Retain:     resolved.Retain,
+		Topic:      topic,
+		Payload:    payload,
+		Properties: resolved.properties(),
 	}
 
 	if _, err := c.c.Publish(ctx, p); err != nil {
@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/eclipse/paho.golang/paho"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMQTTClientPublishValidation(t *testing.T) {
@@ -12,20 +15,88 @@ func TestMQTTClientPublishValidation(t *testing.T) {
 		name    string
 		topic   string
 		payload []byte
+		options []PublishOption
 		wantErr string
 	}{
 		{name: "empty topic", payload: []byte("payload"), wantErr: "topic cannot be empty"},
 		{name: "nil payload", topic: "telemetry/speed", wantErr: "payload cannot be empty"},
 		{name: "empty payload", topic: "telemetry/speed", payload: []byte{}, wantErr: "payload cannot be empty"},
+		{name: "invalid QoS", topic: "telemetry/speed", payload: []byte("payload"), options: []PublishOption{WithQoS(3)}, wantErr: "QoS must be 0, 1 or 2"},
+		{name: "negative expiry", topic: "telemetry/speed", payload: []byte("payload"), options: []PublishOption{WithMessageExpiry(-time.Second)}, wantErr: "message expiry cannot be negative"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			client := NewMQTTClient(nil)
 
-			err := client.Publish(context.Background(), tt.topic, tt.payload)
+			err := client.Publish(context.Background(), tt.topic, tt.payload, tt.options...)
 
 			assert.EqualError(t, err, tt.wantErr)
+			assert.False(t, isRetryable(err), "invalid publishes are not retried")
+		})
+	}
+}
+
+func TestResolvePublishOptions(t *testing.T) {
+	base := PublishOptions{
+		ContentType:    "application/json",
+		UserProperties: paho.UserProperties{{Key: "encoding", Value: "json"}},
+	}
+
+	got := resolvePublishOptions(base, []PublishOption{
+		WithQoS(1),
+		WithRetain(true),
+		WithMessageExpiry(time.Minute),
+		WithUserProperty("unit", "rpm"),
+	})
+
+	assert.Equal(t, PublishOptions{
+		QoS:            1,
+		Retain:         true,
+		MessageExpiry:  time.Minute,
+		ContentType:    "application/json",
+		UserProperties: paho.UserProperties{{Key: "encoding", Value: "json"}, {Key: "unit", Value: "rpm"}},
+	}, got)
+	assert.Len(t, base.UserProperties, 1, "the defaults are not modified")
+}
+
+func TestWithPublishOptions(t *testing.T) {
+	defaults := PublishOptions{QoS: 1, ContentType: "application/cbor", UserProperties: paho.UserProperties{{Key: "encoding", Value: "cbor"}}}
+	overlay := resolvePublishOptions(PublishOptions{}, []PublishOption{WithRetain(true), WithUserProperty("signal", "EngineSpeed")})
+
+	got := resolvePublishOptions(defaults, []PublishOption{withPublishOptions(overlay)})
+
+	assert.Equal(t, PublishOptions{
+		QoS:            1,
+		Retain:         true,
+		ContentType:    "application/cbor",
+		UserProperties: paho.UserProperties{{Key: "encoding", Value: "cbor"}, {Key: "signal", Value: "EngineSpeed"}},
+	}, got)
+}
+
+func TestPublishOptionsProperties(t *testing.T) {
+	tests := []struct {
+		name   string
+		expiry time.Duration
+		want   uint32
+	}{
+		{name: "no expiry"},
+		{name: "whole seconds", expiry: time.Minute, want: 60},
+		{name: "rounds up", expiry: 1500 * time.Millisecond, want: 2},
+		{name: "sub-second", expiry: time.Millisecond, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			properties := PublishOptions{MessageExpiry: tt.expiry, ContentType: "application/json"}.properties()
+
+			assert.Equal(t, "application/json", properties.ContentType)
+			if tt.want == 0 {
+				assert.Nil(t, properties.MessageExpiry, "no expiry keeps the message until it is replaced")
+				return
+			}
+			require.NotNil(t, properties.MessageExpiry)
+			assert.Equal(t, tt.want, *properties.MessageExpiry)
 		})
 	}
 }
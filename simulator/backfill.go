@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultBackfillRate = 1
+
+// BackfillOptions configures a backfill: points for every topic with
+// timestamps between From and To, Rate per topic per second. A zero Rate
+// keeps the DBC cycle times.
+type BackfillOptions struct {
+	From time.Time
+	To   time.Time
+	Rate float64
+}
+
+// parseBackfillOptions validates the backfill flags. from and to are RFC 3339
+// times or durations before now, such as 24h; an empty to is now.
+func parseBackfillOptions(from string, to string, rate string, now time.Time) (BackfillOptions, error) {
+	options := BackfillOptions{To: now, Rate: defaultBackfillRate}
+
+	var err error
+	if options.From, err = parseBackfillTime(from, now); err != nil {
+		return BackfillOptions{}, fmt.Errorf("backfill start: %w", err)
+	}
+	if to != "" {
+		if options.To, err = parseBackfillTime(to, now); err != nil {
+			return BackfillOptions{}, fmt.Errorf("backfill end: %w", err)
+		}
+	}
+	if !options.From.Before(options.To) {
+		return BackfillOptions{}, errors.New("backfill start must be before its end")
+	}
+	if rate != "" {
+		if options.Rate, err = strconv.ParseFloat(rate, 64); err != nil || options.Rate < 0 || math.IsInf(options.Rate, 0) {
+			return BackfillOptions{}, errors.New("backfill rate must be a non-negative number of points per topic per second")
+		}
+	}
+
+	return options, nil
+}
+
+func parseBackfillTime(value string, now time.Time) (time.Time, error) {
+	if ago, err := time.ParseDuration(value); err == nil && ago >= 0 {
+		return now.Add(-ago), nil
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration before now", value)
+	}
+	return timestamp, nil
+}
+
+// messages copies messages with every cycle time set to reach Rate.
+func (o BackfillOptions) messages(messages []SimulatedMessage) []SimulatedMessage {
+	if o.Rate == 0 {
+		return messages
+	}
+	backfill := make([]SimulatedMessage, len(messages))
+	for i, message := range messages {
+		message.CycleTime = max(time.Duration(float64(time.Second)/o.Rate), time.Microsecond)
+		backfill[i] = message
+	}
+	return backfill
+}
+
+// runBackfill writes points for every signal of messages from options.From to
+// options.To to writer, on a simulated clock and without touching MQTT. It
+// returns the number of points written.
+func runBackfill(ctx context.Context, options BackfillOptions, messages []SimulatedMessage, scenario *Scenario, rng *rand.Rand, encoding PayloadEncoding, writer PointWriter) (int, error) {
+	clock := newSimulatedClock(options.From)
+	var player *ScenarioPlayer
+	if scenario != nil {
+		player = NewScenarioPlayer(scenario, options.From, rng)
+	}
+
+	span := options.To.Sub(options.From)
+	reported := 0
+	points := 0
+	err := runSimulatedScheduler(ctx, options.messages(messages), clock, span, func(ctx context.Context, message SimulatedMessage, timestamp time.Time) error {
+		for _, value := range simulatedValues(message, timestamp, rng, player, nil) {
+			payload, err := encoding.Encode(SignalSample{Value: value.Value, Time: timestamp, Unit: value.Signal.Unit})
+			if err != nil {
+				return fmt.Errorf("couldn't generate data: %w", err)
+			}
+			if err := writer.Write(ctx, value.Signal, encoding, payload); err != nil {
+				return fmt.Errorf("couldn't write data: %w", err)
+			}
+			points++
+		}
+		if progress := int(10 * timestamp.Sub(options.From) / span); progress > reported {
+			reported = progress
+			log.Printf("[SIMULATOR_BACKFILL] %d%% done, %d points up to %s\n", 10*progress, points, timestamp.Format(time.RFC3339))
+		}
+		return nil
+	})
+	return points, err
+}
+
+// LineProtocolFile writes points as line protocol for `influx write`.
+type LineProtocolFile struct {
+	mu     sync.Mutex
+	writer *bufio.Writer
+}
+
+func NewLineProtocolFile(w io.Writer) *LineProtocolFile {
+	return &LineProtocolFile{writer: bufio.NewWriter(w)}
+}
+
+func (f *LineProtocolFile) Write(_ context.Context, signal SimulatedSignal, encoding PayloadEncoding, payload []byte) error {
+	line, err := influxLine(signal, encoding, payload)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.writer.WriteString(line); err != nil {
+		return fmt.Errorf("write line protocol: %w", err)
+	}
+	return nil
+}
+
+// Flush writes the buffered lines to the underlying writer.
+func (f *LineProtocolFile) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writer.Flush()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ApexCorse/ephoros/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBackfillOptions(t *testing.T) {
+	now := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		rate    string
+		want    BackfillOptions
+		wantErr string
+	}{
+		{
+			name: "last day",
+			from: "24h",
+			want: BackfillOptions{From: now.Add(-24 * time.Hour), To: now, Rate: defaultBackfillRate},
+		},
+		{
+			name: "absolute range",
+			from: "2026-08-01T00:00:00Z", to: "2026-08-02T00:00:00Z", rate: "0.5",
+			want: BackfillOptions{From: time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 8, 2, 0, 0, 0, 0, time.UTC), Rate: 0.5},
+		},
+		{
+			name: "mixed",
+			from: "2026-08-10T06:00:00Z", to: "1h", rate: "0",
+			want: BackfillOptions{From: time.Date(2026, 8, 10, 6, 0, 0, 0, time.UTC), To: now.Add(-time.Hour), Rate: 0},
+		},
+		{name: "malformed start", from: "yesterday", wantErr: `backfill start: "yesterday" is neither an RFC 3339 time nor a duration before now`},
+		{name: "malformed end", from: "2h", to: "later", wantErr: `backfill end: "later" is neither an RFC 3339 time nor a duration before now`},
+		{name: "empty range", from: "1h", to: "2h", wantErr: "backfill start must be before its end"},
+		{name: "negative rate", from: "1h", rate: "-1", wantErr: "backfill rate must be a non-negative number of points per topic per second"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBackfillOptions(tt.from, tt.to, tt.rate, now)
+
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBackfillOptionsMessages(t *testing.T) {
+	messages := outputFixture()
+
+	got := BackfillOptions{Rate: 4}.messages(messages)
+
+	assert.Equal(t, 250*time.Millisecond, got[0].CycleTime)
+	assert.Equal(t, 250*time.Millisecond, got[1].CycleTime)
+	assert.Equal(t, 500*time.Millisecond, messages[1].CycleTime, "the DBC messages are not modified")
+	assert.Equal(t, messages, BackfillOptions{}.messages(messages), "a zero rate keeps the DBC cycle times")
+}
+
+func TestRunBackfillToLineProtocolFile(t *testing.T) {
+	from := time.Date(2026, 8, 10, 0, 0, 0, 0, time.UTC)
+	options := BackfillOptions{From: from, To: from.Add(time.Hour), Rate: 0.1}
+	var output bytes.Buffer
+	file := NewLineProtocolFile(&output)
+
+	points, err := runBackfill(context.Background(), options, outputFixture(), nil, newRand(1), jsonEncoding{}, file)
+
+	require.NoError(t, err)
+	require.NoError(t, file.Flush())
+	// 360 ticks an hour for each of the three topics.
+	assert.Equal(t, 3*360, points)
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	require.Len(t, lines, points)
+	assert.True(t, strings.HasPrefix(lines[0], schema.Measurement+","), lines[0])
+	assert.Contains(t, lines[0], "topic=data/powertrain/engine/speed")
+	assert.True(t, strings.HasSuffix(lines[0], " 1786320010000000000"), "the first point is one period after the start: %s", lines[0])
+	assert.True(t, strings.HasSuffix(lines[len(lines)-1], " 1786323600000000000"), "the last point is at the end: %s", lines[len(lines)-1])
+}
+
+func TestRunBackfillToInfluxDB(t *testing.T) {
+	from := time.Date(2026, 8, 10, 0, 0, 0, 0, time.UTC)
+	options := BackfillOptions{From: from, To: from.Add(10 * time.Minute), Rate: 1}
+	influx := &recordingLineWriter{}
+	writer := NewInfluxBatchWriter(influx, InfluxBatchOptions{BatchSize: 500, FlushInterval: time.Hour})
+
+	points, err := runBackfill(context.Background(), options, outputFixture(), nil, newRand(1), jsonEncoding{}, writer)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close(context.Background()))
+
+	assert.Equal(t, 3*600, points)
+	batches := influx.recorded()
+	assert.Len(t, batches, 4, "points are written in batches of BatchSize")
+	assert.Equal(t, points, strings.Count(strings.Join(batches, ""), "\n"))
+}
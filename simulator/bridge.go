@@ -0,0 +1,169 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// bridgeFilter is the subscription of the bridge, covering every topic
+	// the generated catalog publishes.
+	bridgeFilter = "data/#"
+	// bridgeReportInterval is how often the bridge logs its counters.
+	bridgeReportInterval = time.Minute
+
+	bridgeUnknownTopic = "unknown_topic"
+	bridgeBadPayload   = "bad_payload"
+)
+
+// errUnknownTopic marks publishes on topics the DBC does not define.
+var errUnknownTopic = errors.New("topic is not in the DBC catalog")
+
+// bridgePoint is one validated publish, ready for the InfluxDB writer.
+type bridgePoint struct {
+	Signal   SimulatedSignal
+	Encoding PayloadEncoding
+	Payload  []byte
+}
+
+// InfluxBridge turns MQTT publishes on DBC topics into InfluxDB points, so
+// publishers that only speak MQTT, like the firmware, reach the history
+// panels too.
+type InfluxBridge struct {
+	signals map[string]SimulatedSignal
+	now     func() time.Time
+}
+
+func NewInfluxBridge(messages []SimulatedMessage) *InfluxBridge {
+	bridge := &InfluxBridge{signals: make(map[string]SimulatedSignal), now: time.Now}
+	for _, message := range messages {
+		for _, signal := range message.Signals {
+			bridge.signals[signal.Topic] = signal
+		}
+	}
+	return bridge
+}
+
+// Point validates a publish against the topic catalog and decodes its
+// payload, in the encoding its content type advertises. Payloads without a
+// time are stamped with the time they were received.
+func (b *InfluxBridge) Point(message receivedMessage) (bridgePoint, error) {
+	signal, ok := b.signals[message.Topic]
+	if !ok {
+		return bridgePoint{}, errUnknownTopic
+	}
+	encoding, ok := payloadEncodingByContentType(message.ContentType)
+	if !ok {
+		return bridgePoint{}, fmt.Errorf("unsupported content type %q", message.ContentType)
+	}
+
+	var sample SignalSample
+	var err error
+	if _, ok := encoding.(jsonEncoding); ok {
+		sample, err = decodeFirmwareJSON(message.Payload)
+	} else {
+		sample, err = encoding.Decode(message.Payload)
+	}
+	if err != nil {
+		return bridgePoint{}, fmt.Errorf("decode %s payload: %w", encoding.Name(), err)
+	}
+	if sample.Time.IsZero() {
+		sample.Time = b.now()
+	}
+
+	payload, err := encoding.Encode(sample)
+	if err != nil {
+		return bridgePoint{}, fmt.Errorf("encode %s payload: %w", encoding.Name(), err)
+	}
+	return bridgePoint{Signal: signal, Encoding: encoding, Payload: payload}, nil
+}
+
+// firmwareJSONSample accepts the simulator's JSON payload and the firmware's,
+// which names the time "timestamp" and leaves it out until SNTP has synced.
+type firmwareJSONSample struct {
+	Value     *float64 `json:"value"`
+	Time      string   `json:"time"`
+	Timestamp string   `json:"timestamp"`
+	Unit      string   `json:"unit"`
+}
+
+func decodeFirmwareJSON(payload []byte) (SignalSample, error) {
+	var data firmwareJSONSample
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return SignalSample{}, err
+	}
+	if data.Value == nil {
+		return SignalSample{}, errors.New("missing value")
+	}
+
+	sample := SignalSample{Value: *data.Value, Unit: data.Unit}
+	if text := cmp.Or(data.Time, data.Timestamp); text != "" {
+		timestamp, err := parseTimestamp(text)
+		if err != nil {
+			return SignalSample{}, err
+		}
+		sample.Time = timestamp
+	}
+	return sample, nil
+}
+
+// BridgeStats counts what one bridge run received and wrote.
+type BridgeStats struct {
+	Messages      int
+	Points        int
+	UnknownTopics int
+	BadPayloads   int
+}
+
+// runBridge writes every received publish to writer until ctx is done.
+// Unknown topics and bad payloads are counted and skipped, and logged the
+// first time each topic sends one; a failed write stops the bridge.
+func runBridge(ctx context.Context, received <-chan receivedMessage, bridge *InfluxBridge, writer PointWriter, metrics *Metrics) (BridgeStats, error) {
+	stats := BridgeStats{}
+	warned := make(map[string]bool)
+	report := time.NewTicker(bridgeReportInterval)
+	defer report.Stop()
+	defer func() {
+		log.Printf("[SIMULATOR_BRIDGE] received %d messages (%d unknown topics, %d bad payloads), wrote %d points\n", stats.Messages, stats.UnknownTopics, stats.BadPayloads, stats.Points)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return stats, nil
+		case <-report.C:
+			log.Printf("[SIMULATOR_BRIDGE] received %d messages (%d unknown topics, %d bad payloads), wrote %d points\n", stats.Messages, stats.UnknownTopics, stats.BadPayloads, stats.Points)
+		case message := <-received:
+			stats.Messages++
+			point, err := bridge.Point(message)
+			if err != nil {
+				reason := bridgeBadPayload
+				if errors.Is(err, errUnknownTopic) {
+					reason = bridgeUnknownTopic
+					stats.UnknownTopics++
+				} else {
+					stats.BadPayloads++
+				}
+				metrics.BridgeRejected(reason)
+				if key := reason + " " + message.Topic; !warned[key] {
+					warned[key] = true
+					log.Printf("[SIMULATOR_BRIDGE] skipping %s: %s (reported once per topic)\n", message.Topic, err.Error())
+				}
+				continue
+			}
+
+			if err := writer.Write(ctx, point.Signal, point.Encoding, point.Payload); err != nil {
+				if ctx.Err() != nil {
+					return stats, nil
+				}
+				return stats, fmt.Errorf("write %s: %w", point.Signal.Topic, err)
+			}
+			stats.Points++
+		}
+	}
+}
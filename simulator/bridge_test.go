@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfluxBridgePoint(t *testing.T) {
+	timestamp := time.Date(2026, 8, 10, 12, 30, 0, 0, time.UTC)
+	received := time.Date(2026, 8, 10, 12, 31, 0, 0, time.UTC)
+	bridge := NewInfluxBridge(fanoutFixture())
+	bridge.now = func() time.Time { return received }
+	encode := func(encoding PayloadEncoding, sample SignalSample) []byte {
+		payload, err := encoding.Encode(sample)
+		require.NoError(t, err)
+		return payload
+	}
+
+	tests := []struct {
+		name     string
+		message  receivedMessage
+		wantTime time.Time
+		wantErr  string
+	}{
+		{
+			name:     "JSON without a content type",
+			message:  receivedMessage{Topic: "data/powertrain/engine/speed", Payload: encode(jsonEncoding{}, SignalSample{Value: 4000, Time: timestamp})},
+			wantTime: timestamp,
+		},
+		{
+			name:     "advertised encoding",
+			message:  receivedMessage{Topic: "data/powertrain/engine/speed", ContentType: "application/cbor", Payload: encode(cborEncoding{}, SignalSample{Value: 4000, Time: timestamp})},
+			wantTime: timestamp,
+		},
+		{
+			name:     "firmware timestamp",
+			message:  receivedMessage{Topic: "data/powertrain/engine/speed", Payload: []byte(`{"value":4000,"timestamp":"2026-08-10T12:30:00Z"}`)},
+			wantTime: timestamp,
+		},
+		{
+			name:     "firmware before SNTP sync",
+			message:  receivedMessage{Topic: "data/powertrain/engine/speed", Payload: []byte(`{"value":4000}`)},
+			wantTime: received,
+		},
+		{
+			name:    "unknown topic",
+			message: receivedMessage{Topic: "data/aero/wing", Payload: []byte(`{}`)},
+			wantErr: errUnknownTopic.Error(),
+		},
+		{
+			name:    "unsupported content type",
+			message: receivedMessage{Topic: "data/powertrain/engine/speed", ContentType: "text/plain", Payload: []byte("4000")},
+			wantErr: `unsupported content type "text/plain"`,
+		},
+		{
+			name:    "missing value",
+			message: receivedMessage{Topic: "data/powertrain/engine/speed", Payload: []byte(`{"time":"2026-08-10T12:30:00Z"}`)},
+			wantErr: "missing value",
+		},
+		{
+			name:    "malformed time",
+			message: receivedMessage{Topic: "data/powertrain/engine/speed", Payload: []byte(`{"value":1,"timestamp":"noon"}`)},
+			wantErr: "parse simulated timestamp",
+		},
+		{
+			name:    "malformed payload",
+			message: receivedMessage{Topic: "data/powertrain/engine/speed", Payload: []byte("4000")},
+			wantErr: "decode json payload",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			point, err := bridge.Point(tt.message)
+
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "EngineSpeed", point.Signal.Name)
+			sample, err := point.Encoding.Decode(point.Payload)
+			require.NoError(t, err)
+			assert.Equal(t, 4000.0, sample.Value)
+			assert.True(t, tt.wantTime.Equal(sample.Time), "time %s, want %s", sample.Time, tt.wantTime)
+		})
+	}
+}
+
+func TestRunBridge(t *testing.T) {
+	timestamp := time.Date(2026, 8, 10, 12, 30, 0, 0, time.UTC)
+	payload, err := jsonEncoding{}.Encode(SignalSample{Value: 4000, Time: timestamp})
+	require.NoError(t, err)
+	received := make(chan receivedMessage, 4)
+	received <- receivedMessage{Topic: "data/powertrain/engine/speed", Payload: payload}
+	received <- receivedMessage{Topic: "data/aero/wing", Payload: payload}
+	received <- receivedMessage{Topic: "data/aero/wing", Payload: payload}
+	received <- receivedMessage{Topic: "data/powertrain/engine/speed", Payload: []byte("garbage")}
+	var lines bytes.Buffer
+	file := NewLineProtocolFile(&lines)
+	metrics := NewMetrics()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for len(received) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	stats, err := runBridge(ctx, received, NewInfluxBridge(fanoutFixture()), file, metrics)
+
+	require.NoError(t, err)
+	require.NoError(t, file.Flush())
+	assert.Equal(t, BridgeStats{Messages: 4, Points: 1, UnknownTopics: 2, BadPayloads: 1}, stats)
+	assert.Equal(t, "can_signal,message=Powertrain,message_id=0x100,name=EngineSpeed,topic=data/powertrain/engine/speed,unit=rpm value=4000 1786365000000000000\n", lines.String())
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.bridgeRejected.WithLabelValues(bridgeUnknownTopic)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.bridgeRejected.WithLabelValues(bridgeBadPayload)))
+}
+
+func TestRunBridgeWriteFails(t *testing.T) {
+	payload, err := jsonEncoding{}.Encode(SignalSample{Value: 1, Time: time.Now()})
+	require.NoError(t, err)
+	received := make(chan receivedMessage, 1)
+	received <- receivedMessage{Topic: "data/powertrain/engine/speed", Payload: payload}
+
+	_, err = runBridge(context.Background(), received, NewInfluxBridge(fanoutFixture()), failingPointWriter{err: errors.New("batch writer is closed")}, NewMetrics())
+
+	require.ErrorContains(t, err, "write data/powertrain/engine/speed: batch writer is closed")
+}
+
+type failingPointWriter struct{ err error }
+
+func (w failingPointWriter) Write(context.Context, SimulatedSignal, PayloadEncoding, []byte) error {
+	return w.err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/url"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// EmbeddedBroker is an in-process MQTT v5 broker, so the simulator, Grafana
+// and tests can run the telemetry loop without the EMQX container.
+type EmbeddedBroker struct {
+	server   *mqtt.Server
+	listener *listeners.TCP
+}
+
+// StartEmbeddedBroker serves MQTT on address, such as :1883 or 127.0.0.1:0
+// for any free port. Clients must present username and password when
+// username is set; otherwise every client may connect.
+func StartEmbeddedBroker(address string, username string, password string) (*EmbeddedBroker, error) {
+	server := mqtt.New(&mqtt.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(brokerLogWriter{}, &slog.HandlerOptions{Level: slog.LevelError})),
+	})
+
+	var err error
+	if username == "" {
+		err = server.AddHook(new(auth.AllowHook), nil)
+	} else {
+		err = server.AddHook(new(auth.Hook), &auth.Options{Ledger: &auth.Ledger{
+			Auth: auth.AuthRules{{Username: auth.RString(username), Password: auth.RString(password), Allow: true}},
+		}})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("configure broker authentication: %w", err)
+	}
+
+	listener := listeners.NewTCP(listeners.Config{Type: listeners.TypeTCP, ID: "simulator", Address: address})
+	if err := server.AddListener(listener); err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", address, err)
+	}
+	if err := server.Serve(); err != nil {
+		server.Close()
+		return nil, fmt.Errorf("start broker: %w", err)
+	}
+
+	return &EmbeddedBroker{server: server, listener: listener}, nil
+}
+
+// URL is the address clients connect to. An unspecified listening host, as
+// in :1883, becomes the loopback address.
+func (b *EmbeddedBroker) URL() *url.URL {
+	host, port, err := net.SplitHostPort(b.listener.Address())
+	if err != nil || host == "" || net.ParseIP(host).IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return &url.URL{Scheme: "mqtt", Host: net.JoinHostPort(host, port)}
+}
+
+// Subscribe calls handler with every message published to filter, without
+// a network client, such as to check what the simulator publishes in tests.
+func (b *EmbeddedBroker) Subscribe(filter string, handler func(packets.Packet)) error {
+	err := b.server.Subscribe(filter, 1, func(_ *mqtt.Client, _ packets.Subscription, packet packets.Packet) {
+		handler(packet)
+	})
+	if err != nil {
+		return fmt.Errorf("subscribe to %s: %w", filter, err)
+	}
+	return nil
+}
+
+// Close disconnects every client and stops listening.
+func (b *EmbeddedBroker) Close() error {
+	return b.server.Close()
+}
+
+// brokerLogWriter sends the broker's errors to the standard logger, under
+// the simulator's prefix.
+type brokerLogWriter struct{}
+
+func (brokerLogWriter) Write(p []byte) (int, error) {
+	log.Printf("[SIMULATOR_BROKER] %s", p)
+	return len(p), nil
+}
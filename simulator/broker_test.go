@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedBrokerURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		host    string
+	}{
+		{name: "loopback", address: "127.0.0.1:0", host: "127.0.0.1"},
+		{name: "unspecified host", address: ":0", host: "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker, err := StartEmbeddedBroker(tt.address, "", "")
+			require.NoError(t, err)
+			defer broker.Close()
+
+			brokerURL := broker.URL()
+			assert.Equal(t, "mqtt", brokerURL.Scheme)
+			assert.Equal(t, tt.host, brokerURL.Hostname())
+			assert.NotEqual(t, "0", brokerURL.Port(), "the URL carries the bound port")
+		})
+	}
+}
+
+func TestEmbeddedBrokerPortInUse(t *testing.T) {
+	broker, err := StartEmbeddedBroker("127.0.0.1:0", "", "")
+	require.NoError(t, err)
+	defer broker.Close()
+
+	_, err = StartEmbeddedBroker(broker.URL().Host, "", "")
+	require.Error(t, err)
+}
+
+// TestMQTTClientEndToEnd publishes through a real MQTTClient and checks what
+// reaches the broker, properties included.
+func TestMQTTClientEndToEnd(t *testing.T) {
+	broker, err := StartEmbeddedBroker("127.0.0.1:0", "simulator", "secret")
+	require.NoError(t, err)
+	defer broker.Close()
+
+	received := make(chan packets.Packet, 1)
+	require.NoError(t, broker.Subscribe("data/#", func(packet packets.Packet) {
+		received <- packet
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := NewMQTTClientBuilder(nil).
+		AddServers([]*url.URL{broker.URL()}).
+		AddClientId("simulator-test").
+		AddCredentials("simulator", "secret").
+		AddPayloadEncoding(jsonEncoding{}).
+		AddQoS(1).
+		AddUserProperty("vehicle", "sc24").
+		Build(ctx)
+	require.NoError(t, err)
+	defer client.c.Disconnect(context.Background())
+
+	payload, err := jsonEncoding{}.Encode(SignalSample{Value: 42, Time: time.Unix(1700000000, 0), Unit: "rpm"})
+	require.NoError(t, err)
+	require.NoError(t, client.Publish(ctx, "data/powertrain/engine/speed", payload))
+
+	select {
+	case packet := <-received:
+		assert.Equal(t, "data/powertrain/engine/speed", packet.TopicName)
+		assert.Equal(t, payload, packet.Payload)
+		assert.Equal(t, byte(1), packet.FixedHeader.Qos)
+		assert.Equal(t, jsonEncoding{}.ContentType(), packet.Properties.ContentType)
+		assert.Contains(t, packet.Properties.User, packets.UserProperty{Key: "vehicle", Val: "sc24"})
+		assert.Contains(t, packet.Properties.User, packets.UserProperty{Key: encodingUserProperty, Val: jsonEncoding{}.Name()})
+	case <-ctx.Done():
+		t.Fatal("the publish never reached the broker")
+	}
+}
+
+func TestEmbeddedBrokerRejectsWrongPassword(t *testing.T) {
+	broker, err := StartEmbeddedBroker("127.0.0.1:0", "simulator", "secret")
+	require.NoError(t, err)
+	defer broker.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err = NewMQTTClientBuilder(nil).
+		AddServers([]*url.URL{broker.URL()}).
+		AddClientId("intruder").
+		AddCredentials("simulator", "guess").
+		Build(ctx)
+	require.Error(t, err)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	canLogFormatCandump = "candump"
+	canLogFormatASC     = "asc"
+)
+
+// ReadCANLog loads a candump (.log) or Vector ASCII (.asc) capture. An empty
+// format is inferred from the file extension.
+func ReadCANLog(path string, format string) ([]CANFrame, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".asc":
+			format = canLogFormatASC
+		default:
+			format = canLogFormatCandump
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open CAN log: %w", err)
+	}
+	defer file.Close()
+
+	switch format {
+	case canLogFormatCandump:
+		return parseCandumpLog(file)
+	case canLogFormatASC:
+		return parseASCLog(file)
+	default:
+		return nil, fmt.Errorf("unknown CAN log format %q", format)
+	}
+}
+
+// parseCandumpLog reads `candump -l` lines such as
+// `(1436509052.249713) vcan0 123#DEADBEEF`, CAN FD lines using `##`, and the
+// `candump -ta` listing `(1436509052.249713) vcan0 123 [4] DE AD BE EF`.
+// Remote and error frames are skipped.
+func parseCandumpLog(r io.Reader) ([]CANFrame, error) {
+	frames := make([]CANFrame, 0)
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		frame, ok, err := parseCandumpLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("candump line %d: %w", lineNumber, err)
+		}
+		if ok {
+			frames = append(frames, frame)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read candump log: %w", err)
+	}
+	return frames, nil
+}
+
+func parseCandumpLine(line string) (CANFrame, bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[0], "(") || !strings.HasSuffix(fields[0], ")") {
+		return CANFrame{}, false, fmt.Errorf("expected `(timestamp) interface frame`: %q", line)
+	}
+	timestamp, err := parseEpochSeconds(strings.Trim(fields[0], "()"))
+	if err != nil {
+		return CANFrame{}, false, err
+	}
+
+	var idText string
+	var data []byte
+	if id, payload, found := strings.Cut(fields[2], "#"); found {
+		idText = id
+		if strings.HasPrefix(payload, "#") {
+			// CAN FD: one flags nibble precedes the data.
+			if len(payload) < 2 {
+				return CANFrame{}, false, fmt.Errorf("malformed CAN FD frame %q", fields[2])
+			}
+			payload = payload[2:]
+		}
+		if strings.HasPrefix(payload, "R") {
+			return CANFrame{}, false, nil
+		}
+		data, err = hex.DecodeString(strings.ReplaceAll(payload, ".", ""))
+		if err != nil {
+			return CANFrame{}, false, fmt.Errorf("malformed frame data %q: %w", payload, err)
+		}
+	} else {
+		if len(fields) < 4 || !strings.HasPrefix(fields[3], "[") {
+			return CANFrame{}, false, fmt.Errorf("expected `ID#DATA` or `ID [DLC] DATA`: %q", line)
+		}
+		idText = fields[2]
+		if len(fields) > 4 && strings.EqualFold(fields[4], "remote") {
+			return CANFrame{}, false, nil
+		}
+		data, err = hex.DecodeString(strings.Join(fields[4:], ""))
+		if err != nil {
+			return CANFrame{}, false, fmt.Errorf("malformed frame data in %q: %w", line, err)
+		}
+	}
+
+	id, err := strconv.ParseUint(idText, 16, 32)
+	if err != nil {
+		return CANFrame{}, false, fmt.Errorf("malformed CAN ID %q", idText)
+	}
+	if id&0x20000000 != 0 {
+		// Error frames carry CAN_ERR_FLAG in the identifier.
+		return CANFrame{}, false, nil
+	}
+
+	return CANFrame{Time: timestamp, ID: uint32(id), Extended: len(idText) > 3, Data: data}, true, nil
+}
+
+func parseEpochSeconds(value string) (time.Time, error) {
+	seconds, fraction, _ := strings.Cut(value, ".")
+	whole, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed timestamp %q", value)
+	}
+	var nanoseconds int64
+	if fraction != "" {
+		if len(fraction) > 9 {
+			fraction = fraction[:9]
+		}
+		nanoseconds, err = strconv.ParseInt(fraction+strings.Repeat("0", 9-len(fraction)), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("malformed timestamp %q", value)
+		}
+	}
+	return time.Unix(whole, nanoseconds).UTC(), nil
+}
+
+// ascDateLayouts are the header date formats written by CANalyzer and CANoe.
+var ascDateLayouts = []string{
+	"Mon Jan 2 03:04:05.000 pm 2006",
+	"Mon Jan 2 03:04:05 pm 2006",
+	"Mon Jan 2 15:04:05.000 2006",
+	"Mon Jan 2 15:04:05 2006",
+}
+
+// parseASCLog reads classic CAN data frames from a Vector ASCII log, such as
+// `0.001234 1 18FF00FAx Rx d 8 11 22 33 44 55 66 77 88`. Timestamps are
+// relative to the `date` header; without a readable header they are relative
+// to the Unix epoch and should be replayed with rewritten timestamps.
+func parseASCLog(r io.Reader) ([]CANFrame, error) {
+	frames := make([]CANFrame, 0)
+	base := time.Unix(0, 0).UTC()
+	numberBase := 16
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToLower(fields[0]) {
+		case "date":
+			dateText := strings.Join(fields[1:], " ")
+			for _, layout := range ascDateLayouts {
+				if parsed, err := time.ParseInLocation(layout, dateText, time.Local); err == nil {
+					base = parsed
+					break
+				}
+			}
+			continue
+		case "base":
+			if len(fields) > 1 && strings.EqualFold(fields[1], "dec") {
+				numberBase = 10
+			}
+			continue
+		}
+
+		frame, ok := parseASCLine(fields, base, numberBase)
+		if ok {
+			frames = append(frames, frame)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read ASC log: %w", err)
+	}
+	return frames, nil
+}
+
+// parseASCLine returns false for every line that is not a classic CAN data
+// frame: headers, trigger blocks, remote frames, error frames and statistics.
+func parseASCLine(fields []string, base time.Time, numberBase int) (CANFrame, bool) {
+	if len(fields) < 6 {
+		return CANFrame{}, false
+	}
+	offset, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || math.IsNaN(offset) || offset < 0 {
+		return CANFrame{}, false
+	}
+	if _, err := strconv.Atoi(fields[1]); err != nil {
+		return CANFrame{}, false
+	}
+	if !strings.EqualFold(fields[3], "Rx") && !strings.EqualFold(fields[3], "Tx") {
+		return CANFrame{}, false
+	}
+	if !strings.EqualFold(fields[4], "d") {
+		return CANFrame{}, false
+	}
+
+	idText := fields[2]
+	extended := strings.HasSuffix(strings.ToLower(idText), "x")
+	id, err := strconv.ParseUint(strings.TrimRight(idText, "xX"), numberBase, 32)
+	if err != nil {
+		return CANFrame{}, false
+	}
+	length, err := strconv.ParseUint(fields[5], numberBase, 8)
+	if err != nil || len(fields) < 6+int(length) {
+		return CANFrame{}, false
+	}
+	// `base dec` applies to the data bytes as well as the ID.
+	data := make([]byte, 0, length)
+	for _, field := range fields[6 : 6+length] {
+		value, err := strconv.ParseUint(field, numberBase, 8)
+		if err != nil {
+			return CANFrame{}, false
+		}
+		data = append(data, byte(value))
+	}
+
+	return CANFrame{
+		Time:     base.Add(time.Duration(offset * float64(time.Second))),
+		ID:       uint32(id),
+		Extended: extended,
+		Data:     data,
+	}, true
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCandumpLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		log     string
+		want    []CANFrame
+		wantErr string
+	}{
+		{
+			name: "log and listing formats",
+			log: `(1436509052.249713) vcan0 123#DEADBEEF
+(1436509052.250000) vcan0 18FF00FA#0102
+
+(1436509052.3) can1 1A0##1AABB
+(1436509052.4) vcan0 123#R
+(1436509052.5) vcan0 20000080#0000000000000000
+(1436509052.6) can0 123 [2] 11 22
+(1436509052.7) can0 123 [0] remote request`,
+			want: []CANFrame{
+				{Time: time.Unix(1436509052, 249713000).UTC(), ID: 0x123, Data: []byte{0xDE, 0xAD, 0xBE, 0xEF}},
+				{Time: time.Unix(1436509052, 250000000).UTC(), ID: 0x18FF00FA, Extended: true, Data: []byte{0x01, 0x02}},
+				{Time: time.Unix(1436509052, 300000000).UTC(), ID: 0x1A0, Data: []byte{0xAA, 0xBB}},
+				{Time: time.Unix(1436509052, 600000000).UTC(), ID: 0x123, Data: []byte{0x11, 0x22}},
+			},
+		},
+		{name: "missing timestamp", log: "vcan0 123#00", wantErr: "candump line 1: expected `(timestamp) interface frame`"},
+		{name: "malformed timestamp", log: "(abc) vcan0 123#00", wantErr: `malformed timestamp "abc"`},
+		{name: "malformed data", log: "(1.0) vcan0 123#0G", wantErr: "malformed frame data"},
+		{name: "malformed ID", log: "(1.0) vcan0 XYZ#00", wantErr: `malformed CAN ID "XYZ"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCandumpLog(strings.NewReader(tt.log))
+
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseASCLog(t *testing.T) {
+	asc := `date Wed Jan 5 10:31:25.123 am 2022
+base hex  timestamps absolute
+internal events logged
+Begin Triggerblock Wed Jan 5 10:31:25.123 am 2022
+   0.000000 Start of measurement
+   0.001500 1  123             Rx   d 8 10 27 00 82 00 00 00 00  Length = 0 BitCount = 0 ID = 291
+   0.002000 1  18FF00FAx       Rx   d 2 C8 01
+   0.003000 1  123             Rx   r
+   0.004000 1  ErrorFrame
+End TriggerBlock
+`
+
+	got, err := parseASCLog(strings.NewReader(asc))
+
+	require.NoError(t, err)
+	base := time.Date(2022, time.January, 5, 10, 31, 25, 123000000, time.Local)
+	assert.Equal(t, []CANFrame{
+		{Time: base.Add(1500 * time.Microsecond), ID: 0x123, Data: []byte{0x10, 0x27, 0, 0x82, 0, 0, 0, 0}},
+		{Time: base.Add(2 * time.Millisecond), ID: 0x18FF00FA, Extended: true, Data: []byte{0xC8, 0x01}},
+	}, got)
+}
+
+func TestParseASCLogDecimalBase(t *testing.T) {
+	asc := `date Wed Jan 5 10:31:25.123 am 2022
+base dec  timestamps absolute
+internal events logged
+Begin Triggerblock Wed Jan 5 10:31:25.123 am 2022
+   0.001500 1  291             Rx   d 8 16 39 0 130 0 0 0 0  Length = 0 BitCount = 0 ID = 291
+   0.002000 1  419365114x      Rx   d 2 200 1
+   0.003000 1  291             Rx   d 1 FF
+End TriggerBlock
+`
+
+	got, err := parseASCLog(strings.NewReader(asc))
+
+	require.NoError(t, err)
+	base := time.Date(2022, time.January, 5, 10, 31, 25, 123000000, time.Local)
+	assert.Equal(t, []CANFrame{
+		{Time: base.Add(1500 * time.Microsecond), ID: 0x123, Data: []byte{0x10, 0x27, 0, 0x82, 0, 0, 0, 0}},
+		{Time: base.Add(2 * time.Millisecond), ID: 0x18FF00FA, Extended: true, Data: []byte{0xC8, 0x01}},
+	}, got, "the same frames as the hex log; hex bytes are not valid decimal")
+}
+
+func TestParseASCLogDecimalBaseWithoutDate(t *testing.T) {
+	got, err := parseASCLog(strings.NewReader("base dec timestamps absolute\n1.5 1 291 Rx d 1 255\n"))
+
+	require.NoError(t, err)
+	assert.Equal(t, []CANFrame{{Time: time.Unix(1, 500000000).UTC(), ID: 291, Data: []byte{0xFF}}}, got)
+}
+
+func TestReadCANLog(t *testing.T) {
+	directory := t.TempDir()
+	candumpPath := filepath.Join(directory, "bench.log")
+	ascPath := filepath.Join(directory, "bench.asc")
+	require.NoError(t, os.WriteFile(candumpPath, []byte("(1.0) vcan0 123#01\n"), 0o600))
+	require.NoError(t, os.WriteFile(ascPath, []byte("1.0 1 123 Rx d 1 01\n"), 0o600))
+
+	tests := []struct {
+		name    string
+		path    string
+		format  string
+		wantLen int
+		wantErr string
+	}{
+		{name: "candump by extension", path: candumpPath, wantLen: 1},
+		{name: "asc by extension", path: ascPath, wantLen: 1},
+		{name: "explicit format", path: ascPath, format: canLogFormatCandump, wantErr: "candump line 1"},
+		{name: "unknown format", path: candumpPath, format: "blf", wantErr: `unknown CAN log format "blf"`},
+		{name: "missing file", path: filepath.Join(directory, "missing.log"), wantErr: "open CAN log"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := ReadCANLog(tt.path, tt.format)
+
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, frames, tt.wantLen)
+		})
+	}
+}
@@ -2,18 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"net/url"
+	"time"
 
 	"github.com/eclipse/paho.golang/autopaho"
 	"github.com/eclipse/paho.golang/paho"
 )
 
 type MQTTClient struct {
-	c *autopaho.ConnectionManager
+	c        *autopaho.ConnectionManager
+	defaults PublishOptions
 }
 
 type MQTTClientBuilder struct {
-	cfg *autopaho.ClientConfig
+	cfg      *autopaho.ClientConfig
+	defaults PublishOptions
 }
 
 func NewMQTTClient(c *autopaho.ConnectionManager) *MQTTClient {
@@ -91,7 +95,67 @@ func (b *MQTTClientBuilder) AddOnServerDisconnect(f func(d *paho.Disconnect)) *M
 	return b
 }
 
+// AddTLSConfig sets the TLS configuration used for mqtts://, ssl://, tls://
+// and wss:// server URLs. A nil config keeps the defaults.
+func (b *MQTTClientBuilder) AddTLSConfig(cfg *tls.Config) *MQTTClientBuilder {
+	b.cfg.TlsCfg = cfg
+
+	return b
+}
+
+// AddCredentials sends username and password in the CONNECT packet. Empty
+// values are left out.
+func (b *MQTTClientBuilder) AddCredentials(username string, password string) *MQTTClientBuilder {
+	b.cfg.ConnectUsername = username
+	b.cfg.ConnectPassword = []byte(password)
+
+	return b
+}
+
+// AddPayloadEncoding advertises the encoding of every published payload
+// through the MQTT v5 content type and an "encoding" user property.
+func (b *MQTTClientBuilder) AddPayloadEncoding(encoding PayloadEncoding) *MQTTClientBuilder {
+	b.defaults.ContentType = encoding.ContentType()
+	b.defaults.UserProperties = append(b.defaults.UserProperties, paho.UserProperty{Key: encodingUserProperty, Value: encoding.Name()})
+
+	return b
+}
+
+// AddQoS sets the QoS every publish uses unless it passes WithQoS.
+func (b *MQTTClientBuilder) AddQoS(qos byte) *MQTTClientBuilder {
+	b.defaults.QoS = qos
+
+	return b
+}
+
+// AddRetain makes the broker keep the last message of every topic, so new
+// subscribers get the last known value right away.
+func (b *MQTTClientBuilder) AddRetain(retain bool) *MQTTClientBuilder {
+	b.defaults.Retain = retain
+
+	return b
+}
+
+// AddMessageExpiry sets how long the broker keeps undelivered and retained
+// messages. Zero keeps them indefinitely.
+func (b *MQTTClientBuilder) AddMessageExpiry(expiry time.Duration) *MQTTClientBuilder {
+	b.defaults.MessageExpiry = expiry
+
+	return b
+}
+
+// AddUserProperty adds an MQTT v5 user property to every publish.
+func (b *MQTTClientBuilder) AddUserProperty(key string, value string) *MQTTClientBuilder {
+	b.defaults.UserProperties = append(b.defaults.UserProperties, paho.UserProperty{Key: key, Value: value})
+
+	return b
+}
+
 func (b *MQTTClientBuilder) Build(ctx context.Context) (*MQTTClient, error) {
+	if err := b.defaults.validate(); err != nil {
+		return nil, err
+	}
+
 	cm, err := autopaho.NewConnection(ctx, *b.cfg)
 	if err != nil {
 		return nil, err
@@ -102,5 +166,7 @@ func (b *MQTTClientBuilder) Build(ctx context.Context) (*MQTTClient, error) {
 		return nil, err
 	}
 
-	return NewMQTTClient(cm), nil
+	client := NewMQTTClient(cm)
+	client.defaults = resolvePublishOptions(b.defaults, nil)
+	return client, nil
 }
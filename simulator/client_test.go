@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"io"
+	"net"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/packets"
 	"github.com/eclipse/paho.golang/paho"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -60,6 +65,7 @@ func TestNewMQTTClientBuilder(t *testing.T) {
 func TestMQTTClientBuilderAdders(t *testing.T) {
 	serverURL := &url.URL{Scheme: "tcp", Host: "localhost:1883"}
 	callbackErr := errors.New("callback error")
+	tlsConfig := &tls.Config{ServerName: "broker.test"}
 	tests := []struct {
 		name   string
 		apply  func(*MQTTClientBuilder) *MQTTClientBuilder
@@ -143,6 +149,21 @@ func TestMQTTClientBuilderAdders(t *testing.T) {
 				assert.NotPanics(t, func() { cfg.ClientConfig.OnClientError(callbackErr) })
 			},
 		},
+		{
+			name:  "TLS config",
+			apply: func(b *MQTTClientBuilder) *MQTTClientBuilder { return b.AddTLSConfig(tlsConfig) },
+			assert: func(t *testing.T, cfg *autopaho.ClientConfig) {
+				assert.Same(t, tlsConfig, cfg.TlsCfg)
+			},
+		},
+		{
+			name:  "credentials",
+			apply: func(b *MQTTClientBuilder) *MQTTClientBuilder { return b.AddCredentials("simulator", "s3cret") },
+			assert: func(t *testing.T, cfg *autopaho.ClientConfig) {
+				assert.Equal(t, "simulator", cfg.ConnectUsername)
+				assert.Equal(t, []byte("s3cret"), cfg.ConnectPassword)
+			},
+		},
 		{
 			name: "server disconnect callback",
 			apply: func(b *MQTTClientBuilder) *MQTTClientBuilder {
@@ -168,6 +189,106 @@ func TestMQTTClientBuilderAdders(t *testing.T) {
 	}
 }
 
+func TestMQTTClientBuilderAddPayloadEncoding(t *testing.T) {
+	builder := NewMQTTClientBuilder(nil)
+
+	returned := builder.AddPayloadEncoding(cborEncoding{})
+
+	assert.Same(t, builder, returned)
+	assert.Equal(t, PublishOptions{
+		ContentType:    "application/cbor",
+		UserProperties: paho.UserProperties{{Key: "encoding", Value: "cbor"}},
+	}, builder.defaults)
+}
+
+func TestMQTTClientBuilderPublishDefaults(t *testing.T) {
+	builder := NewMQTTClientBuilder(nil)
+
+	returned := builder.
+		AddQoS(1).
+		AddRetain(true).
+		AddMessageExpiry(5*time.Minute).
+		AddUserProperty("vehicle", "sc24")
+
+	assert.Same(t, builder, returned)
+	assert.Equal(t, PublishOptions{
+		QoS:            1,
+		Retain:         true,
+		MessageExpiry:  5 * time.Minute,
+		UserProperties: paho.UserProperties{{Key: "vehicle", Value: "sc24"}},
+	}, builder.defaults)
+}
+
+// serveMQTTConnect accepts one TLS connection, records its CONNECT packet and
+// accepts it, standing in for a broker that requires mutual TLS.
+func serveMQTTConnect(t *testing.T, listener net.Listener) <-chan *packets.Connect {
+	t.Helper()
+	connects := make(chan *packets.Connect, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		connects <- packet.Content.(*packets.Connect)
+		connack := packets.NewControlPacket(packets.CONNACK)
+		if _, err := connack.WriteTo(conn); err != nil {
+			return
+		}
+		// Hold the connection until the client disconnects.
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+	return connects
+}
+
+func TestMQTTClientBuilderBuildMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", pki.serverConfig())
+	require.NoError(t, err)
+	defer listener.Close()
+	connects := serveMQTTConnect(t, listener)
+	tlsConfig, err := TLSOptions{CAFile: pki.CAFile, CertFile: pki.ClientCertFile, KeyFile: pki.ClientKeyFile, ServerName: "broker.test"}.Config()
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := NewMQTTClientBuilder(nil).
+		AddServers([]*url.URL{{Scheme: "mqtts", Host: listener.Addr().String()}}).
+		AddClientId("simulator").
+		AddTLSConfig(tlsConfig).
+		AddCredentials("simulator", "s3cret").
+		Build(ctx)
+
+	require.NoError(t, err)
+	defer func() { _ = client.c.Disconnect(context.Background()) }()
+	connect := <-connects
+	assert.Equal(t, "simulator", connect.Username)
+	assert.Equal(t, []byte("s3cret"), connect.Password)
+}
+
+func TestMQTTClientBuilderBuildRejectsUntrustedBroker(t *testing.T) {
+	pki := newTestPKI(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", pki.serverConfig())
+	require.NoError(t, err)
+	defer listener.Close()
+	serveMQTTConnect(t, listener)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	// Without the CA bundle the system roots do not trust the broker.
+	client, err := NewMQTTClientBuilder(nil).
+		AddServers([]*url.URL{{Scheme: "mqtts", Host: listener.Addr().String()}}).
+		AddTLSConfig(&tls.Config{ServerName: "broker.test"}).
+		Build(ctx)
+
+	require.Error(t, err)
+	assert.Nil(t, client)
+}
+
 func TestMQTTClientBuilderBuildErrors(t *testing.T) {
 	canceledContext, cancel := context.WithCancel(context.Background())
 	cancel()
@@ -175,9 +296,11 @@ func TestMQTTClientBuilderBuildErrors(t *testing.T) {
 		name    string
 		ctx     context.Context
 		servers []*url.URL
+		qos     byte
 		wantErr string
 	}{
 		{name: "missing servers", ctx: context.Background(), wantErr: "no server urls provided"},
+		{name: "invalid QoS", ctx: context.Background(), qos: 3, wantErr: "QoS must be 0, 1 or 2"},
 		{
 			name:    "connection context canceled",
 			ctx:     canceledContext,
@@ -188,7 +311,7 @@ func TestMQTTClientBuilderBuildErrors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			builder := NewMQTTClientBuilder(nil).AddServers(tt.servers)
+			builder := NewMQTTClientBuilder(nil).AddServers(tt.servers).AddQoS(tt.qos)
 
 			client, err := builder.Build(tt.ctx)
 
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultSimulatedStart is where the simulated clock starts when no start
+// time is given, so file output does not depend on when it was generated.
+var defaultSimulatedStart = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Clock tells the file output what time it is: a simulated clock that only
+// moves when the scheduler advances it. Network runs read time.Now directly.
+type Clock interface {
+	Now() time.Time
+}
+
+// simulatedClock is a Clock set by runSimulatedScheduler to the tick being
+// published.
+type simulatedClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newSimulatedClock(start time.Time) *simulatedClock {
+	return &simulatedClock{now: start}
+}
+
+func (c *simulatedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *simulatedClock) set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
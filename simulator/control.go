@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	minControlRateMultiplier = 0.01
+	maxControlRateMultiplier = 100
+	maxControlDropout        = 24 * time.Hour
+	maxControlRequestBytes   = 4 << 10
+)
+
+// Controller holds the runtime overrides set through the control API: a
+// paused flag, a rate multiplier applied to every cycle time, forced values
+// and dropouts. The publish loop consults it for every signal.
+type Controller struct {
+	signals map[string]SimulatedSignal
+	topics  []string
+	now     func() time.Time
+
+	mu             sync.Mutex
+	paused         bool
+	rateMultiplier float64
+	forced         map[string]float64
+	dropouts       map[string]time.Time
+	// dropoutAll silences every topic until the given time.
+	dropoutAll time.Time
+	// changed is closed, and replaced, when the rate or the paused state
+	// changes, so the schedulers restart their tickers.
+	changed chan struct{}
+}
+
+func NewController(messages []SimulatedMessage) *Controller {
+	controller := &Controller{
+		signals:        make(map[string]SimulatedSignal),
+		now:            time.Now,
+		rateMultiplier: 1,
+		forced:         make(map[string]float64),
+		dropouts:       make(map[string]time.Time),
+		changed:        make(chan struct{}),
+	}
+	for _, message := range messages {
+		for _, signal := range message.Signals {
+			controller.signals[signal.Topic] = signal
+			controller.topics = append(controller.topics, signal.Topic)
+		}
+	}
+	sort.Strings(controller.topics)
+	return controller
+}
+
+// RateMultiplier scales how often messages are published; 2 publishes twice
+// as often as the DBC cycle times.
+func (c *Controller) RateMultiplier() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rateMultiplier
+}
+
+// RateChanged returns a channel closed at the next change of the rate
+// multiplier or of the paused state.
+func (c *Controller) RateChanged() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed
+}
+
+// notifyRateChanged wakes the schedulers. The caller holds c.mu.
+func (c *Controller) notifyRateChanged() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Adjust returns the value to publish for topic, which is the forced value
+// when one is set, or false while publishing is paused or the topic is in a
+// dropout.
+func (c *Controller) Adjust(topic string, value float64) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.paused {
+		return 0, false
+	}
+	now := c.now()
+	if now.Before(c.dropoutAll) {
+		return 0, false
+	}
+	if until, ok := c.dropouts[topic]; ok {
+		if now.Before(until) {
+			return 0, false
+		}
+		delete(c.dropouts, topic)
+	}
+	if forced, ok := c.forced[topic]; ok {
+		return forced, true
+	}
+	return value, true
+}
+
+// Handler serves the control API:
+//
+//	GET    /topics                  list topics with their overrides
+//	GET    /status                  paused flag, rate multiplier and overrides
+//	POST   /pause, /resume          stop or restart publishing
+//	PUT    /rate                    {"multiplier": 2}
+//	PUT    /force/{topic}           {"value": 12.5} publishes a fixed value
+//	DELETE /force/{topic}           returns the topic to simulated values
+//	POST   /dropout[/{topic}]       {"seconds": 5} stops one or every topic
+func (c *Controller) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /topics", c.handleTopics)
+	mux.HandleFunc("GET /status", c.handleStatus)
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) { c.setPaused(w, true) })
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) { c.setPaused(w, false) })
+	mux.HandleFunc("PUT /rate", c.handleRate)
+	mux.HandleFunc("PUT /force/{topic...}", c.handleForce)
+	mux.HandleFunc("DELETE /force/{topic...}", c.handleRelease)
+	mux.HandleFunc("POST /dropout", c.handleDropout)
+	mux.HandleFunc("POST /dropout/{topic...}", c.handleDropout)
+	return mux
+}
+
+// controlTopic is one entry of GET /topics.
+type controlTopic struct {
+	Topic        string     `json:"topic"`
+	Name         string     `json:"name"`
+	Message      string     `json:"message,omitempty"`
+	Unit         string     `json:"unit,omitempty"`
+	Min          float64    `json:"min"`
+	Max          float64    `json:"max"`
+	Forced       *float64   `json:"forced,omitempty"`
+	DropoutUntil *time.Time `json:"dropout_until,omitempty"`
+}
+
+// controlStatus is the body of GET /status and of every successful change.
+type controlStatus struct {
+	Paused         bool                 `json:"paused"`
+	RateMultiplier float64              `json:"rate_multiplier"`
+	Forced         map[string]float64   `json:"forced"`
+	Dropouts       map[string]time.Time `json:"dropouts"`
+	DropoutAll     *time.Time           `json:"dropout_all,omitempty"`
+}
+
+func (c *Controller) handleTopics(w http.ResponseWriter, _ *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	topics := make([]controlTopic, 0, len(c.topics))
+	for _, topic := range c.topics {
+		signal := c.signals[topic]
+		entry := controlTopic{Topic: topic, Name: signal.Name, Message: signal.Message, Unit: signal.Unit, Min: signal.Min, Max: signal.Max}
+		if forced, ok := c.forced[topic]; ok {
+			entry.Forced = &forced
+		}
+		if until, ok := c.dropouts[topic]; ok && now.Before(until) {
+			entry.DropoutUntil = &until
+		}
+		topics = append(topics, entry)
+	}
+	writeJSON(w, http.StatusOK, topics)
+}
+
+func (c *Controller) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeJSON(w, http.StatusOK, c.status())
+}
+
+// status must be called with c.mu held.
+func (c *Controller) status() controlStatus {
+	now := c.now()
+	status := controlStatus{
+		Paused:         c.paused,
+		RateMultiplier: c.rateMultiplier,
+		Forced:         make(map[string]float64, len(c.forced)),
+		Dropouts:       make(map[string]time.Time, len(c.dropouts)),
+	}
+	for topic, value := range c.forced {
+		status.Forced[topic] = value
+	}
+	for topic, until := range c.dropouts {
+		if now.Before(until) {
+			status.Dropouts[topic] = until
+		}
+	}
+	if now.Before(c.dropoutAll) {
+		until := c.dropoutAll
+		status.DropoutAll = &until
+	}
+	return status
+}
+
+func (c *Controller) setPaused(w http.ResponseWriter, paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = paused
+	c.notifyRateChanged()
+	log.Printf("[SIMULATOR_CONTROL] paused: %t\n", paused)
+	writeJSON(w, http.StatusOK, c.status())
+}
+
+func (c *Controller) handleRate(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Multiplier *float64 `json:"multiplier"`
+	}
+	if err := decodeControlRequest(r, &request); err != nil {
+		writeControlError(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.Multiplier == nil || *request.Multiplier < minControlRateMultiplier || *request.Multiplier > maxControlRateMultiplier {
+		writeControlError(w, http.StatusBadRequest, fmt.Errorf("multiplier must be between %g and %g", float64(minControlRateMultiplier), float64(maxControlRateMultiplier)))
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rateMultiplier = *request.Multiplier
+	c.notifyRateChanged()
+	log.Printf("[SIMULATOR_CONTROL] rate multiplier: %g\n", c.rateMultiplier)
+	writeJSON(w, http.StatusOK, c.status())
+}
+
+func (c *Controller) handleForce(w http.ResponseWriter, r *http.Request) {
+	topic, ok := c.topic(w, r)
+	if !ok {
+		return
+	}
+	var request struct {
+		Value *float64 `json:"value"`
+	}
+	if err := decodeControlRequest(r, &request); err != nil {
+		writeControlError(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.Value == nil {
+		writeControlError(w, http.StatusBadRequest, errors.New("value is required"))
+		return
+	}
+	// A forced value goes on the same bus as the simulated ones, so it must
+	// be one the signal can encode.
+	signal := c.signals[topic]
+	rawMin, rawMax := signal.rawRange()
+	raw := math.Round((*request.Value - signal.Offset) / signal.factor())
+	if raw < float64(rawMin) || raw > float64(rawMax) {
+		low, high := signal.physical(rawMin), signal.physical(rawMax)
+		if low > high {
+			low, high = high, low
+		}
+		writeControlError(w, http.StatusBadRequest, fmt.Errorf("value %g is outside the signal range [%g|%g]", *request.Value, low, high))
+		return
+	}
+	value := signal.quantize(*request.Value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forced[topic] = value
+	log.Printf("[SIMULATOR_CONTROL] forcing %s to %g\n", topic, value)
+	writeJSON(w, http.StatusOK, c.status())
+}
+
+func (c *Controller) handleRelease(w http.ResponseWriter, r *http.Request) {
+	topic, ok := c.topic(w, r)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.forced, topic)
+	log.Printf("[SIMULATOR_CONTROL] released %s\n", topic)
+	writeJSON(w, http.StatusOK, c.status())
+}
+
+func (c *Controller) handleDropout(w http.ResponseWriter, r *http.Request) {
+	topic := r.PathValue("topic")
+	if topic != "" {
+		if _, ok := c.topic(w, r); !ok {
+			return
+		}
+	}
+	var request struct {
+		Seconds *float64 `json:"seconds"`
+	}
+	if err := decodeControlRequest(r, &request); err != nil {
+		writeControlError(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.Seconds == nil || *request.Seconds <= 0 || *request.Seconds > maxControlDropout.Seconds() {
+		writeControlError(w, http.StatusBadRequest, fmt.Errorf("seconds must be positive and at most %g", maxControlDropout.Seconds()))
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until := c.now().Add(time.Duration(*request.Seconds * float64(time.Second)))
+	if topic == "" {
+		c.dropoutAll = until
+		log.Printf("[SIMULATOR_CONTROL] dropping every topic until %s\n", until.Format(time.RFC3339))
+	} else {
+		c.dropouts[topic] = until
+		log.Printf("[SIMULATOR_CONTROL] dropping %s until %s\n", topic, until.Format(time.RFC3339))
+	}
+	writeJSON(w, http.StatusOK, c.status())
+}
+
+// topic returns the known topic named in the request path, or answers 404.
+func (c *Controller) topic(w http.ResponseWriter, r *http.Request) (string, bool) {
+	topic := r.PathValue("topic")
+	if _, ok := c.signals[topic]; !ok {
+		writeControlError(w, http.StatusNotFound, fmt.Errorf("unknown topic %q", topic))
+		return "", false
+	}
+	return topic, true
+}
+
+func decodeControlRequest(r *http.Request, request any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxControlRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		return fmt.Errorf("decode request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("[SIMULATOR_CONTROL] couldn't write response: %s\n", err.Error())
+	}
+}
+
+func writeControlError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
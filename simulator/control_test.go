@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestController() (*Controller, *time.Time) {
+	now := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	controller := NewController([]SimulatedMessage{{
+		Name: "Powertrain",
+		Signals: []SimulatedSignal{
+			{Topic: "data/powertrain/engine/speed", Name: "EngineSpeed", Message: "Powertrain", Unit: "rpm", Max: 8000},
+			{Topic: "data/powertrain/engine/temperature", Name: "CoolantTemp", Message: "Powertrain", Unit: "degC", Length: 16, Signed: true, Factor: 0.5, Min: -40, Max: 150},
+		},
+	}})
+	controller.now = func() time.Time { return now }
+	return controller, &now
+}
+
+func serveControl(t *testing.T, controller *Controller, method string, target string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	controller.Handler().ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return recorder
+}
+
+func TestControllerListsTopics(t *testing.T) {
+	controller, _ := newTestController()
+	require.Equal(t, http.StatusOK, serveControl(t, controller, http.MethodPut, "/force/data/powertrain/engine/temperature", `{"value":120}`).Code)
+
+	response := serveControl(t, controller, http.MethodGet, "/topics", "")
+
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	var topics []controlTopic
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &topics))
+	require.Len(t, topics, 2)
+	assert.Equal(t, "data/powertrain/engine/speed", topics[0].Topic)
+	assert.Equal(t, "rpm", topics[0].Unit)
+	assert.Nil(t, topics[0].Forced)
+	require.NotNil(t, topics[1].Forced)
+	assert.Equal(t, 120.0, *topics[1].Forced)
+}
+
+func TestControllerPauseAndResume(t *testing.T) {
+	controller, _ := newTestController()
+
+	require.Equal(t, http.StatusOK, serveControl(t, controller, http.MethodPost, "/pause", "").Code)
+	_, ok := controller.Adjust("data/powertrain/engine/speed", 1000)
+	assert.False(t, ok, "nothing is published while paused")
+
+	response := serveControl(t, controller, http.MethodPost, "/resume", "")
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"paused":false,"rate_multiplier":1,"forced":{},"dropouts":{}}`, response.Body.String())
+	value, ok := controller.Adjust("data/powertrain/engine/speed", 1000)
+	assert.True(t, ok)
+	assert.Equal(t, 1000.0, value)
+}
+
+func TestControllerForcesValues(t *testing.T) {
+	controller, _ := newTestController()
+
+	response := serveControl(t, controller, http.MethodPut, "/force/data/powertrain/engine/temperature", `{"value":131.5}`)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	value, ok := controller.Adjust("data/powertrain/engine/temperature", 80)
+	assert.True(t, ok)
+	assert.Equal(t, 131.5, value)
+	value, _ = controller.Adjust("data/powertrain/engine/speed", 4000)
+	assert.Equal(t, 4000.0, value, "other topics keep their simulated values")
+
+	require.Equal(t, http.StatusOK, serveControl(t, controller, http.MethodDelete, "/force/data/powertrain/engine/temperature", "").Code)
+	value, _ = controller.Adjust("data/powertrain/engine/temperature", 80)
+	assert.Equal(t, 80.0, value)
+}
+
+func TestControllerQuantizesForcedValues(t *testing.T) {
+	controller, _ := newTestController()
+
+	response := serveControl(t, controller, http.MethodPut, "/force/data/powertrain/engine/temperature", `{"value":131.3}`)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	value, _ := controller.Adjust("data/powertrain/engine/temperature", 80)
+	assert.Equal(t, 131.5, value, "the nearest value the 0.5 factor can encode")
+	assert.Contains(t, response.Body.String(), `"data/powertrain/engine/temperature":131.5`)
+}
+
+func TestControllerDropouts(t *testing.T) {
+	controller, now := newTestController()
+
+	require.Equal(t, http.StatusOK, serveControl(t, controller, http.MethodPost, "/dropout/data/powertrain/engine/speed", `{"seconds":5}`).Code)
+
+	_, ok := controller.Adjust("data/powertrain/engine/speed", 1000)
+	assert.False(t, ok)
+	_, ok = controller.Adjust("data/powertrain/engine/temperature", 80)
+	assert.True(t, ok, "a topic dropout leaves the other topics alone")
+
+	*now = now.Add(5 * time.Second)
+	_, ok = controller.Adjust("data/powertrain/engine/speed", 1000)
+	assert.True(t, ok, "the topic comes back after the dropout")
+
+	response := serveControl(t, controller, http.MethodPost, "/dropout", `{"seconds":0.5}`)
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"dropout_all":"2026-08-10T12:00:05.5Z"`)
+	_, ok = controller.Adjust("data/powertrain/engine/temperature", 80)
+	assert.False(t, ok, "a dropout without a topic silences every topic")
+}
+
+func TestControllerChangesRate(t *testing.T) {
+	controller, _ := newTestController()
+
+	response := serveControl(t, controller, http.MethodPut, "/rate", `{"multiplier":4}`)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 4.0, controller.RateMultiplier())
+	assert.Equal(t, 250*time.Millisecond, scaledCycleTime(time.Second, controller.RateMultiplier))
+}
+
+func TestControllerSignalsRateAndPauseChanges(t *testing.T) {
+	controller, _ := newTestController()
+
+	for _, change := range []struct{ method, target, body string }{
+		{http.MethodPut, "/rate", `{"multiplier":0.5}`},
+		{http.MethodPost, "/pause", ""},
+		{http.MethodPost, "/resume", ""},
+	} {
+		changed := controller.RateChanged()
+		response := serveControl(t, controller, change.method, change.target, change.body)
+		require.Equal(t, http.StatusOK, response.Code)
+		select {
+		case <-changed:
+		default:
+			t.Fatalf("%s %s did not signal the schedulers", change.method, change.target)
+		}
+	}
+}
+
+func TestControllerRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantErr    string
+	}{
+		{name: "unknown topic", method: http.MethodPut, target: "/force/data/unknown", body: `{"value":1}`, wantStatus: http.StatusNotFound, wantErr: `unknown topic \"data/unknown\"`},
+		{name: "missing value", method: http.MethodPut, target: "/force/data/powertrain/engine/speed", body: `{}`, wantStatus: http.StatusBadRequest, wantErr: "value is required"},
+		{name: "value above range", method: http.MethodPut, target: "/force/data/powertrain/engine/temperature", body: `{"value":151}`, wantStatus: http.StatusBadRequest, wantErr: "value 151 is outside the signal range [-40|150]"},
+		{name: "value below range", method: http.MethodPut, target: "/force/data/powertrain/engine/speed", body: `{"value":-1}`, wantStatus: http.StatusBadRequest, wantErr: "value -1 is outside the signal range [0|8000]"},
+		{name: "malformed body", method: http.MethodPut, target: "/force/data/powertrain/engine/speed", body: `{"value":`, wantStatus: http.StatusBadRequest, wantErr: "decode request body"},
+		{name: "unknown field", method: http.MethodPut, target: "/rate", body: `{"interval":100}`, wantStatus: http.StatusBadRequest, wantErr: "unknown field"},
+		{name: "rate too high", method: http.MethodPut, target: "/rate", body: `{"multiplier":1000}`, wantStatus: http.StatusBadRequest, wantErr: "multiplier must be between 0.01 and 100"},
+		{name: "negative dropout", method: http.MethodPost, target: "/dropout", body: `{"seconds":-1}`, wantStatus: http.StatusBadRequest, wantErr: "seconds must be positive"},
+		{name: "unknown dropout topic", method: http.MethodPost, target: "/dropout/data/unknown", body: `{"seconds":1}`, wantStatus: http.StatusNotFound, wantErr: "unknown topic"},
+		{name: "wrong method", method: http.MethodGet, target: "/pause", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller, _ := newTestController()
+
+			response := serveControl(t, controller, tt.method, tt.target, tt.body)
+
+			assert.Equal(t, tt.wantStatus, response.Code)
+			assert.Contains(t, response.Body.String(), tt.wantErr)
+		})
+	}
+}
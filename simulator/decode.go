@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// extendedFrameFlag marks 29-bit identifiers in DBC message IDs.
+const extendedFrameFlag = 0x80000000
+
+// CANFrame is one received or recorded classic CAN or CAN FD data frame.
+type CANFrame struct {
+	Time     time.Time
+	ID       uint32
+	Extended bool
+	Data     []byte
+}
+
+// dbcID returns the identifier the DBC uses for the frame's message.
+func (f CANFrame) dbcID() uint32 {
+	if f.Extended {
+		return f.ID | extendedFrameFlag
+	}
+	return f.ID
+}
+
+// DecodedSignal is one physical value extracted from a frame.
+type DecodedSignal struct {
+	Signal SimulatedSignal
+	Value  float64
+}
+
+// MessageDecoder decodes frames with the signal layout of the DBC messages
+// that publish MQTT topics.
+type MessageDecoder struct {
+	messages map[uint32]SimulatedMessage
+}
+
+func NewMessageDecoder(messages []SimulatedMessage) *MessageDecoder {
+	decoder := &MessageDecoder{messages: make(map[uint32]SimulatedMessage, len(messages))}
+	for _, message := range messages {
+		decoder.messages[message.ID] = message
+	}
+	return decoder
+}
+
+// Decode returns the published signals of frame. The boolean is false when
+// the DBC does not define the frame's message.
+func (d *MessageDecoder) Decode(frame CANFrame) ([]DecodedSignal, bool, error) {
+	message, ok := d.messages[frame.dbcID()]
+	if !ok {
+		// Some DBC exporters omit the extended flag on 29-bit identifiers.
+		message, ok = d.messages[frame.ID]
+	}
+	if !ok {
+		return nil, false, nil
+	}
+
+	decoded := make([]DecodedSignal, 0, len(message.Signals))
+	for _, signal := range message.Signals {
+		raw, err := extractRaw(frame.Data, signal)
+		if err != nil {
+			return nil, true, fmt.Errorf("decode %s.%s: %w", message.Name, signal.Name, err)
+		}
+		decoded = append(decoded, DecodedSignal{Signal: signal, Value: signal.physical(raw)})
+	}
+	return decoded, true, nil
+}
+
+// extractRaw reads the signal's raw integer from data, following the DBC bit
+// numbering: Intel (little endian) signals start at their least significant
+// bit, Motorola (big endian) signals at their most significant bit.
+func extractRaw(data []byte, signal SimulatedSignal) (int64, error) {
+	if signal.Length == 0 || signal.Length > 64 {
+		return 0, fmt.Errorf("unsupported signal length %d", signal.Length)
+	}
+
+	var raw uint64
+	position := int(signal.StartBit)
+	for i := 0; i < int(signal.Length); i++ {
+		if position < 0 || position/8 >= len(data) {
+			return 0, fmt.Errorf("signal exceeds the %d-byte payload", len(data))
+		}
+		bit := uint64(data[position/8]>>(position%8)) & 1
+
+		if signal.BigEndian {
+			raw = raw<<1 | bit
+			if position%8 == 0 {
+				position += 15
+			} else {
+				position--
+			}
+		} else {
+			raw |= bit << i
+			position++
+		}
+	}
+
+	if signal.Signed && signal.Length < 64 && raw&(1<<(signal.Length-1)) != 0 {
+		raw |= ^uint64(0) << signal.Length
+	}
+	if !signal.Signed && signal.Length == 64 && raw > 1<<63-1 {
+		return 0, fmt.Errorf("unsigned 64-bit value %d overflows", raw)
+	}
+	return int64(raw), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractRaw(t *testing.T) {
+	data := []byte{0x10, 0x27, 0x18, 0xFC, 0xA0, 0x0F, 0xAB, 0xC0}
+	tests := []struct {
+		name    string
+		data    []byte
+		signal  SimulatedSignal
+		want    int64
+		wantErr string
+	}{
+		{name: "intel unsigned", data: data, signal: SimulatedSignal{StartBit: 0, Length: 16}, want: 10000},
+		{name: "intel signed", data: data, signal: SimulatedSignal{StartBit: 16, Length: 16, Signed: true}, want: -1000},
+		{name: "intel unaligned", data: data, signal: SimulatedSignal{StartBit: 32, Length: 12}, want: 0xFA0},
+		{name: "intel single bit", data: []byte{0x04}, signal: SimulatedSignal{StartBit: 2, Length: 1}, want: 1},
+		{name: "motorola aligned", data: []byte{0x12, 0x34}, signal: SimulatedSignal{StartBit: 7, Length: 16, BigEndian: true}, want: 0x1234},
+		{name: "motorola unaligned", data: data, signal: SimulatedSignal{StartBit: 55, Length: 12, BigEndian: true}, want: 0xABC},
+		{name: "motorola signed", data: []byte{0, 0, 0xFF}, signal: SimulatedSignal{StartBit: 23, Length: 8, BigEndian: true, Signed: true}, want: -1},
+		{name: "intel exceeds payload", data: data, signal: SimulatedSignal{StartBit: 56, Length: 16}, wantErr: "exceeds the 8-byte payload"},
+		{name: "motorola exceeds payload", data: []byte{0x12}, signal: SimulatedSignal{StartBit: 7, Length: 16, BigEndian: true}, wantErr: "exceeds the 1-byte payload"},
+		{name: "zero length", data: data, signal: SimulatedSignal{}, wantErr: "unsupported signal length 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractRaw(tt.data, tt.signal)
+
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMessageDecoderDecode(t *testing.T) {
+	speed := SimulatedSignal{Topic: "data/powertrain/engine/speed", Name: "EngineSpeed", StartBit: 0, Length: 16, Factor: 0.25}
+	coolant := SimulatedSignal{Topic: "data/powertrain/engine/coolant", Name: "CoolantTemperature", StartBit: 24, Length: 8, Factor: 1, Offset: -40}
+	extended := SimulatedSignal{Topic: "data/bms/soc", Name: "StateOfCharge", StartBit: 0, Length: 8, Factor: 0.5}
+	decoder := NewMessageDecoder([]SimulatedMessage{
+		{ID: 256, Name: "Powertrain", Signals: []SimulatedSignal{speed, coolant}},
+		{ID: 0x18FF00FA | extendedFrameFlag, Name: "Bms", Signals: []SimulatedSignal{extended}},
+	})
+
+	tests := []struct {
+		name      string
+		frame     CANFrame
+		want      []DecodedSignal
+		wantKnown bool
+		wantErr   string
+	}{
+		{
+			name:      "standard frame",
+			frame:     CANFrame{ID: 256, Data: []byte{0x10, 0x27, 0, 0x82, 0, 0, 0, 0}},
+			want:      []DecodedSignal{{Signal: speed, Value: 2500}, {Signal: coolant, Value: 90}},
+			wantKnown: true,
+		},
+		{
+			name:      "extended frame",
+			frame:     CANFrame{ID: 0x18FF00FA, Extended: true, Data: []byte{0xC8}},
+			want:      []DecodedSignal{{Signal: extended, Value: 100}},
+			wantKnown: true,
+		},
+		{name: "unknown frame", frame: CANFrame{ID: 0x7FF, Data: []byte{1}}},
+		{name: "short frame", frame: CANFrame{ID: 256, Data: []byte{0x10}}, wantKnown: true, wantErr: "decode Powertrain.EngineSpeed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, known, err := decoder.Decode(tt.frame)
+
+			assert.Equal(t, tt.wantKnown, known)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
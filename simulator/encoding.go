@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	defaultPayloadEncoding = "json"
+	// encodingUserProperty names the MQTT v5 user property that carries the
+	// payload encoding next to the content type.
+	encodingUserProperty = "encoding"
+)
+
+// SignalSample is one signal value as carried by an MQTT payload.
+type SignalSample struct {
+	Value float64
+	Time  time.Time
+	Unit  string
+}
+
+// MessageSample is every signal of one CAN message at one time, keyed by DBC
+// signal name, as published in message mode.
+type MessageSample struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// PayloadEncoding converts samples to and from MQTT payloads. Values travel as
+// float32 in every encoding, matching the precision of the original JSON
+// payload.
+type PayloadEncoding interface {
+	Name() string
+	ContentType() string
+	Encode(sample SignalSample) ([]byte, error)
+	Decode(payload []byte) (SignalSample, error)
+	EncodeMessage(sample MessageSample) ([]byte, error)
+	DecodeMessage(payload []byte) (MessageSample, error)
+}
+
+func narrowValues(values map[string]float64) map[string]float32 {
+	narrowed := make(map[string]float32, len(values))
+	for name, value := range values {
+		narrowed[name] = float32(value)
+	}
+	return narrowed
+}
+
+func widenValues(values map[string]float32) map[string]float64 {
+	widened := make(map[string]float64, len(values))
+	for name, value := range values {
+		widened[name] = widenFloat32(value)
+	}
+	return widened
+}
+
+var payloadEncodings = map[string]PayloadEncoding{
+	"json":     jsonEncoding{},
+	"cbor":     cborEncoding{},
+	"msgpack":  msgpackEncoding{},
+	"protobuf": protobufEncoding{},
+}
+
+// payloadEncodingByName returns the encoding selected by
+// SIMULATOR_PAYLOAD_ENCODING or --payload-encoding; empty means JSON.
+func payloadEncodingByName(name string) (PayloadEncoding, error) {
+	if name == "" {
+		name = defaultPayloadEncoding
+	}
+	encoding, ok := payloadEncodings[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(payloadEncodings))
+		for name := range payloadEncodings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown payload encoding %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	return encoding, nil
+}
+
+// payloadEncodingByContentType finds the encoding a publish advertised. An
+// empty content type is the original JSON payload.
+func payloadEncodingByContentType(contentType string) (PayloadEncoding, bool) {
+	if contentType == "" {
+		return jsonEncoding{}, true
+	}
+	for _, encoding := range payloadEncodings {
+		if encoding.ContentType() == contentType {
+			return encoding, true
+		}
+	}
+	return nil, false
+}
+
+// jsonEncoding is the {"value","time","unit"} payload the Grafana MQTT
+// datasource reads.
+type jsonEncoding struct{}
+
+type jsonSample struct {
+	Value float32 `json:"value"`
+	Time  string  `json:"time"`
+	Unit  string  `json:"unit"`
+}
+
+func (jsonEncoding) Name() string        { return "json" }
+func (jsonEncoding) ContentType() string { return "application/json" }
+
+func (jsonEncoding) Encode(sample SignalSample) ([]byte, error) {
+	return json.Marshal(jsonSample{
+		Value: float32(sample.Value),
+		Time:  sample.Time.Format(time.RFC3339Nano),
+		Unit:  sample.Unit,
+	})
+}
+
+func (jsonEncoding) Decode(payload []byte) (SignalSample, error) {
+	var data jsonSample
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return SignalSample{}, err
+	}
+	timestamp, err := parseTimestamp(data.Time)
+	if err != nil {
+		return SignalSample{}, err
+	}
+	return SignalSample{Value: widenFloat32(data.Value), Time: timestamp, Unit: data.Unit}, nil
+}
+
+type jsonMessageSample struct {
+	Time   string             `json:"time"`
+	Values map[string]float32 `json:"values"`
+}
+
+func (jsonEncoding) EncodeMessage(sample MessageSample) ([]byte, error) {
+	return json.Marshal(jsonMessageSample{Time: sample.Time.Format(time.RFC3339Nano), Values: narrowValues(sample.Values)})
+}
+
+func (jsonEncoding) DecodeMessage(payload []byte) (MessageSample, error) {
+	var data jsonMessageSample
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return MessageSample{}, err
+	}
+	timestamp, err := parseTimestamp(data.Time)
+	if err != nil {
+		return MessageSample{}, err
+	}
+	return MessageSample{Time: timestamp, Values: widenValues(data.Values)}, nil
+}
+
+// cborEncoding and msgpackEncoding send the array [value, time, unit], or
+// [time, {signal: value}] for a message, with the time in Unix nanoseconds,
+// so no field names travel over the link.
+type cborEncoding struct{}
+
+type cborSample struct {
+	_     struct{} `cbor:",toarray"`
+	Value float32
+	Time  int64
+	Unit  string
+}
+
+func (cborEncoding) Name() string        { return "cbor" }
+func (cborEncoding) ContentType() string { return "application/cbor" }
+
+func (cborEncoding) Encode(sample SignalSample) ([]byte, error) {
+	return cbor.Marshal(cborSample{Value: float32(sample.Value), Time: sample.Time.UnixNano(), Unit: sample.Unit})
+}
+
+func (cborEncoding) Decode(payload []byte) (SignalSample, error) {
+	var data cborSample
+	if err := cbor.Unmarshal(payload, &data); err != nil {
+		return SignalSample{}, err
+	}
+	return SignalSample{Value: widenFloat32(data.Value), Time: time.Unix(0, data.Time).UTC(), Unit: data.Unit}, nil
+}
+
+type cborMessageSample struct {
+	_      struct{} `cbor:",toarray"`
+	Time   int64
+	Values map[string]float32
+}
+
+// cborSortedMode writes map keys in a fixed order, so equal samples encode
+// equally.
+var cborSortedMode, _ = cbor.EncOptions{Sort: cbor.SortBytewiseLexical}.EncMode()
+
+func (cborEncoding) EncodeMessage(sample MessageSample) ([]byte, error) {
+	return cborSortedMode.Marshal(cborMessageSample{Time: sample.Time.UnixNano(), Values: narrowValues(sample.Values)})
+}
+
+func (cborEncoding) DecodeMessage(payload []byte) (MessageSample, error) {
+	var data cborMessageSample
+	if err := cbor.Unmarshal(payload, &data); err != nil {
+		return MessageSample{}, err
+	}
+	return MessageSample{Time: time.Unix(0, data.Time).UTC(), Values: widenValues(data.Values)}, nil
+}
+
+type msgpackEncoding struct{}
+
+type msgpackSample struct {
+	_msgpack struct{} `msgpack:",as_array"`
+	Value    float32
+	Time     int64
+	Unit     string
+}
+
+func (msgpackEncoding) Name() string        { return "msgpack" }
+func (msgpackEncoding) ContentType() string { return "application/msgpack" }
+
+func (msgpackEncoding) Encode(sample SignalSample) ([]byte, error) {
+	return msgpack.Marshal(&msgpackSample{Value: float32(sample.Value), Time: sample.Time.UnixNano(), Unit: sample.Unit})
+}
+
+func (msgpackEncoding) Decode(payload []byte) (SignalSample, error) {
+	var data msgpackSample
+	if err := msgpack.Unmarshal(payload, &data); err != nil {
+		return SignalSample{}, err
+	}
+	return SignalSample{Value: widenFloat32(data.Value), Time: time.Unix(0, data.Time).UTC(), Unit: data.Unit}, nil
+}
+
+type msgpackMessageSample struct {
+	_msgpack struct{} `msgpack:",as_array"`
+	Time     int64
+	Values   map[string]float32
+}
+
+// EncodeMessage writes msgpackMessageSample by hand, because msgpack only
+// sorts the keys of untyped maps and equal samples must encode equally.
+func (msgpackEncoding) EncodeMessage(sample MessageSample) ([]byte, error) {
+	names := make([]string, 0, len(sample.Values))
+	for name := range sample.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var payload bytes.Buffer
+	encoder := msgpack.NewEncoder(&payload)
+	if err := encoder.EncodeArrayLen(2); err != nil {
+		return nil, err
+	}
+	if err := encoder.EncodeInt(sample.Time.UnixNano()); err != nil {
+		return nil, err
+	}
+	if err := encoder.EncodeMapLen(len(names)); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if err := encoder.EncodeString(name); err != nil {
+			return nil, err
+		}
+		if err := encoder.EncodeFloat32(float32(sample.Values[name])); err != nil {
+			return nil, err
+		}
+	}
+	return payload.Bytes(), nil
+}
+
+func (msgpackEncoding) DecodeMessage(payload []byte) (MessageSample, error) {
+	var data msgpackMessageSample
+	if err := msgpack.Unmarshal(payload, &data); err != nil {
+		return MessageSample{}, err
+	}
+	return MessageSample{Time: time.Unix(0, data.Time).UTC(), Values: widenValues(data.Values)}, nil
+}
+
+// protobufEncoding writes the SignalSample and MessageSample messages of
+// signal_sample.proto.
+// The message is small enough to encode by hand, which keeps protoc out of the
+// build.
+type protobufEncoding struct{}
+
+const (
+	protobufValueField = 1
+	protobufTimeField  = 2
+	protobufUnitField  = 3
+
+	protobufMessageTimeField   = 1
+	protobufMessageValuesField = 2
+	protobufEntryKeyField      = 1
+	protobufEntryValueField    = 2
+)
+
+func (protobufEncoding) Name() string        { return "protobuf" }
+func (protobufEncoding) ContentType() string { return "application/x-protobuf" }
+
+func (protobufEncoding) Encode(sample SignalSample) ([]byte, error) {
+	var payload []byte
+	payload = protowire.AppendTag(payload, protobufValueField, protowire.Fixed32Type)
+	payload = protowire.AppendFixed32(payload, math.Float32bits(float32(sample.Value)))
+	payload = protowire.AppendTag(payload, protobufTimeField, protowire.VarintType)
+	payload = protowire.AppendVarint(payload, uint64(sample.Time.UnixNano()))
+	if sample.Unit != "" {
+		payload = protowire.AppendTag(payload, protobufUnitField, protowire.BytesType)
+		payload = protowire.AppendString(payload, sample.Unit)
+	}
+	return payload, nil
+}
+
+func (protobufEncoding) Decode(payload []byte) (SignalSample, error) {
+	var value float32
+	var nanos int64
+	var unit string
+	for len(payload) > 0 {
+		number, wireType, n := protowire.ConsumeTag(payload)
+		if n < 0 {
+			return SignalSample{}, protowire.ParseError(n)
+		}
+		payload = payload[n:]
+
+		switch {
+		case number == protobufValueField && wireType == protowire.Fixed32Type:
+			bits, m := protowire.ConsumeFixed32(payload)
+			if m < 0 {
+				return SignalSample{}, protowire.ParseError(m)
+			}
+			value, n = math.Float32frombits(bits), m
+		case number == protobufTimeField && wireType == protowire.VarintType:
+			varint, m := protowire.ConsumeVarint(payload)
+			if m < 0 {
+				return SignalSample{}, protowire.ParseError(m)
+			}
+			nanos, n = int64(varint), m
+		case number == protobufUnitField && wireType == protowire.BytesType:
+			text, m := protowire.ConsumeString(payload)
+			if m < 0 {
+				return SignalSample{}, protowire.ParseError(m)
+			}
+			unit, n = text, m
+		default:
+			// Unknown fields are skipped, as protobuf readers must.
+			n = protowire.ConsumeFieldValue(number, wireType, payload)
+			if n < 0 {
+				return SignalSample{}, protowire.ParseError(n)
+			}
+		}
+		payload = payload[n:]
+	}
+	if nanos == 0 {
+		return SignalSample{}, errors.New("protobuf sample has no time")
+	}
+	return SignalSample{Value: widenFloat32(value), Time: time.Unix(0, nanos).UTC(), Unit: unit}, nil
+}
+
+func (protobufEncoding) EncodeMessage(sample MessageSample) ([]byte, error) {
+	var payload []byte
+	payload = protowire.AppendTag(payload, protobufMessageTimeField, protowire.VarintType)
+	payload = protowire.AppendVarint(payload, uint64(sample.Time.UnixNano()))
+
+	// Map entries are written in name order so equal samples encode equally.
+	names := make([]string, 0, len(sample.Values))
+	for name := range sample.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var entry []byte
+		entry = protowire.AppendTag(entry, protobufEntryKeyField, protowire.BytesType)
+		entry = protowire.AppendString(entry, name)
+		entry = protowire.AppendTag(entry, protobufEntryValueField, protowire.Fixed32Type)
+		entry = protowire.AppendFixed32(entry, math.Float32bits(float32(sample.Values[name])))
+
+		payload = protowire.AppendTag(payload, protobufMessageValuesField, protowire.BytesType)
+		payload = protowire.AppendBytes(payload, entry)
+	}
+	return payload, nil
+}
+
+func (protobufEncoding) DecodeMessage(payload []byte) (MessageSample, error) {
+	sample := MessageSample{Values: make(map[string]float64)}
+	var nanos int64
+	for len(payload) > 0 {
+		number, wireType, n := protowire.ConsumeTag(payload)
+		if n < 0 {
+			return MessageSample{}, protowire.ParseError(n)
+		}
+		payload = payload[n:]
+
+		switch {
+		case number == protobufMessageTimeField && wireType == protowire.VarintType:
+			varint, m := protowire.ConsumeVarint(payload)
+			if m < 0 {
+				return MessageSample{}, protowire.ParseError(m)
+			}
+			nanos, n = int64(varint), m
+		case number == protobufMessageValuesField && wireType == protowire.BytesType:
+			entry, m := protowire.ConsumeBytes(payload)
+			if m < 0 {
+				return MessageSample{}, protowire.ParseError(m)
+			}
+			name, value, err := decodeProtobufValueEntry(entry)
+			if err != nil {
+				return MessageSample{}, err
+			}
+			sample.Values[name], n = value, m
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, payload)
+			if n < 0 {
+				return MessageSample{}, protowire.ParseError(n)
+			}
+		}
+		payload = payload[n:]
+	}
+	if nanos == 0 {
+		return MessageSample{}, errors.New("protobuf message sample has no time")
+	}
+	sample.Time = time.Unix(0, nanos).UTC()
+	return sample, nil
+}
+
+// decodeProtobufValueEntry reads one map<string, float> entry.
+func decodeProtobufValueEntry(entry []byte) (string, float64, error) {
+	var name string
+	var value float32
+	for len(entry) > 0 {
+		number, wireType, n := protowire.ConsumeTag(entry)
+		if n < 0 {
+			return "", 0, protowire.ParseError(n)
+		}
+		entry = entry[n:]
+
+		switch {
+		case number == protobufEntryKeyField && wireType == protowire.BytesType:
+			text, m := protowire.ConsumeString(entry)
+			if m < 0 {
+				return "", 0, protowire.ParseError(m)
+			}
+			name, n = text, m
+		case number == protobufEntryValueField && wireType == protowire.Fixed32Type:
+			bits, m := protowire.ConsumeFixed32(entry)
+			if m < 0 {
+				return "", 0, protowire.ParseError(m)
+			}
+			value, n = math.Float32frombits(bits), m
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, entry)
+			if n < 0 {
+				return "", 0, protowire.ParseError(n)
+			}
+		}
+		entry = entry[n:]
+	}
+	return name, widenFloat32(value), nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestPayloadEncodingByName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+	}{
+		{name: "", want: "json"},
+		{name: "json", want: "json"},
+		{name: "CBOR", want: "cbor"},
+		{name: "msgpack", want: "msgpack"},
+		{name: "protobuf", want: "protobuf"},
+		{name: "xml", wantErr: `unknown payload encoding "xml", expected one of cbor, json, msgpack, protobuf`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := payloadEncodingByName(tt.name)
+
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.Name())
+		})
+	}
+}
+
+func TestPayloadEncodingByContentType(t *testing.T) {
+	for _, encoding := range payloadEncodings {
+		got, ok := payloadEncodingByContentType(encoding.ContentType())
+		require.True(t, ok, encoding.Name())
+		assert.Equal(t, encoding.Name(), got.Name())
+	}
+
+	got, ok := payloadEncodingByContentType("")
+	require.True(t, ok)
+	assert.Equal(t, "json", got.Name(), "publishes without a content type are JSON")
+
+	_, ok = payloadEncodingByContentType("text/csv")
+	assert.False(t, ok)
+}
+
+func TestPayloadEncodingsRoundTrip(t *testing.T) {
+	sample := SignalSample{Value: 4213.25, Time: time.Date(2026, 8, 10, 12, 30, 0, 123456789, time.UTC), Unit: "rpm"}
+
+	for _, encoding := range payloadEncodings {
+		t.Run(encoding.Name(), func(t *testing.T) {
+			payload, err := encoding.Encode(sample)
+			require.NoError(t, err)
+
+			got, err := encoding.Decode(payload)
+
+			require.NoError(t, err)
+			assert.Equal(t, sample.Value, got.Value)
+			assert.True(t, sample.Time.Equal(got.Time))
+			assert.Equal(t, sample.Unit, got.Unit)
+		})
+	}
+}
+
+func TestPayloadEncodingsKeepFloat32Values(t *testing.T) {
+	sample := SignalSample{Value: 0.1, Time: time.Unix(1, 0)}
+
+	for _, encoding := range payloadEncodings {
+		t.Run(encoding.Name(), func(t *testing.T) {
+			payload, err := encoding.Encode(sample)
+			require.NoError(t, err)
+
+			got, err := encoding.Decode(payload)
+
+			require.NoError(t, err)
+			assert.Equal(t, 0.1, got.Value)
+		})
+	}
+}
+
+func TestJSONEncodingPayload(t *testing.T) {
+	timestamp := time.Date(2026, 8, 10, 12, 30, 0, 0, time.UTC)
+
+	data, err := jsonEncoding{}.Encode(SignalSample{Value: 4213.25, Time: timestamp, Unit: "rpm"})
+
+	require.NoError(t, err)
+	assert.Equal(t, `{"value":4213.25,"time":"2026-08-10T12:30:00Z","unit":"rpm"}`, string(data))
+}
+
+func TestCompactEncodingsAreSmallerThanJSON(t *testing.T) {
+	sample := SignalSample{Value: 4213.25, Time: time.Date(2026, 8, 10, 12, 30, 0, 123456789, time.UTC), Unit: "rpm"}
+	jsonPayload, err := jsonEncoding{}.Encode(sample)
+	require.NoError(t, err)
+
+	for _, encoding := range []PayloadEncoding{cborEncoding{}, msgpackEncoding{}, protobufEncoding{}} {
+		payload, err := encoding.Encode(sample)
+		require.NoError(t, err)
+		assert.Less(t, len(payload), len(jsonPayload)/2, encoding.Name())
+	}
+}
+
+func TestPayloadEncodingsRejectMalformedPayloads(t *testing.T) {
+	for _, encoding := range payloadEncodings {
+		t.Run(encoding.Name(), func(t *testing.T) {
+			_, err := encoding.Decode([]byte{0xFF, 0xFF, 0xFF})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestProtobufEncodingSkipsUnknownFields(t *testing.T) {
+	payload, err := protobufEncoding{}.Encode(SignalSample{Value: 1.5, Time: time.Unix(2, 0), Unit: "V"})
+	require.NoError(t, err)
+	payload = protowire.AppendTag(payload, 9, protowire.BytesType)
+	payload = protowire.AppendString(payload, "added by a newer schema")
+
+	got, err := protobufEncoding{}.Decode(payload)
+
+	require.NoError(t, err)
+	assert.Equal(t, SignalSample{Value: 1.5, Time: time.Unix(2, 0).UTC(), Unit: "V"}, got)
+}
+
+func TestPayloadEncodingsRoundTripMessages(t *testing.T) {
+	sample := MessageSample{
+		Time:   time.Date(2026, 8, 10, 12, 30, 0, 123456789, time.UTC),
+		Values: map[string]float64{"EngineSpeed": 4213.25, "CoolantTemp": -12.5, "Gear": 0},
+	}
+
+	for _, encoding := range payloadEncodings {
+		t.Run(encoding.Name(), func(t *testing.T) {
+			payload, err := encoding.EncodeMessage(sample)
+			require.NoError(t, err)
+
+			got, err := encoding.DecodeMessage(payload)
+
+			require.NoError(t, err)
+			assert.True(t, sample.Time.Equal(got.Time))
+			assert.Equal(t, sample.Values, got.Values)
+		})
+	}
+}
+
+func TestPayloadEncodingsMessagesAreDeterministic(t *testing.T) {
+	sample := MessageSample{Time: time.Unix(1, 0), Values: map[string]float64{"A": 1, "B": 2, "C": 3, "D": 4, "E": 5, "F": 6}}
+
+	for name, encoding := range payloadEncodings {
+		t.Run(name, func(t *testing.T) {
+			first, err := encoding.EncodeMessage(sample)
+			require.NoError(t, err)
+
+			for range 10 {
+				again, err := encoding.EncodeMessage(sample)
+				require.NoError(t, err)
+				assert.Equal(t, first, again)
+			}
+		})
+	}
+}
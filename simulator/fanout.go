@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+const defaultMessageTopicPrefix = "frames"
+
+// messageTopic is the topic a CAN message is published to in message mode.
+func messageTopic(prefix string, message SimulatedMessage) string {
+	return strings.TrimSuffix(prefix, "/") + "/" + message.Name
+}
+
+// fanoutPublish is one per-signal payload split from a message payload.
+type fanoutPublish struct {
+	Signal  SimulatedSignal
+	Payload []byte
+}
+
+// MessageFanout splits message-mode payloads back into the per-signal topics
+// the generated dashboards subscribe to.
+type MessageFanout struct {
+	prefix   string
+	messages map[string]SimulatedMessage
+	output   PayloadEncoding
+}
+
+func NewMessageFanout(messages []SimulatedMessage, prefix string, output PayloadEncoding) *MessageFanout {
+	fanout := &MessageFanout{
+		prefix:   strings.TrimSuffix(prefix, "/"),
+		messages: make(map[string]SimulatedMessage, len(messages)),
+		output:   output,
+	}
+	for _, message := range messages {
+		fanout.messages[messageTopic(fanout.prefix, message)] = message
+	}
+	return fanout
+}
+
+// Filter is the subscription covering every message topic.
+func (f *MessageFanout) Filter() string {
+	return f.prefix + "/#"
+}
+
+// Split decodes a message payload, in the encoding its content type
+// advertises, and encodes each known signal as its own payload. Values of
+// signals the DBC does not define for the message are ignored.
+func (f *MessageFanout) Split(topic string, contentType string, payload []byte) ([]fanoutPublish, error) {
+	message, ok := f.messages[topic]
+	if !ok {
+		return nil, fmt.Errorf("no DBC message for topic %q", topic)
+	}
+	encoding, ok := payloadEncodingByContentType(contentType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+	sample, err := encoding.DecodeMessage(payload)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s message payload: %w", encoding.Name(), err)
+	}
+
+	publishes := make([]fanoutPublish, 0, len(sample.Values))
+	for _, signal := range message.Signals {
+		value, ok := sample.Values[signal.Name]
+		if !ok {
+			continue
+		}
+		data, err := f.output.Encode(SignalSample{Value: value, Time: sample.Time, Unit: signal.Unit})
+		if err != nil {
+			return nil, fmt.Errorf("encode %s: %w", signal.Topic, err)
+		}
+		publishes = append(publishes, fanoutPublish{Signal: signal, Payload: data})
+	}
+	return publishes, nil
+}
+
+// receivedMessage is a publish taken off the MQTT client's receive callback.
+type receivedMessage struct {
+	Topic       string
+	ContentType string
+	Payload     []byte
+}
+
+// runFanout republishes every received message payload as per-signal
+// payloads until ctx is done. Payloads that cannot be split are logged and
+// skipped; a failed publish stops the fan-out.
+func runFanout(ctx context.Context, received <-chan receivedMessage, fanout *MessageFanout, publisher Publisher) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message := <-received:
+			publishes, err := fanout.Split(message.Topic, message.ContentType, message.Payload)
+			if err != nil {
+				log.Printf("[SIMULATOR_FANOUT] skipping %s: %s\n", message.Topic, err.Error())
+				continue
+			}
+			for _, publish := range publishes {
+				if err := publisher.Publish(ctx, publish.Signal.Topic, publish.Payload, publish.Signal.publishOptions()...); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					return fmt.Errorf("publish %s: %w", publish.Signal.Topic, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fanoutFixture() []SimulatedMessage {
+	return []SimulatedMessage{{
+		ID: 256, Name: "Powertrain",
+		Signals: []SimulatedSignal{
+			{Topic: "data/powertrain/engine/speed", Name: "EngineSpeed", Unit: "rpm", Message: "Powertrain", MessageID: 256},
+			{Topic: "data/powertrain/engine/temperature", Name: "CoolantTemp", Unit: "degC", Message: "Powertrain", MessageID: 256},
+		},
+	}}
+}
+
+func TestMessageTopic(t *testing.T) {
+	message := SimulatedMessage{Name: "Powertrain"}
+
+	assert.Equal(t, "frames/Powertrain", messageTopic("frames", message))
+	assert.Equal(t, "car/frames/Powertrain", messageTopic("car/frames/", message))
+}
+
+func TestMessageFanoutSplit(t *testing.T) {
+	timestamp := time.Date(2026, 8, 10, 12, 30, 0, 0, time.UTC)
+	fanout := NewMessageFanout(fanoutFixture(), "frames/", jsonEncoding{})
+	payload, err := cborEncoding{}.EncodeMessage(MessageSample{
+		Time:   timestamp,
+		Values: map[string]float64{"EngineSpeed": 4213.25, "Unknown": 1},
+	})
+	require.NoError(t, err)
+
+	publishes, err := fanout.Split("frames/Powertrain", "application/cbor", payload)
+
+	require.NoError(t, err)
+	require.Len(t, publishes, 1, "signals missing from the payload or the DBC are skipped")
+	assert.Equal(t, "data/powertrain/engine/speed", publishes[0].Signal.Topic)
+	assert.Equal(t, `{"value":4213.25,"time":"2026-08-10T12:30:00Z","unit":"rpm"}`, string(publishes[0].Payload))
+	assert.Equal(t, "frames/#", fanout.Filter())
+}
+
+func TestMessageFanoutSplitErrors(t *testing.T) {
+	fanout := NewMessageFanout(fanoutFixture(), "frames", jsonEncoding{})
+	tests := []struct {
+		name        string
+		topic       string
+		contentType string
+		payload     string
+		wantErr     string
+	}{
+		{name: "unknown message", topic: "frames/Chassis", payload: "{}", wantErr: `no DBC message for topic "frames/Chassis"`},
+		{name: "unknown content type", topic: "frames/Powertrain", contentType: "text/csv", wantErr: `unsupported content type "text/csv"`},
+		{name: "malformed payload", topic: "frames/Powertrain", payload: "{", wantErr: "decode json message payload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fanout.Split(tt.topic, tt.contentType, []byte(tt.payload))
+
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRunFanout(t *testing.T) {
+	fanout := NewMessageFanout(fanoutFixture(), "frames", jsonEncoding{})
+	payload, err := jsonEncoding{}.EncodeMessage(MessageSample{
+		Time:   time.Date(2026, 8, 10, 12, 30, 0, 0, time.UTC),
+		Values: map[string]float64{"EngineSpeed": 900, "CoolantTemp": 85},
+	})
+	require.NoError(t, err)
+	received := make(chan receivedMessage, 2)
+	received <- receivedMessage{Topic: "frames/Unknown", Payload: payload}
+	received <- receivedMessage{Topic: "frames/Powertrain", ContentType: "application/json", Payload: payload}
+	broker := &recordingPublisher{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() { done <- runFanout(ctx, received, fanout, broker) }()
+	require.Eventually(t, func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		return len(broker.published) == 2
+	}, time.Second, time.Millisecond)
+	cancel()
+
+	require.NoError(t, <-done)
+	assert.Equal(t, "data/powertrain/engine/speed", broker.published[0].Topic)
+	assert.Equal(t, "data/powertrain/engine/temperature", broker.published[1].Topic)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// gatewayReconnectDelay is how long the gateway waits before dialing a
+	// TCP source again.
+	gatewayReconnectDelay = 2 * time.Second
+	// gatewayReportInterval is how often the gateway logs its counters.
+	gatewayReportInterval = time.Minute
+
+	// canMTU and canFDMTU are the sizes of struct can_frame and struct
+	// canfd_frame read from a SocketCAN raw socket.
+	canMTU   = 16
+	canFDMTU = 72
+
+	canEFFFlag = 0x80000000
+	canRTRFlag = 0x40000000
+	canERRFlag = 0x20000000
+	canEFFMask = 0x1FFFFFFF
+	canSFFMask = 0x7FF
+)
+
+// CANSource delivers the frames of a live CAN bus. ReadFrame blocks until a
+// frame arrives and returns io.EOF when the source ends; Close unblocks it.
+type CANSource interface {
+	ReadFrame() (CANFrame, error)
+	Close() error
+}
+
+// OpenCANSource opens a gateway source:
+//
+//	socketcan:can0  a Linux SocketCAN interface, such as can0 or vcan0
+//	tcp://host:port a candump stream served over TCP, redialed when it drops
+//	udp://host:port candump lines in datagrams, received on that address
+//	-               candump lines on standard input
+//
+// Stream lines are `candump -L` lines, such as `(1436509052.249713) can0
+// 123#DEADBEEF`, or the default `candump can0` listing. Frames without a
+// timestamp are stamped when they are read.
+func OpenCANSource(spec string) (CANSource, error) {
+	switch {
+	case spec == "-" || spec == "stdin":
+		return newReadAheadCANSource(os.Stdin), nil
+	case strings.HasPrefix(spec, "socketcan:"):
+		return openSocketCAN(strings.TrimPrefix(spec, "socketcan:"))
+	case strings.HasPrefix(spec, "tcp://"):
+		return &tcpCANSource{address: strings.TrimPrefix(spec, "tcp://"), done: make(chan struct{})}, nil
+	case strings.HasPrefix(spec, "udp://"):
+		conn, err := net.ListenPacket("udp", strings.TrimPrefix(spec, "udp://"))
+		if err != nil {
+			return nil, fmt.Errorf("listen for CAN datagrams: %w", err)
+		}
+		return &streamCANSource{stream: newCandumpStream(&datagramReader{conn: conn}), closer: conn}, nil
+	default:
+		return nil, fmt.Errorf("CAN source must be socketcan:<interface>, tcp://host:port, udp://host:port or -: %q", spec)
+	}
+}
+
+// candumpStream reads frames from candump lines, skipping lines that are not
+// data frames.
+type candumpStream struct {
+	scanner *bufio.Scanner
+	now     func() time.Time
+}
+
+func newCandumpStream(r io.Reader) *candumpStream {
+	return &candumpStream{scanner: bufio.NewScanner(r), now: time.Now}
+}
+
+func (s *candumpStream) ReadFrame() (CANFrame, error) {
+	for s.scanner.Scan() {
+		line := strings.TrimSpace(s.scanner.Text())
+		if line == "" {
+			continue
+		}
+		frame, ok, err := parseCandumpStreamLine(line, s.now())
+		if err != nil {
+			// One garbled line on a serial or network link must not end the
+			// stream.
+			log.Printf("[SIMULATOR_GATEWAY] skipping line: %s\n", err.Error())
+			continue
+		}
+		if ok {
+			return frame, nil
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return CANFrame{}, fmt.Errorf("read candump stream: %w", err)
+	}
+	return CANFrame{}, io.EOF
+}
+
+// parseCandumpStreamLine parses a `candump -L` line, or a line of the
+// timestamp-less `candump can0` listing, which is stamped with now.
+func parseCandumpStreamLine(line string, now time.Time) (CANFrame, bool, error) {
+	if strings.HasPrefix(line, "(") {
+		return parseCandumpLine(line)
+	}
+	frame, ok, err := parseCandumpLine("(0) " + line)
+	frame.Time = now
+	return frame, ok, err
+}
+
+// streamCANSource reads candump lines from a stream that ends for good and
+// whose Close unblocks a pending read, like a UDP socket.
+type streamCANSource struct {
+	stream *candumpStream
+	closer io.Closer
+}
+
+func (s *streamCANSource) ReadFrame() (CANFrame, error) {
+	return s.stream.ReadFrame()
+}
+
+func (s *streamCANSource) Close() error {
+	return s.closer.Close()
+}
+
+// readAheadCANSource reads candump lines from a stream whose pending read
+// closing does not unblock, like standard input. A goroutine reads the frames
+// so that Close returns ReadFrame at once; the goroutine itself ends with the
+// stream, or with the process.
+type readAheadCANSource struct {
+	stream *candumpStream
+	reads  chan canRead
+	done   chan struct{}
+	start  sync.Once
+	close  sync.Once
+}
+
+// canRead is the outcome of one ReadFrame call of a readAheadCANSource's
+// stream.
+type canRead struct {
+	frame CANFrame
+	err   error
+}
+
+func newReadAheadCANSource(r io.Reader) *readAheadCANSource {
+	return &readAheadCANSource{stream: newCandumpStream(r), reads: make(chan canRead), done: make(chan struct{})}
+}
+
+func (s *readAheadCANSource) ReadFrame() (CANFrame, error) {
+	// Reading starts with the first call, so opening the source does not
+	// consume any input.
+	s.start.Do(func() { go s.readAhead() })
+	select {
+	case <-s.done:
+		return CANFrame{}, io.EOF
+	case read, ok := <-s.reads:
+		if !ok {
+			return CANFrame{}, io.EOF
+		}
+		return read.frame, read.err
+	}
+}
+
+func (s *readAheadCANSource) readAhead() {
+	defer close(s.reads)
+	for {
+		frame, err := s.stream.ReadFrame()
+		select {
+		case s.reads <- canRead{frame: frame, err: err}:
+		case <-s.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *readAheadCANSource) Close() error {
+	s.close.Do(func() { close(s.done) })
+	return nil
+}
+
+// datagramReader turns datagrams into a stream of lines, ending every
+// datagram with a newline.
+type datagramReader struct {
+	conn    net.PacketConn
+	buffer  [65536]byte
+	pending []byte
+}
+
+func (r *datagramReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		n, _, err := r.conn.ReadFrom(r.buffer[:len(r.buffer)-1])
+		if err != nil {
+			return 0, err
+		}
+		r.pending = r.buffer[:n]
+		if n > 0 && r.pending[n-1] != '\n' {
+			r.pending = append(r.pending, '\n')
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// tcpCANSource reads a candump stream from a TCP server, dialing it again
+// whenever the connection drops, until it is closed.
+type tcpCANSource struct {
+	address string
+	done    chan struct{}
+
+	mu     sync.Mutex
+	conn   net.Conn
+	stream *candumpStream
+	once   sync.Once
+}
+
+func (s *tcpCANSource) ReadFrame() (CANFrame, error) {
+	for {
+		stream, err := s.connect()
+		if err != nil {
+			return CANFrame{}, err
+		}
+		frame, err := stream.ReadFrame()
+		if err == nil {
+			return frame, nil
+		}
+
+		select {
+		case <-s.done:
+			return CANFrame{}, io.EOF
+		default:
+		}
+		log.Printf("[SIMULATOR_GATEWAY] lost %s: %s\n", s.address, err.Error())
+		s.mu.Lock()
+		s.conn.Close()
+		s.conn, s.stream = nil, nil
+		s.mu.Unlock()
+	}
+}
+
+// connect returns the stream of the current connection, dialing until it
+// succeeds or the source is closed.
+func (s *tcpCANSource) connect() (*candumpStream, error) {
+	for {
+		s.mu.Lock()
+		if s.stream != nil {
+			stream := s.stream
+			s.mu.Unlock()
+			return stream, nil
+		}
+		s.mu.Unlock()
+
+		conn, err := net.DialTimeout("tcp", s.address, 10*time.Second)
+		if err == nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			select {
+			case <-s.done:
+				conn.Close()
+				return nil, io.EOF
+			default:
+			}
+			log.Printf("[SIMULATOR_GATEWAY] connected to %s\n", s.address)
+			s.conn, s.stream = conn, newCandumpStream(conn)
+			return s.stream, nil
+		}
+
+		log.Printf("[SIMULATOR_GATEWAY] couldn't connect to %s: %s\n", s.address, err.Error())
+		timer := time.NewTimer(gatewayReconnectDelay)
+		select {
+		case <-s.done:
+			timer.Stop()
+			return nil, io.EOF
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *tcpCANSource) Close() error {
+	s.once.Do(func() { close(s.done) })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+// parseSocketCANFrame decodes a struct can_frame or struct canfd_frame read
+// from a raw socket. The boolean is false for remote and error frames.
+func parseSocketCANFrame(buffer []byte, received time.Time) (CANFrame, bool, error) {
+	if len(buffer) != canMTU && len(buffer) != canFDMTU {
+		return CANFrame{}, false, fmt.Errorf("unexpected %d-byte SocketCAN frame", len(buffer))
+	}
+
+	id := binary.NativeEndian.Uint32(buffer[0:4])
+	if id&(canRTRFlag|canERRFlag) != 0 {
+		return CANFrame{}, false, nil
+	}
+	length := int(buffer[4])
+	if length > len(buffer)-8 {
+		return CANFrame{}, false, fmt.Errorf("frame length %d exceeds the %d-byte frame", length, len(buffer))
+	}
+
+	frame := CANFrame{Time: received, Extended: id&canEFFFlag != 0, Data: append([]byte(nil), buffer[8:8+length]...)}
+	if frame.Extended {
+		frame.ID = id & canEFFMask
+	} else {
+		frame.ID = id & canSFFMask
+	}
+	return frame, true, nil
+}
+
+// GatewayStats counts what one gateway run received and published.
+type GatewayStats struct {
+	Frames        int
+	UnknownFrames int
+	DecodeErrors  int
+	Signals       int
+}
+
+// runGateway decodes every frame of source with decoder and hands every
+// published signal to publish, until ctx is done, the source ends or publish
+// fails. The frame timestamps are kept.
+func runGateway(
+	ctx context.Context,
+	source CANSource,
+	decoder *MessageDecoder,
+	publish func(context.Context, SimulatedSignal, float64, time.Time) error,
+) (GatewayStats, error) {
+	stop := context.AfterFunc(ctx, func() { source.Close() })
+	defer stop()
+
+	stats := GatewayStats{}
+	lastReport := time.Now()
+	for {
+		frame, err := source.ReadFrame()
+		if err != nil {
+			log.Printf("[SIMULATOR_GATEWAY] received %d frames (%d unknown, %d undecodable), %d signals\n", stats.Frames, stats.UnknownFrames, stats.DecodeErrors, stats.Signals)
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return stats, nil
+			}
+			return stats, fmt.Errorf("read CAN frame: %w", err)
+		}
+
+		stats.Frames++
+		decoded, known, err := decoder.Decode(frame)
+		if err != nil {
+			stats.DecodeErrors++
+			log.Printf("[SIMULATOR_GATEWAY] skipping frame 0x%X: %s\n", frame.ID, err.Error())
+			continue
+		}
+		if !known {
+			stats.UnknownFrames++
+			continue
+		}
+		for _, signal := range decoded {
+			if err := publish(ctx, signal.Signal, signal.Value, frame.Time); err != nil {
+				return stats, err
+			}
+			stats.Signals++
+		}
+
+		if time.Since(lastReport) >= gatewayReportInterval {
+			lastReport = time.Now()
+			log.Printf("[SIMULATOR_GATEWAY] received %d frames (%d unknown, %d undecodable), %d signals\n", stats.Frames, stats.UnknownFrames, stats.DecodeErrors, stats.Signals)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCandumpStreamLine(t *testing.T) {
+	now := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		line    string
+		want    CANFrame
+		wantOK  bool
+		wantErr bool
+	}{
+		{
+			name:   "candump -L",
+			line:   "(1436509052.249713) can0 100#1027",
+			want:   CANFrame{Time: time.Unix(1436509052, 249713000).UTC(), ID: 0x100, Data: []byte{0x10, 0x27}},
+			wantOK: true,
+		},
+		{
+			name:   "candump listing",
+			line:   "can0  100   [2]  10 27",
+			want:   CANFrame{Time: now, ID: 0x100, Data: []byte{0x10, 0x27}},
+			wantOK: true,
+		},
+		{
+			name:   "extended listing",
+			line:   "can0  18FF00FA   [1]  01",
+			want:   CANFrame{Time: now, ID: 0x18FF00FA, Extended: true, Data: []byte{0x01}},
+			wantOK: true,
+		},
+		{name: "remote frame", line: "can0  100   [2]  remote request"},
+		{name: "garbage", line: "hello", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := parseCandumpStreamLine(tt.line, now)
+
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCandumpStreamSkipsBadLines(t *testing.T) {
+	stream := newCandumpStream(strings.NewReader("(1.0) can0 100#01\nnot a frame\n\n(2.0) can0 100#R\n(3.0) can0 101#02\n"))
+
+	first, err := stream.ReadFrame()
+	require.NoError(t, err)
+	second, err := stream.ReadFrame()
+	require.NoError(t, err)
+	_, err = stream.ReadFrame()
+
+	assert.Equal(t, uint32(0x100), first.ID)
+	assert.Equal(t, uint32(0x101), second.ID)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestOpenCANSource(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{spec: "-"},
+		{spec: "tcp://127.0.0.1:29536"},
+		{spec: "udp://127.0.0.1:0"},
+		{spec: "socketcan:nonexistent0", wantErr: "nonexistent0"},
+		{spec: "serial:/dev/ttyUSB0", wantErr: "CAN source must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			source, err := OpenCANSource(tt.spec)
+
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, source.Close())
+		})
+	}
+}
+
+func TestParseSocketCANFrame(t *testing.T) {
+	received := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	frame := func(size int, id uint32, data ...byte) []byte {
+		buffer := make([]byte, size)
+		binary.NativeEndian.PutUint32(buffer, id)
+		buffer[4] = byte(len(data))
+		copy(buffer[8:], data)
+		return buffer
+	}
+	tests := []struct {
+		name    string
+		buffer  []byte
+		want    CANFrame
+		wantOK  bool
+		wantErr bool
+	}{
+		{
+			name:   "standard",
+			buffer: frame(canMTU, 0x100, 0x10, 0x27),
+			want:   CANFrame{Time: received, ID: 0x100, Data: []byte{0x10, 0x27}},
+			wantOK: true,
+		},
+		{
+			name:   "extended",
+			buffer: frame(canMTU, 0x18FF00FA|canEFFFlag, 0x01),
+			want:   CANFrame{Time: received, ID: 0x18FF00FA, Extended: true, Data: []byte{0x01}},
+			wantOK: true,
+		},
+		{
+			name:   "CAN FD",
+			buffer: frame(canFDMTU, 0x200, make([]byte, 12)...),
+			want:   CANFrame{Time: received, ID: 0x200, Data: make([]byte, 12)},
+			wantOK: true,
+		},
+		{name: "remote", buffer: frame(canMTU, 0x100|canRTRFlag)},
+		{name: "error", buffer: frame(canMTU, canERRFlag)},
+		{name: "short read", buffer: make([]byte, 8), wantErr: true},
+		{name: "length beyond the frame", buffer: func() []byte { b := frame(canMTU, 0x100); b[4] = 9; return b }(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := parseSocketCANFrame(tt.buffer, received)
+
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+// sliceCANSource replays frames, then reports err, or io.EOF.
+type sliceCANSource struct {
+	frames []CANFrame
+	err    error
+	closed bool
+}
+
+func (s *sliceCANSource) ReadFrame() (CANFrame, error) {
+	if len(s.frames) == 0 {
+		if s.err != nil {
+			return CANFrame{}, s.err
+		}
+		return CANFrame{}, io.EOF
+	}
+	frame := s.frames[0]
+	s.frames = s.frames[1:]
+	return frame, nil
+}
+
+func (s *sliceCANSource) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestRunGateway(t *testing.T) {
+	frames, decoder := replayFixture()
+	source := &sliceCANSource{frames: frames}
+	var published []replayedSignal
+
+	stats, err := runGateway(context.Background(), source, decoder, func(_ context.Context, signal SimulatedSignal, value float64, timestamp time.Time) error {
+		published = append(published, replayedSignal{topic: signal.Topic, value: value, timestamp: timestamp})
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, GatewayStats{Frames: 4, UnknownFrames: 1, DecodeErrors: 1, Signals: 2}, stats)
+	assert.Equal(t, []replayedSignal{
+		{topic: "data/powertrain/engine/speed", value: 2500, timestamp: frames[0].Time},
+		{topic: "data/powertrain/engine/speed", value: 5000, timestamp: frames[3].Time},
+	}, published, "frames keep their own timestamps")
+}
+
+func TestRunGatewayErrors(t *testing.T) {
+	frames, decoder := replayFixture()
+	tests := []struct {
+		name    string
+		source  *sliceCANSource
+		publish error
+		wantErr string
+	}{
+		{name: "source fails", source: &sliceCANSource{err: errors.New("bus off")}, wantErr: "read CAN frame: bus off"},
+		{name: "publish fails", source: &sliceCANSource{frames: frames}, publish: errors.New("broker gone"), wantErr: "broker gone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runGateway(context.Background(), tt.source, decoder, func(context.Context, SimulatedSignal, float64, time.Time) error {
+				return tt.publish
+			})
+
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestGatewayTCPSource(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		// The first connection drops after one frame; the gateway dials again
+		// and gets the second.
+		for _, line := range []string{"(1.0) can0 100#1027\n", "(2.0) can0 100#204E\n"} {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(line))
+			conn.Close()
+		}
+	}()
+
+	source, err := OpenCANSource("tcp://" + listener.Addr().String())
+	require.NoError(t, err)
+	_, decoder := replayFixture()
+	received := make(chan float64, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := runGateway(ctx, source, decoder, func(_ context.Context, _ SimulatedSignal, value float64, _ time.Time) error {
+			received <- value
+			return nil
+		})
+		done <- err
+	}()
+
+	assert.Equal(t, 2500.0, <-received)
+	assert.Equal(t, 5000.0, <-received)
+	cancel()
+	require.NoError(t, <-done, "cancelling stops the gateway cleanly")
+}
+
+func TestGatewayUDPSource(t *testing.T) {
+	source, err := OpenCANSource("udp://127.0.0.1:0")
+	require.NoError(t, err)
+	defer source.Close()
+	address := source.(*streamCANSource).closer.(net.PacketConn).LocalAddr()
+
+	sender, err := net.Dial("udp", address.String())
+	require.NoError(t, err)
+	defer sender.Close()
+	_, err = sender.Write([]byte("(1.0) can0 100#1027\n(2.0) can0 100#204E"))
+	require.NoError(t, err)
+
+	first, err := source.ReadFrame()
+	require.NoError(t, err)
+	second, err := source.ReadFrame()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x10, 0x27}, first.Data)
+	assert.Equal(t, []byte{0x20, 0x4E}, second.Data, "a datagram without a final newline still ends its line")
+}
+
+func TestGatewayStdinSourceStopsOnCancel(t *testing.T) {
+	// Like a terminal, the pipe is never closed and a read on it blocks.
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	source := newReadAheadCANSource(reader)
+	_, decoder := replayFixture()
+	received := make(chan float64, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := runGateway(ctx, source, decoder, func(_ context.Context, _ SimulatedSignal, value float64, _ time.Time) error {
+			received <- value
+			return nil
+		})
+		done <- err
+	}()
+
+	_, err := writer.Write([]byte("(1.0) can0 100#1027\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 2500.0, <-received)
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err, "cancelling stops the gateway cleanly")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the gateway is still waiting for standard input")
+	}
+}
+
+func TestReadAheadCANSourceEndsWithStream(t *testing.T) {
+	source := newReadAheadCANSource(strings.NewReader("(1.0) can0 100#01\n"))
+
+	frame, err := source.ReadFrame()
+	require.NoError(t, err)
+	_, err = source.ReadFrame()
+	assert.Equal(t, []byte{0x01}, frame.Data)
+	assert.ErrorIs(t, err, io.EOF)
+	_, err = source.ReadFrame()
+	assert.ErrorIs(t, err, io.EOF, "reading past the end does not block")
+}
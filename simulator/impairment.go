@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxLinkQueue is how far a bandwidth-capped link may fall behind before
+	// it drops new transmissions, like the buffer of a radio modem.
+	maxLinkQueue = 5 * time.Second
+	// minReorderDelay is the least extra delay of a reordered transmission.
+	minReorderDelay = 50 * time.Millisecond
+)
+
+// ImpairmentProfile describes the radio link between the car and the pit.
+// Profile files are YAML (or JSON, which YAML accepts):
+//
+//	name: far end of the track
+//	latency: 150ms
+//	jitter: 100ms
+//	loss: 0.05            # fraction of transmissions lost
+//	outage_every: 2m      # mean time between burst outages
+//	outage_duration: 8s
+//	reorder: 0.02         # fraction of transmissions overtaken by later ones
+//	timestamp_skew: -1.5s # offset of the car's clock
+//	bandwidth: 64000      # bits per second
+type ImpairmentProfile struct {
+	Name           string        `yaml:"name"`
+	Latency        time.Duration `yaml:"latency"`
+	Jitter         time.Duration `yaml:"jitter"`
+	Loss           float64       `yaml:"loss"`
+	OutageEvery    time.Duration `yaml:"outage_every"`
+	OutageDuration time.Duration `yaml:"outage_duration"`
+	Reorder        float64       `yaml:"reorder"`
+	TimestampSkew  time.Duration `yaml:"timestamp_skew"`
+	Bandwidth      int64         `yaml:"bandwidth"`
+}
+
+// impairmentProfiles are the built-in profiles --impairment accepts by name.
+var impairmentProfiles = map[string]ImpairmentProfile{
+	"good": {Name: "good", Latency: 20 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 0.001},
+	"lossy": {
+		Name: "lossy", Latency: 80 * time.Millisecond, Jitter: 40 * time.Millisecond,
+		Loss: 0.05, Reorder: 0.02, Bandwidth: 256_000,
+	},
+	"degraded": {
+		Name: "degraded", Latency: 200 * time.Millisecond, Jitter: 150 * time.Millisecond,
+		Loss: 0.15, OutageEvery: time.Minute, OutageDuration: 5 * time.Second,
+		Reorder: 0.05, Bandwidth: 64_000,
+	},
+	"outages": {
+		Name: "outages", Latency: 50 * time.Millisecond, Jitter: 20 * time.Millisecond,
+		OutageEvery: 30 * time.Second, OutageDuration: 10 * time.Second,
+	},
+}
+
+// LoadImpairmentProfile returns the built-in profile called nameOrPath, or
+// reads the profile file at that path.
+func LoadImpairmentProfile(nameOrPath string) (ImpairmentProfile, error) {
+	if profile, ok := impairmentProfiles[strings.ToLower(nameOrPath)]; ok {
+		return profile, nil
+	}
+
+	contents, err := os.ReadFile(nameOrPath)
+	if err != nil {
+		names := make([]string, 0, len(impairmentProfiles))
+		for name := range impairmentProfiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return ImpairmentProfile{}, fmt.Errorf("%q is neither a built-in profile (%s) nor a readable file: %w", nameOrPath, strings.Join(names, ", "), err)
+	}
+	return parseImpairmentProfile(contents)
+}
+
+func parseImpairmentProfile(contents []byte) (ImpairmentProfile, error) {
+	var profile ImpairmentProfile
+	decoder := yaml.NewDecoder(strings.NewReader(string(contents)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&profile); err != nil {
+		return ImpairmentProfile{}, fmt.Errorf("decode impairment profile: %w", err)
+	}
+	if err := profile.validate(); err != nil {
+		return ImpairmentProfile{}, err
+	}
+	return profile, nil
+}
+
+func (p ImpairmentProfile) validate() error {
+	if p.Latency < 0 || p.Jitter < 0 || p.OutageEvery < 0 || p.OutageDuration < 0 {
+		return errors.New("latency, jitter and outage times cannot be negative")
+	}
+	if p.Loss < 0 || p.Loss > 1 || p.Reorder < 0 || p.Reorder > 1 {
+		return errors.New("loss and reorder must be fractions between 0 and 1")
+	}
+	if (p.OutageEvery > 0) != (p.OutageDuration > 0) {
+		return errors.New("outage_every and outage_duration must be set together")
+	}
+	if p.Bandwidth < 0 {
+		return errors.New("bandwidth cannot be negative")
+	}
+	return nil
+}
+
+func (p ImpairmentProfile) String() string {
+	return fmt.Sprintf("%s: latency %s ±%s, loss %g, outages of %s every %s, reorder %g, skew %s, %d bit/s",
+		p.Name, p.Latency, p.Jitter, p.Loss, p.OutageDuration, p.OutageEvery, p.Reorder, p.TimestampSkew, p.Bandwidth)
+}
+
+// Link decides the fate of every transmission over one impaired link: lost,
+// or delivered after a delay. A nil Link is a perfect link.
+type Link struct {
+	profile ImpairmentProfile
+	rng     *rand.Rand
+	now     func() time.Time
+
+	mu          sync.Mutex
+	busyUntil   time.Time
+	outageUntil time.Time
+	nextOutage  time.Time
+}
+
+func NewLink(profile ImpairmentProfile, rng *rand.Rand) *Link {
+	return &Link{profile: profile, rng: rng, now: time.Now}
+}
+
+// transmit returns how long size bytes take to arrive, or false when the link
+// loses them to an outage, random loss or a full queue.
+func (l *Link) transmit(size int) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if l.profile.OutageEvery > 0 {
+		if l.nextOutage.IsZero() {
+			l.nextOutage = now.Add(l.exponential(l.profile.OutageEvery))
+		}
+		for !now.Before(l.nextOutage) {
+			l.outageUntil = l.nextOutage.Add(l.profile.OutageDuration)
+			l.nextOutage = l.outageUntil.Add(l.exponential(l.profile.OutageEvery))
+		}
+		if now.Before(l.outageUntil) {
+			return 0, false
+		}
+	}
+	if l.rng.Float64() < l.profile.Loss {
+		return 0, false
+	}
+
+	departure := now
+	if l.profile.Bandwidth > 0 {
+		start := now
+		if l.busyUntil.After(now) {
+			start = l.busyUntil
+		}
+		if start.Sub(now) > maxLinkQueue {
+			return 0, false
+		}
+		departure = start.Add(time.Duration(float64(8*size) / float64(l.profile.Bandwidth) * float64(time.Second)))
+		l.busyUntil = departure
+	}
+
+	delay := departure.Sub(now) + l.profile.Latency
+	if l.profile.Jitter > 0 {
+		delay += time.Duration((l.rng.Float64()*2 - 1) * float64(l.profile.Jitter))
+	}
+	if l.rng.Float64() < l.profile.Reorder {
+		delay += max(l.profile.Latency+2*l.profile.Jitter, minReorderDelay)
+	}
+	return max(delay, 0), true
+}
+
+// exponential draws the time to the next outage, so outages come at random
+// but mean apart.
+func (l *Link) exponential(mean time.Duration) time.Duration {
+	return time.Duration(l.rng.ExpFloat64() * float64(mean))
+}
+
+// skew shifts a sample timestamp by the offset of the car's clock.
+func (l *Link) skew(timestamp time.Time) time.Time {
+	if l == nil {
+		return timestamp
+	}
+	return timestamp.Add(l.profile.TimestampSkew)
+}
+
+// ImpairedPublisher sends every publish over a Link. Publish returns at once;
+// the message reaches the wrapped publisher after the link delay, so later
+// messages can overtake it, or never when the link loses it.
+type ImpairedPublisher struct {
+	publisher Publisher
+	link      *Link
+	pending   sync.WaitGroup
+}
+
+func NewImpairedPublisher(publisher Publisher, link *Link) *ImpairedPublisher {
+	return &ImpairedPublisher{publisher: publisher, link: link}
+}
+
+func (p *ImpairedPublisher) Publish(_ context.Context, topic string, payload []byte, options ...PublishOption) error {
+	delay, ok := p.link.transmit(len(topic) + len(payload))
+	if !ok {
+		return nil
+	}
+
+	p.pending.Add(1)
+	time.AfterFunc(delay, func() {
+		defer p.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := p.publisher.Publish(ctx, topic, payload, options...); err != nil {
+			log.Printf("[SIMULATOR_LINK] couldn't deliver to %s: %s\n", topic, err.Error())
+		}
+	})
+	return nil
+}
+
+// Close waits for the messages still crossing the link.
+func (p *ImpairedPublisher) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("deliver delayed publishes: %w", ctx.Err())
+	}
+}
+
+// errLinkLost is returned for InfluxDB writes the link loses. It is
+// retryable, as a real HTTP request would time out and be sent again.
+var errLinkLost = errors.New("the radio link lost the request")
+
+// impairedLineWriter sends InfluxDB writes over a Link, waiting out its delay.
+type impairedLineWriter struct {
+	writer lineWriter
+	link   *Link
+}
+
+func (w impairedLineWriter) WriteLines(ctx context.Context, lines []byte) error {
+	delay, ok := w.link.transmit(len(lines))
+	if !ok {
+		return errLinkLost
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return w.writer.WriteLines(ctx, lines)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLink(profile ImpairmentProfile) (*Link, *time.Time) {
+	now := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	link := NewLink(profile, newRand(1))
+	link.now = func() time.Time { return now }
+	return link, &now
+}
+
+func TestLoadImpairmentProfile(t *testing.T) {
+	profile, err := LoadImpairmentProfile("Degraded")
+	require.NoError(t, err)
+	assert.Equal(t, impairmentProfiles["degraded"], profile)
+
+	path := filepath.Join(t.TempDir(), "track.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("name: far end\nlatency: 150ms\njitter: 100ms\nloss: 0.05\noutage_every: 2m\noutage_duration: 8s\ntimestamp_skew: -1.5s\nbandwidth: 64000\n"), 0o644))
+	profile, err = LoadImpairmentProfile(path)
+	require.NoError(t, err)
+	assert.Equal(t, ImpairmentProfile{
+		Name: "far end", Latency: 150 * time.Millisecond, Jitter: 100 * time.Millisecond, Loss: 0.05,
+		OutageEvery: 2 * time.Minute, OutageDuration: 8 * time.Second, TimestampSkew: -1500 * time.Millisecond, Bandwidth: 64000,
+	}, profile)
+
+	_, err = LoadImpairmentProfile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "is neither a built-in profile (degraded, good, lossy, outages) nor a readable file")
+}
+
+func TestParseImpairmentProfileRejectsInvalidProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{name: "unknown field", contents: "latnecy: 1s", wantErr: "field latnecy not found"},
+		{name: "negative latency", contents: "latency: -1s", wantErr: "latency, jitter and outage times cannot be negative"},
+		{name: "loss above one", contents: "loss: 5", wantErr: "loss and reorder must be fractions between 0 and 1"},
+		{name: "half an outage", contents: "outage_every: 1m", wantErr: "outage_every and outage_duration must be set together"},
+		{name: "negative bandwidth", contents: "bandwidth: -1", wantErr: "bandwidth cannot be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseImpairmentProfile([]byte(tt.contents))
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLinkLatencyAndJitter(t *testing.T) {
+	link, _ := newTestLink(ImpairmentProfile{Latency: 100 * time.Millisecond, Jitter: 30 * time.Millisecond})
+
+	for range 100 {
+		delay, ok := link.transmit(10)
+		require.True(t, ok)
+		assert.GreaterOrEqual(t, delay, 70*time.Millisecond)
+		assert.LessOrEqual(t, delay, 130*time.Millisecond)
+	}
+
+	perfect, _ := newTestLink(ImpairmentProfile{})
+	delay, ok := perfect.transmit(10)
+	assert.True(t, ok)
+	assert.Zero(t, delay)
+}
+
+func TestLinkLossAndReorder(t *testing.T) {
+	lossy, _ := newTestLink(ImpairmentProfile{Loss: 0.25})
+	lost := 0
+	for range 1000 {
+		if _, ok := lossy.transmit(10); !ok {
+			lost++
+		}
+	}
+	assert.InDelta(t, 250, lost, 50)
+
+	reordering, _ := newTestLink(ImpairmentProfile{Latency: 40 * time.Millisecond, Reorder: 1})
+	delay, ok := reordering.transmit(10)
+	require.True(t, ok)
+	assert.Equal(t, 40*time.Millisecond+minReorderDelay, delay, "reordered transmissions wait long enough to be overtaken")
+}
+
+func TestLinkOutages(t *testing.T) {
+	link, now := newTestLink(ImpairmentProfile{OutageEvery: time.Minute, OutageDuration: 10 * time.Second})
+
+	delivered := make(map[bool]int)
+	var longestOutage, outage time.Duration
+	for range 3600 {
+		_, ok := link.transmit(10)
+		delivered[ok]++
+		if ok {
+			outage = 0
+		} else {
+			outage += time.Second
+			longestOutage = max(longestOutage, outage)
+		}
+		*now = now.Add(time.Second)
+	}
+
+	assert.InDelta(t, 3600*10/70, delivered[false], 200, "about 10s of every 70s are lost")
+	assert.LessOrEqual(t, longestOutage, 20*time.Second, "outages last their duration, or two if they follow each other")
+}
+
+func TestLinkBandwidth(t *testing.T) {
+	// 1000 bytes take a second at 8000 bit/s.
+	link, now := newTestLink(ImpairmentProfile{Bandwidth: 8000})
+
+	first, ok := link.transmit(1000)
+	require.True(t, ok)
+	second, ok := link.transmit(1000)
+	require.True(t, ok)
+
+	assert.Equal(t, time.Second, first)
+	assert.Equal(t, 2*time.Second, second, "transmissions queue behind each other")
+
+	for range 4 {
+		_, ok = link.transmit(1000)
+		require.True(t, ok)
+	}
+	_, ok = link.transmit(1000)
+	assert.False(t, ok, "a link more than maxLinkQueue behind drops transmissions")
+
+	*now = now.Add(time.Minute)
+	delay, ok := link.transmit(1000)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, delay, "the queue drains over time")
+}
+
+func TestLinkSkew(t *testing.T) {
+	timestamp := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	link, _ := newTestLink(ImpairmentProfile{TimestampSkew: -1500 * time.Millisecond})
+
+	assert.Equal(t, timestamp.Add(-1500*time.Millisecond), link.skew(timestamp))
+	assert.Equal(t, timestamp, (*Link)(nil).skew(timestamp), "a nil link is perfect")
+}
+
+func TestImpairedPublisher(t *testing.T) {
+	broker := &recordingPublisher{}
+	publisher := NewImpairedPublisher(broker, NewLink(ImpairmentProfile{Latency: 20 * time.Millisecond}, newRand(1)))
+
+	require.NoError(t, publisher.Publish(context.Background(), "data/a", []byte("1"), WithRetain(true)))
+	broker.mu.Lock()
+	assert.Empty(t, broker.published, "Publish returns before the link delivers")
+	broker.mu.Unlock()
+
+	require.NoError(t, publisher.Close(context.Background()))
+	require.Len(t, broker.published, 1)
+	assert.Equal(t, "data/a", broker.published[0].Topic)
+	assert.True(t, broker.published[0].Options.Retain)
+
+	dropped := &recordingPublisher{}
+	lossy := NewImpairedPublisher(dropped, NewLink(ImpairmentProfile{Loss: 1}, newRand(1)))
+	require.NoError(t, lossy.Publish(context.Background(), "data/a", []byte("1")), "lost messages are not errors")
+	require.NoError(t, lossy.Close(context.Background()))
+	assert.Empty(t, dropped.published)
+}
+
+func TestImpairedLineWriter(t *testing.T) {
+	influx := &recordingLineWriter{}
+
+	err := impairedLineWriter{writer: influx, link: NewLink(ImpairmentProfile{Loss: 1}, newRand(1))}.WriteLines(context.Background(), []byte("a 1\n"))
+	assert.ErrorIs(t, err, errLinkLost)
+	assert.True(t, isRetryable(err), "lost writes are retried")
+
+	require.NoError(t, impairedLineWriter{writer: influx, link: NewLink(ImpairmentProfile{Latency: time.Millisecond}, newRand(1))}.WriteLines(context.Background(), []byte("a 1\n")))
+	assert.Equal(t, []string{"a 1\n"}, influx.recorded())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = impairedLineWriter{writer: influx, link: NewLink(ImpairmentProfile{Latency: time.Hour}, newRand(1))}.WriteLines(ctx, []byte("b 2\n"))
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +12,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ApexCorse/ephoros/schema"
 )
 
 const (
@@ -28,9 +30,14 @@ type InfluxWriter struct {
 	org     string
 	bucket  string
 	client  *http.Client
+	// gzip compresses request bodies with Content-Encoding: gzip.
+	gzip bool
 }
 
-func NewInfluxWriterFromEnvironment() (*InfluxWriter, error) {
+// NewInfluxWriterFromEnvironment configures the writer from the INFLUXDB_*
+// variables. A non-empty tokenFile replaces INFLUXDB_TOKEN, and tlsOptions
+// apply to https URLs.
+func NewInfluxWriterFromEnvironment(tokenFile string, tlsOptions TLSOptions) (*InfluxWriter, error) {
 	baseURL := environmentOrDefault("INFLUXDB_URL", defaultInfluxDBURL)
 	parsedURL, err := url.Parse(baseURL)
 	if err != nil {
@@ -41,8 +48,25 @@ func NewInfluxWriterFromEnvironment() (*InfluxWriter, error) {
 	}
 
 	token := os.Getenv("INFLUXDB_TOKEN")
+	if tokenFile != "" {
+		token, err = readSecretFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read InfluxDB token file: %w", err)
+		}
+	}
 	if token == "" {
-		return nil, fmt.Errorf("INFLUXDB_TOKEN env var is not set")
+		return nil, fmt.Errorf("INFLUXDB_TOKEN env var is not set and no token file was given")
+	}
+
+	client := http.DefaultClient
+	tlsConfig, err := tlsOptions.Config()
+	if err != nil {
+		return nil, fmt.Errorf("configure InfluxDB TLS: %w", err)
+	}
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client = &http.Client{Transport: transport}
 	}
 
 	return &InfluxWriter{
@@ -50,24 +74,33 @@ func NewInfluxWriterFromEnvironment() (*InfluxWriter, error) {
 		token:   token,
 		org:     environmentOrDefault("INFLUXDB_INIT_ORG", defaultInfluxDBOrg),
 		bucket:  environmentOrDefault("INFLUXDB_INIT_BUCKET", defaultInfluxDBBucket),
-		client:  http.DefaultClient,
+		client:  client,
+		gzip:    os.Getenv("INFLUXDB_GZIP") == "true",
 	}, nil
 }
 
-func (w *InfluxWriter) Write(ctx context.Context, topic string, payload []byte) error {
-	var data struct {
-		Value float32 `json:"value"`
-		Time  string  `json:"time"`
-	}
-	if err := json.Unmarshal(payload, &data); err != nil {
-		return fmt.Errorf("decode simulated payload: %w", err)
+func (w *InfluxWriter) Write(ctx context.Context, signal SimulatedSignal, encoding PayloadEncoding, payload []byte) error {
+	line, err := influxLine(signal, encoding, payload)
+	if err != nil {
+		return err
 	}
 
-	timestamp, err := parseTimestamp(data.Time)
+	return w.WriteLines(ctx, []byte(line))
+}
+
+// influxLine converts a simulated MQTT payload to one line of line protocol,
+// tagged like the firmware tags the signal.
+func influxLine(signal SimulatedSignal, encoding PayloadEncoding, payload []byte) (string, error) {
+	sample, err := encoding.Decode(payload)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("decode simulated payload: %w", err)
 	}
 
+	return schema.Line(signal.influxTags(sample.Unit), sample.Value, sample.Time), nil
+}
+
+// WriteLines posts newline-terminated line protocol in a single request.
+func (w *InfluxWriter) WriteLines(ctx context.Context, lines []byte) error {
 	writeURL := w.baseURL.ResolveReference(&url.URL{Path: "/api/v2/write"})
 	query := writeURL.Query()
 	query.Set("org", w.org)
@@ -75,17 +108,24 @@ func (w *InfluxWriter) Write(ctx context.Context, topic string, payload []byte)
 	query.Set("precision", "ns")
 	writeURL.RawQuery = query.Encode()
 
-	line := fmt.Sprintf("can_signal,topic=%s value=%s %d\n",
-		escapeInfluxTag(topic),
-		strconv.FormatFloat(float64(data.Value), 'g', -1, 32),
-		timestamp.UnixNano(),
-	)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, writeURL.String(), strings.NewReader(line))
+	var body io.Reader = bytes.NewReader(lines)
+	if w.gzip {
+		compressed, err := gzipBytes(lines)
+		if err != nil {
+			return fmt.Errorf("compress InfluxDB write request: %w", err)
+		}
+		body = bytes.NewReader(compressed)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, writeURL.String(), body)
 	if err != nil {
 		return fmt.Errorf("create InfluxDB write request: %w", err)
 	}
 	req.Header.Set("Authorization", "Token "+w.token)
 	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 
 	response, err := w.client.Do(req)
 	if err != nil {
@@ -94,12 +134,71 @@ func (w *InfluxWriter) Write(ctx context.Context, topic string, payload []byte)
 	defer response.Body.Close()
 	if response.StatusCode >= http.StatusMultipleChoices {
 		body, _ := io.ReadAll(io.LimitReader(response.Body, 4<<10))
-		return fmt.Errorf("InfluxDB returned %s: %s", response.Status, bytes.TrimSpace(body))
+		return &InfluxStatusError{
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			Body:       string(bytes.TrimSpace(body)),
+			retryAfter: parseRetryAfter(response.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
 	return nil
 }
 
+// InfluxStatusError is returned when InfluxDB answers a write with a non-2xx
+// status.
+type InfluxStatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	retryAfter time.Duration
+}
+
+func (e *InfluxStatusError) Error() string {
+	return fmt.Sprintf("InfluxDB returned %s: %s", e.Status, e.Body)
+}
+
+// Temporary reports whether the same write may succeed later: InfluxDB
+// rate limiting and server-side failures are, rejected line protocol is not.
+func (e *InfluxStatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// RetryAfter is the delay requested by the server's Retry-After header.
+func (e *InfluxStatusError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// parseRetryAfter accepts both delay-seconds and HTTP-date values.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
 func environmentOrDefault(name, fallback string) string {
 	if value := os.Getenv(name); value != "" {
 		return value
@@ -114,8 +213,3 @@ func parseTimestamp(value string) (time.Time, error) {
 	}
 	return timestamp, nil
 }
-
-func escapeInfluxTag(value string) string {
-	replacer := strings.NewReplacer("\\", "\\\\", ",", "\\,", "=", "\\=", " ", "\\ ")
-	return replacer.Replace(value)
-}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInfluxBatchSize     = 5000
+	defaultInfluxFlushInterval = time.Second
+	defaultInfluxMaxPending    = 50000
+	influxFlushTimeout         = 10 * time.Second
+	// maxInfluxBatchErrors bounds the errors retained for Close, so a long
+	// InfluxDB outage cannot grow memory without limit.
+	maxInfluxBatchErrors = 16
+)
+
+// PointWriter stores one simulated MQTT payload for its signal. Both the
+// direct InfluxWriter and the InfluxBatchWriter implement it.
+type PointWriter interface {
+	Write(ctx context.Context, signal SimulatedSignal, encoding PayloadEncoding, payload []byte) error
+}
+
+// lineWriter sends a block of line protocol to InfluxDB.
+type lineWriter interface {
+	WriteLines(ctx context.Context, lines []byte) error
+}
+
+// InfluxBatchOptions bounds how many lines a batch carries, how long a line
+// may wait before it is sent and how many lines may be queued at once.
+type InfluxBatchOptions struct {
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxPending    int
+}
+
+// InfluxBatchOptionsFromEnvironment reads INFLUXDB_BATCH_SIZE,
+// INFLUXDB_FLUSH_INTERVAL (milliseconds) and INFLUXDB_MAX_PENDING.
+func InfluxBatchOptionsFromEnvironment() (InfluxBatchOptions, error) {
+	options := InfluxBatchOptions{
+		BatchSize:     defaultInfluxBatchSize,
+		FlushInterval: defaultInfluxFlushInterval,
+		MaxPending:    defaultInfluxMaxPending,
+	}
+
+	for _, setting := range []struct {
+		name   string
+		assign func(int)
+	}{
+		{"INFLUXDB_BATCH_SIZE", func(value int) { options.BatchSize = value }},
+		{"INFLUXDB_FLUSH_INTERVAL", func(value int) { options.FlushInterval = time.Duration(value) * time.Millisecond }},
+		{"INFLUXDB_MAX_PENDING", func(value int) { options.MaxPending = value }},
+	} {
+		raw := os.Getenv(setting.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			return InfluxBatchOptions{}, fmt.Errorf("%s must be a positive integer", setting.name)
+		}
+		setting.assign(value)
+	}
+
+	return options, nil
+}
+
+// InfluxBatchWriter queues points and writes them from a background goroutine
+// in batches, flushed whenever BatchSize lines are pending or FlushInterval
+// elapses. Write blocks while MaxPending lines are queued.
+type InfluxBatchWriter struct {
+	writer  lineWriter
+	options InfluxBatchOptions
+	lines   chan string
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	errMu         sync.Mutex
+	errs          []error
+	droppedErrors int
+	batches       int
+}
+
+func NewInfluxBatchWriter(writer lineWriter, options InfluxBatchOptions) *InfluxBatchWriter {
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultInfluxBatchSize
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = defaultInfluxFlushInterval
+	}
+	if options.MaxPending < options.BatchSize {
+		options.MaxPending = options.BatchSize
+	}
+
+	w := &InfluxBatchWriter{
+		writer:  writer,
+		options: options,
+		lines:   make(chan string, options.MaxPending),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write validates payload and queues it. Errors from sending the batch are
+// logged as they happen and reported together by Close.
+func (w *InfluxBatchWriter) Write(ctx context.Context, signal SimulatedSignal, encoding PayloadEncoding, payload []byte) error {
+	line, err := influxLine(signal, encoding, payload)
+	if err != nil {
+		return err
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return errors.New("InfluxDB batch writer is closed")
+	}
+
+	select {
+	case w.lines <- line:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes every queued line and returns the errors of all failed
+// batches. It gives up waiting when ctx is done.
+func (w *InfluxBatchWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.lines)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		return fmt.Errorf("flush InfluxDB batches: %w", ctx.Err())
+	}
+
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	errs := append([]error(nil), w.errs...)
+	if w.droppedErrors > 0 {
+		errs = append(errs, fmt.Errorf("%d more InfluxDB batches failed", w.droppedErrors))
+	}
+	return errors.Join(errs...)
+}
+
+func (w *InfluxBatchWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.options.FlushInterval)
+	defer ticker.Stop()
+
+	var batch bytes.Buffer
+	pending := 0
+	flush := func() {
+		if pending == 0 {
+			return
+		}
+		w.flush(batch.Bytes(), pending)
+		batch.Reset()
+		pending = 0
+	}
+
+	for {
+		select {
+		case line, ok := <-w.lines:
+			if !ok {
+				flush()
+				return
+			}
+			batch.WriteString(line)
+			pending++
+			if pending >= w.options.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (w *InfluxBatchWriter) flush(lines []byte, count int) {
+	ctx, cancel := context.WithTimeout(context.Background(), influxFlushTimeout)
+	defer cancel()
+
+	err := w.writer.WriteLines(ctx, lines)
+
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	w.batches++
+	if err == nil {
+		return
+	}
+	err = fmt.Errorf("batch %d (%d lines): %w", w.batches, count, err)
+	log.Printf("[SIMULATOR_INFLUX] %s\n", err.Error())
+	if len(w.errs) < maxInfluxBatchErrors {
+		w.errs = append(w.errs, err)
+	} else {
+		w.droppedErrors++
+	}
+}
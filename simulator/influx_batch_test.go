@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLineWriter struct {
+	mu      sync.Mutex
+	batches []string
+	err     error
+	block   chan struct{}
+}
+
+func (w *recordingLineWriter) WriteLines(_ context.Context, lines []byte) error {
+	if w.block != nil {
+		<-w.block
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.batches = append(w.batches, string(lines))
+	return w.err
+}
+
+func (w *recordingLineWriter) recorded() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.batches...)
+}
+
+func simulatedPayload(value int) []byte {
+	return []byte(`{"value":` + strings.Repeat("1", value) + `,"time":"2026-08-10T12:30:00Z","unit":"V"}`)
+}
+
+func TestInfluxBatchOptionsFromEnvironment(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment map[string]string
+		want        InfluxBatchOptions
+		wantErr     string
+	}{
+		{
+			name: "defaults",
+			want: InfluxBatchOptions{BatchSize: defaultInfluxBatchSize, FlushInterval: defaultInfluxFlushInterval, MaxPending: defaultInfluxMaxPending},
+		},
+		{
+			name:        "custom values",
+			environment: map[string]string{"INFLUXDB_BATCH_SIZE": "100", "INFLUXDB_FLUSH_INTERVAL": "250", "INFLUXDB_MAX_PENDING": "1000"},
+			want:        InfluxBatchOptions{BatchSize: 100, FlushInterval: 250 * time.Millisecond, MaxPending: 1000},
+		},
+		{name: "invalid", environment: map[string]string{"INFLUXDB_BATCH_SIZE": "many"}, wantErr: "INFLUXDB_BATCH_SIZE must be a positive integer"},
+		{name: "zero", environment: map[string]string{"INFLUXDB_FLUSH_INTERVAL": "0"}, wantErr: "INFLUXDB_FLUSH_INTERVAL must be a positive integer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"INFLUXDB_BATCH_SIZE", "INFLUXDB_FLUSH_INTERVAL", "INFLUXDB_MAX_PENDING"} {
+				t.Setenv(name, tt.environment[name])
+			}
+
+			got, err := InfluxBatchOptionsFromEnvironment()
+
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestInfluxBatchWriterFlushesBySize(t *testing.T) {
+	lines := &recordingLineWriter{}
+	writer := NewInfluxBatchWriter(lines, InfluxBatchOptions{BatchSize: 2, FlushInterval: time.Hour})
+
+	for value := 1; value <= 5; value++ {
+		require.NoError(t, writer.Write(context.Background(), SimulatedSignal{Topic: "data/battery/voltage"}, jsonEncoding{}, simulatedPayload(value)))
+	}
+	require.NoError(t, writer.Close(context.Background()))
+
+	batches := lines.recorded()
+	require.Len(t, batches, 3)
+	assert.Equal(t, 2, strings.Count(batches[0], "\n"))
+	assert.Equal(t, 2, strings.Count(batches[1], "\n"))
+	assert.Equal(t, "can_signal,topic=data/battery/voltage,unit=V value=11111 1786365000000000000\n", batches[2], "Close flushes the remainder")
+}
+
+func TestInfluxBatchWriterFlushesByInterval(t *testing.T) {
+	lines := &recordingLineWriter{}
+	writer := NewInfluxBatchWriter(lines, InfluxBatchOptions{BatchSize: 100, FlushInterval: 5 * time.Millisecond})
+	defer writer.Close(context.Background())
+
+	require.NoError(t, writer.Write(context.Background(), SimulatedSignal{Topic: "data/battery/voltage"}, jsonEncoding{}, simulatedPayload(1)))
+
+	assert.Eventually(t, func() bool { return len(lines.recorded()) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestInfluxBatchWriterReportsBatchErrors(t *testing.T) {
+	writeErr := errors.New("InfluxDB returned 503 Service Unavailable")
+	lines := &recordingLineWriter{err: writeErr}
+	writer := NewInfluxBatchWriter(lines, InfluxBatchOptions{BatchSize: 1, FlushInterval: time.Hour})
+
+	require.NoError(t, writer.Write(context.Background(), SimulatedSignal{Topic: "data/a"}, jsonEncoding{}, simulatedPayload(1)))
+	require.NoError(t, writer.Write(context.Background(), SimulatedSignal{Topic: "data/b"}, jsonEncoding{}, simulatedPayload(2)))
+	err := writer.Close(context.Background())
+
+	require.ErrorIs(t, err, writeErr)
+	assert.Contains(t, err.Error(), "batch 1 (1 lines)")
+	assert.Contains(t, err.Error(), "batch 2 (1 lines)")
+}
+
+func TestInfluxBatchWriterBoundsRetainedErrors(t *testing.T) {
+	lines := &recordingLineWriter{err: errors.New("unavailable")}
+	writer := NewInfluxBatchWriter(lines, InfluxBatchOptions{BatchSize: 1, FlushInterval: time.Hour})
+
+	for range maxInfluxBatchErrors + 3 {
+		require.NoError(t, writer.Write(context.Background(), SimulatedSignal{Topic: "data/a"}, jsonEncoding{}, simulatedPayload(1)))
+	}
+	err := writer.Close(context.Background())
+
+	require.Error(t, err)
+	assert.Equal(t, maxInfluxBatchErrors, strings.Count(err.Error(), "unavailable"))
+	assert.Contains(t, err.Error(), "3 more InfluxDB batches failed")
+}
+
+func TestInfluxBatchWriterRejectsInvalidAndLateWrites(t *testing.T) {
+	writer := NewInfluxBatchWriter(&recordingLineWriter{}, InfluxBatchOptions{})
+
+	require.ErrorContains(t, writer.Write(context.Background(), SimulatedSignal{Topic: "data/a"}, jsonEncoding{}, []byte("{")), "decode simulated payload")
+	require.NoError(t, writer.Close(context.Background()))
+	require.NoError(t, writer.Close(context.Background()), "Close is idempotent")
+	require.EqualError(t, writer.Write(context.Background(), SimulatedSignal{Topic: "data/a"}, jsonEncoding{}, simulatedPayload(1)), "InfluxDB batch writer is closed")
+}
+
+func TestInfluxBatchWriterBlocksWhenFull(t *testing.T) {
+	lines := &recordingLineWriter{block: make(chan struct{})}
+	writer := NewInfluxBatchWriter(lines, InfluxBatchOptions{BatchSize: 1, MaxPending: 1, FlushInterval: time.Hour})
+
+	// The first line is taken by the blocked flush, the second fills the queue.
+	require.NoError(t, writer.Write(context.Background(), SimulatedSignal{Topic: "data/a"}, jsonEncoding{}, simulatedPayload(1)))
+	require.Eventually(t, func() bool { return len(writer.lines) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, writer.Write(context.Background(), SimulatedSignal{Topic: "data/a"}, jsonEncoding{}, simulatedPayload(2)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, writer.Write(ctx, SimulatedSignal{Topic: "data/a"}, jsonEncoding{}, simulatedPayload(3)), context.DeadlineExceeded)
+
+	close(lines.block)
+	require.NoError(t, writer.Close(context.Background()))
+	assert.Len(t, lines.recorded(), 2)
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -25,14 +29,18 @@ func TestNewInfluxWriterFromEnvironment(t *testing.T) {
 	tests := []struct {
 		name        string
 		environment map[string]string
+		tokenFile   string
+		wantToken   string
 		wantURL     string
 		wantOrg     string
 		wantBucket  string
+		wantGzip    bool
 		wantErr     string
 	}{
 		{
 			name:        "defaults",
 			environment: map[string]string{"INFLUXDB_TOKEN": "token"},
+			wantToken:   "token",
 			wantURL:     defaultInfluxDBURL,
 			wantOrg:     defaultInfluxDBOrg,
 			wantBucket:  defaultInfluxDBBucket,
@@ -44,10 +52,27 @@ func TestNewInfluxWriterFromEnvironment(t *testing.T) {
 				"INFLUXDB_TOKEN":       "custom-token",
 				"INFLUXDB_INIT_ORG":    "custom-org",
 				"INFLUXDB_INIT_BUCKET": "custom-bucket",
+				"INFLUXDB_GZIP":        "true",
 			},
+			wantToken:  "custom-token",
 			wantURL:    "https://influx.example.test/base",
 			wantOrg:    "custom-org",
 			wantBucket: "custom-bucket",
+			wantGzip:   true,
+		},
+		{
+			name:        "token file replaces the variable",
+			environment: map[string]string{"INFLUXDB_TOKEN": "token"},
+			tokenFile:   "token",
+			wantToken:   "file-token",
+			wantURL:     defaultInfluxDBURL,
+			wantOrg:     defaultInfluxDBOrg,
+			wantBucket:  defaultInfluxDBBucket,
+		},
+		{
+			name:      "missing token file",
+			tokenFile: "missing",
+			wantErr:   "read InfluxDB token file",
 		},
 		{
 			name:        "malformed URL",
@@ -68,11 +93,18 @@ func TestNewInfluxWriterFromEnvironment(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			for _, name := range []string{"INFLUXDB_URL", "INFLUXDB_TOKEN", "INFLUXDB_INIT_ORG", "INFLUXDB_INIT_BUCKET"} {
+			for _, name := range []string{"INFLUXDB_URL", "INFLUXDB_TOKEN", "INFLUXDB_INIT_ORG", "INFLUXDB_INIT_BUCKET", "INFLUXDB_GZIP"} {
 				t.Setenv(name, tt.environment[name])
 			}
 
-			writer, err := NewInfluxWriterFromEnvironment()
+			tokenFile := ""
+			if tt.tokenFile != "" {
+				directory := t.TempDir()
+				require.NoError(t, os.WriteFile(filepath.Join(directory, "token"), []byte("file-token\n"), 0o600))
+				tokenFile = filepath.Join(directory, tt.tokenFile)
+			}
+
+			writer, err := NewInfluxWriterFromEnvironment(tokenFile, TLSOptions{})
 
 			if tt.wantErr != "" {
 				require.Error(t, err)
@@ -83,19 +115,50 @@ func TestNewInfluxWriterFromEnvironment(t *testing.T) {
 			require.NoError(t, err)
 			require.NotNil(t, writer)
 			assert.Equal(t, tt.wantURL, writer.baseURL.String())
-			assert.Equal(t, tt.environment["INFLUXDB_TOKEN"], writer.token)
+			assert.Equal(t, tt.wantToken, writer.token)
 			assert.Equal(t, tt.wantOrg, writer.org)
 			assert.Equal(t, tt.wantBucket, writer.bucket)
+			assert.Equal(t, tt.wantGzip, writer.gzip)
 			assert.Same(t, http.DefaultClient, writer.client)
 		})
 	}
 }
 
+func TestInfluxWriterMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	var authorization string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = pki.serverConfig()
+	server.StartTLS()
+	defer server.Close()
+	t.Setenv("INFLUXDB_URL", server.URL)
+	t.Setenv("INFLUXDB_TOKEN", "token")
+
+	writer, err := NewInfluxWriterFromEnvironment("", TLSOptions{CAFile: pki.CAFile, CertFile: pki.ClientCertFile, KeyFile: pki.ClientKeyFile})
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteLines(context.Background(), []byte("can_signal value=1 1\n")))
+	assert.Equal(t, "Token token", authorization)
+
+	withoutCertificate, err := NewInfluxWriterFromEnvironment("", TLSOptions{CAFile: pki.CAFile})
+	require.NoError(t, err)
+	assert.Error(t, withoutCertificate.WriteLines(context.Background(), []byte("can_signal value=1 1\n")), "the server requires a client certificate")
+
+	untrusted, err := NewInfluxWriterFromEnvironment("", TLSOptions{CertFile: pki.ClientCertFile, KeyFile: pki.ClientKeyFile})
+	require.NoError(t, err)
+	assert.Error(t, untrusted.WriteLines(context.Background(), []byte("can_signal value=1 1\n")), "the test CA is not a system root")
+
+	_, err = NewInfluxWriterFromEnvironment("", TLSOptions{CertFile: pki.ClientCertFile})
+	assert.ErrorContains(t, err, "configure InfluxDB TLS")
+}
+
 func TestInfluxWriterWrite(t *testing.T) {
 	transportErr := errors.New("transport unavailable")
 	tests := []struct {
 		name      string
-		topic     string
+		signal    SimulatedSignal
 		payload   string
 		roundTrip roundTripFunc
 		wantErr   string
@@ -103,7 +166,7 @@ func TestInfluxWriterWrite(t *testing.T) {
 	}{
 		{
 			name:    "dashboard schema request",
-			topic:   `data/electrical/battery voltage,primary=main\bus`,
+			signal:  SimulatedSignal{Topic: `data/electrical/battery voltage,primary=main\bus`, Name: "PackVoltage", Message: "Battery Status", MessageID: 0x80000123, Unit: "mV"},
 			payload: `{"value":12.5,"time":"2026-08-10T12:30:00.123456789Z","unit":"V"}`,
 			roundTrip: func(request *http.Request) (*http.Response, error) {
 				body, err := io.ReadAll(request.Body)
@@ -115,25 +178,25 @@ func TestInfluxWriterWrite(t *testing.T) {
 				assert.Equal(t, "ns", request.URL.Query().Get("precision"))
 				assert.Equal(t, "Token test-token", request.Header.Get("Authorization"))
 				assert.Equal(t, "text/plain; charset=utf-8", request.Header.Get("Content-Type"))
-				assert.Equal(t, "can_signal,topic=data/electrical/battery\\ voltage\\,primary\\=main\\\\bus value=12.5 1786365000123456789\n", string(body))
+				assert.Equal(t, "can_signal,message=Battery\\ Status,message_id=0x123,name=PackVoltage,topic=data/electrical/battery\\ voltage\\,primary\\=main\\\\bus,unit=V value=12.5 1786365000123456789\n", string(body))
 				return response(http.StatusNoContent, ""), nil
 			},
 		},
 		{
 			name:    "invalid JSON",
-			topic:   "data/speed",
+			signal:  SimulatedSignal{Topic: "data/speed"},
 			payload: `{`,
 			wantErr: "decode simulated payload",
 		},
 		{
 			name:    "invalid timestamp",
-			topic:   "data/speed",
+			signal:  SimulatedSignal{Topic: "data/speed"},
 			payload: `{"value":1,"time":"not-a-time"}`,
 			wantErr: "parse simulated timestamp",
 		},
 		{
 			name:      "transport error",
-			topic:     "data/speed",
+			signal:    SimulatedSignal{Topic: "data/speed"},
 			payload:   `{"value":1,"time":"2026-08-10T12:30:00Z"}`,
 			roundTrip: func(*http.Request) (*http.Response, error) { return nil, transportErr },
 			wantErr:   "write to InfluxDB",
@@ -141,7 +204,7 @@ func TestInfluxWriterWrite(t *testing.T) {
 		},
 		{
 			name:    "server error with body",
-			topic:   "data/speed",
+			signal:  SimulatedSignal{Topic: "data/speed"},
 			payload: `{"value":1,"time":"2026-08-10T12:30:00Z"}`,
 			roundTrip: func(*http.Request) (*http.Response, error) {
 				return response(http.StatusBadRequest, "invalid line protocol\n"), nil
@@ -150,7 +213,7 @@ func TestInfluxWriterWrite(t *testing.T) {
 		},
 		{
 			name:    "redirect status is rejected",
-			topic:   "data/speed",
+			signal:  SimulatedSignal{Topic: "data/speed"},
 			payload: `{"value":1,"time":"2026-08-10T12:30:00Z"}`,
 			roundTrip: func(*http.Request) (*http.Response, error) {
 				return response(http.StatusPermanentRedirect, ""), nil
@@ -169,7 +232,7 @@ func TestInfluxWriterWrite(t *testing.T) {
 			}
 			writer := &InfluxWriter{baseURL: baseURL, token: "test-token", org: "test-org", bucket: "test-bucket", client: client}
 
-			err = writer.Write(context.Background(), tt.topic, []byte(tt.payload))
+			err = writer.Write(context.Background(), tt.signal, jsonEncoding{}, []byte(tt.payload))
 
 			if tt.wantErr == "" {
 				require.NoError(t, err)
@@ -184,6 +247,81 @@ func TestInfluxWriterWrite(t *testing.T) {
 	}
 }
 
+func TestInfluxWriterWriteLinesGzip(t *testing.T) {
+	baseURL, err := url.Parse("https://influx.example.test")
+	require.NoError(t, err)
+	lines := "can_signal,topic=data/a value=1 1\ncan_signal,topic=data/b value=2 2\n"
+	client := &http.Client{Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+		assert.Equal(t, "gzip", request.Header.Get("Content-Encoding"))
+		reader, err := gzip.NewReader(request.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, lines, string(body))
+		return response(http.StatusNoContent, ""), nil
+	})}
+	writer := &InfluxWriter{baseURL: baseURL, token: "token", org: "org", bucket: "bucket", client: client, gzip: true}
+
+	require.NoError(t, writer.WriteLines(context.Background(), []byte(lines)))
+}
+
+func TestInfluxWriterStatusErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		retryAfter     string
+		wantTemporary  bool
+		wantRetryAfter time.Duration
+	}{
+		{name: "rate limited", status: http.StatusTooManyRequests, retryAfter: "7", wantTemporary: true, wantRetryAfter: 7 * time.Second},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantTemporary: true},
+		{name: "rejected line protocol", status: http.StatusBadRequest},
+		{name: "unauthorized", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseURL, err := url.Parse("https://influx.example.test")
+			require.NoError(t, err)
+			client := &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+				resp := response(tt.status, "")
+				resp.Header.Set("Retry-After", tt.retryAfter)
+				return resp, nil
+			})}
+			writer := &InfluxWriter{baseURL: baseURL, token: "token", org: "org", bucket: "bucket", client: client}
+
+			err = writer.WriteLines(context.Background(), []byte("can_signal,topic=data/a value=1 1\n"))
+
+			var statusErr *InfluxStatusError
+			require.ErrorAs(t, err, &statusErr)
+			assert.Equal(t, tt.status, statusErr.StatusCode)
+			assert.Equal(t, tt.wantTemporary, statusErr.Temporary())
+			assert.Equal(t, tt.wantRetryAfter, statusErr.RetryAfter())
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "120", want: 2 * time.Minute},
+		{value: "-1", want: 0},
+		{value: "Mon, 10 Aug 2026 12:00:30 GMT", want: 30 * time.Second},
+		{value: "Mon, 10 Aug 2026 11:59:00 GMT", want: 0},
+		{value: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseRetryAfter(tt.value, now))
+		})
+	}
+}
+
 func TestEnvironmentOrDefault(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -233,24 +371,6 @@ func TestParseTimestamp(t *testing.T) {
 	}
 }
 
-func TestEscapeInfluxTag(t *testing.T) {
-	tests := []struct {
-		name  string
-		value string
-		want  string
-	}{
-		{name: "plain", value: "vehicle/speed", want: "vehicle/speed"},
-		{name: "reserved characters", value: `a,b=c d\e`, want: `a\,b\=c\ d\\e`},
-		{name: "empty"},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.want, escapeInfluxTag(tt.value))
-		})
-	}
-}
-
 func response(status int, body string) *http.Response {
 	return &http.Response{
 		StatusCode: status,
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLoadTopicPrefix    = "vehicles"
+	defaultLoadReportInterval = 10 * time.Second
+)
+
+// LoadOptions configures a load run: Vehicles simulated cars, each with its
+// own MQTT client and topic prefix, publishing Rate signals per second in
+// total. A zero Rate keeps the DBC cycle times and a zero Duration runs until
+// the simulator is stopped.
+type LoadOptions struct {
+	Vehicles       int
+	Rate           float64
+	Duration       time.Duration
+	ReportInterval time.Duration
+	TopicPrefix    string
+}
+
+// parseLoadOptions validates the load flags. A vehicle count of zero turns
+// load mode off.
+func parseLoadOptions(vehicles string, rate string, duration string, reportInterval string, topicPrefix string) (LoadOptions, error) {
+	options := LoadOptions{ReportInterval: defaultLoadReportInterval, TopicPrefix: strings.Trim(topicPrefix, "/")}
+
+	var err error
+	if options.Vehicles, err = strconv.Atoi(vehicles); err != nil || options.Vehicles < 0 {
+		return LoadOptions{}, errors.New("vehicle count must be a non-negative integer")
+	}
+	if options.Rate, err = strconv.ParseFloat(rate, 64); err != nil || options.Rate < 0 || math.IsInf(options.Rate, 0) {
+		return LoadOptions{}, errors.New("load rate must be a non-negative number of signals per second")
+	}
+	if options.Duration, err = time.ParseDuration(duration); err != nil || options.Duration < 0 {
+		return LoadOptions{}, errors.New("load duration must be a non-negative duration")
+	}
+	if reportInterval != "" {
+		if options.ReportInterval, err = time.ParseDuration(reportInterval); err != nil || options.ReportInterval <= 0 {
+			return LoadOptions{}, errors.New("load report interval must be a positive duration")
+		}
+	}
+	if options.TopicPrefix == "" {
+		options.TopicPrefix = defaultLoadTopicPrefix
+	}
+
+	return options, nil
+}
+
+// vehicleID numbers vehicles from 001 so they sort in topic listings.
+func vehicleID(index int) string {
+	return fmt.Sprintf("%03d", index+1)
+}
+
+// vehicleTopicPrefix is the prefix in front of every topic of a vehicle.
+func (o LoadOptions) vehicleTopicPrefix(index int) string {
+	return o.TopicPrefix + "/" + vehicleID(index)
+}
+
+// vehicleMessages copies messages with every topic moved under the vehicle's
+// prefix and the cycle times stretched or shrunk to reach the per-vehicle
+// share of Rate.
+func (o LoadOptions) vehicleMessages(messages []SimulatedMessage, index int) []SimulatedMessage {
+	scale := 1.0
+	if o.Rate > 0 {
+		scale = signalRate(messages) * float64(o.Vehicles) / o.Rate
+	}
+
+	prefix := o.vehicleTopicPrefix(index) + "/"
+	vehicle := make([]SimulatedMessage, len(messages))
+	for i, message := range messages {
+		message.CycleTime = max(time.Duration(float64(message.CycleTime)*scale), time.Microsecond)
+		signals := make([]SimulatedSignal, len(message.Signals))
+		for j, signal := range message.Signals {
+			signal.Topic = prefix + signal.Topic
+			signals[j] = signal
+		}
+		message.Signals = signals
+		vehicle[i] = message
+	}
+	return vehicle
+}
+
+// signalRate is the number of signals messages publish per second.
+func signalRate(messages []SimulatedMessage) float64 {
+	var rate float64
+	for _, message := range messages {
+		if message.CycleTime > 0 {
+			rate += float64(len(message.Signals)) / message.CycleTime.Seconds()
+		}
+	}
+	return rate
+}
+
+// loadVehicle is one simulated car of a load run.
+type loadVehicle struct {
+	ID          string
+	TopicPrefix string
+	Messages    []SimulatedMessage
+	Publisher   Publisher
+}
+
+// runLoad schedules the messages of every vehicle concurrently until ctx is
+// done or a publish fails, logging the rates of the last interval as it goes.
+func runLoad(ctx context.Context, vehicles []loadVehicle, stats *LoadStats, reportInterval time.Duration, publish func(context.Context, loadVehicle, SimulatedMessage, time.Time) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	reporterDone := make(chan struct{})
+	go func() {
+		defer close(reporterDone)
+		ticker := time.NewTicker(reportInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				log.Printf("[SIMULATOR_LOAD] last %s\n", stats.Interval(now))
+			}
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for _, vehicle := range vehicles {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := runMessageScheduler(ctx, vehicle.Messages, func(ctx context.Context, message SimulatedMessage, timestamp time.Time) error {
+				return publish(ctx, vehicle, message, timestamp)
+			})
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("vehicle %s: %w", vehicle.ID, err)
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+	<-reporterDone
+
+	return firstErr
+}
+
+const (
+	loadPublishes = iota
+	loadWrites
+)
+
+// LoadStats counts publishes and InfluxDB writes of a load run, in total and
+// since the last interval report.
+type LoadStats struct {
+	mu            sync.Mutex
+	started       time.Time
+	windowStarted time.Time
+	total         [2]operationStats
+	window        [2]operationStats
+}
+
+func NewLoadStats(started time.Time) *LoadStats {
+	return &LoadStats{started: started, windowStarted: started}
+}
+
+type operationStats struct {
+	requests uint64
+	items    uint64
+	errors   uint64
+	latency  latencyHistogram
+}
+
+func (s *operationStats) observe(items int, latency time.Duration, err error) {
+	s.requests++
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.items += uint64(items)
+	s.latency.observe(latency)
+}
+
+func (s *LoadStats) observe(operation int, items int, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total[operation].observe(items, latency, err)
+	s.window[operation].observe(items, latency, err)
+}
+
+// Interval reports the operations since the previous Interval call and
+// starts a new window.
+func (s *LoadStats) Interval(now time.Time) LoadReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := newLoadReport(now.Sub(s.windowStarted), s.window)
+	s.window = [2]operationStats{}
+	s.windowStarted = now
+	return report
+}
+
+// Total reports every operation since the run started.
+func (s *LoadStats) Total(now time.Time) LoadReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return newLoadReport(now.Sub(s.started), s.total)
+}
+
+// LoadReport summarises the publishes and InfluxDB writes of a period.
+type LoadReport struct {
+	Elapsed   time.Duration
+	Publishes OperationReport
+	Writes    OperationReport
+}
+
+// OperationReport counts requests, the items they carried, failed requests
+// and the latency percentiles of the successful ones. For publishes an item
+// is a message, for InfluxDB writes a point.
+type OperationReport struct {
+	Requests uint64
+	Items    uint64
+	Errors   uint64
+	Rate     float64
+	P50      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+}
+
+func newLoadReport(elapsed time.Duration, stats [2]operationStats) LoadReport {
+	summarise := func(s operationStats) OperationReport {
+		report := OperationReport{
+			Requests: s.requests,
+			Items:    s.items,
+			Errors:   s.errors,
+			P50:      s.latency.quantile(0.50),
+			P95:      s.latency.quantile(0.95),
+			P99:      s.latency.quantile(0.99),
+		}
+		if elapsed > 0 {
+			report.Rate = float64(s.items) / elapsed.Seconds()
+		}
+		return report
+	}
+	return LoadReport{
+		Elapsed:   elapsed,
+		Publishes: summarise(stats[loadPublishes]),
+		Writes:    summarise(stats[loadWrites]),
+	}
+}
+
+func (r LoadReport) String() string {
+	return fmt.Sprintf("%s: MQTT %.1f msg/s, p50 %s p95 %s p99 %s, %d errors; InfluxDB %.1f points/s in %d requests, p50 %s p95 %s p99 %s, %d errors",
+		r.Elapsed.Round(time.Millisecond),
+		r.Publishes.Rate, r.Publishes.P50, r.Publishes.P95, r.Publishes.P99, r.Publishes.Errors,
+		r.Writes.Rate, r.Writes.Requests, r.Writes.P50, r.Writes.P95, r.Writes.P99, r.Writes.Errors)
+}
+
+const (
+	latencyBuckets    = 96
+	latencyBucketBase = 10 * time.Microsecond
+	latencyGrowth     = 1.2
+)
+
+// latencyHistogram counts latencies in exponentially growing buckets, from
+// 10µs up to about a minute, so percentiles stay within 20% of the true
+// value however long the run lasts.
+type latencyHistogram struct {
+	counts [latencyBuckets]uint64
+	total  uint64
+}
+
+func latencyBucket(latency time.Duration) int {
+	if latency <= latencyBucketBase {
+		return 0
+	}
+	bucket := int(math.Ceil(math.Log(float64(latency)/float64(latencyBucketBase)) / math.Log(latencyGrowth)))
+	return min(bucket, latencyBuckets-1)
+}
+
+// latencyBucketBound is the largest latency counted in bucket.
+func latencyBucketBound(bucket int) time.Duration {
+	return time.Duration(float64(latencyBucketBase) * math.Pow(latencyGrowth, float64(bucket))).Round(time.Microsecond)
+}
+
+func (h *latencyHistogram) observe(latency time.Duration) {
+	h.counts[latencyBucket(latency)]++
+	h.total++
+}
+
+// quantile returns the upper bound of the bucket holding the q-th latency, or
+// zero without observations.
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	var seen uint64
+	for bucket, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			return latencyBucketBound(bucket)
+		}
+	}
+	return latencyBucketBound(latencyBuckets - 1)
+}
+
+// instrumentedPublisher records every publish attempt in LoadStats.
+type instrumentedPublisher struct {
+	publisher Publisher
+	stats     *LoadStats
+}
+
+func (p instrumentedPublisher) Publish(ctx context.Context, topic string, payload []byte, options ...PublishOption) error {
+	started := time.Now()
+	err := p.publisher.Publish(ctx, topic, payload, options...)
+	p.stats.observe(loadPublishes, 1, time.Since(started), err)
+	return err
+}
+
+// instrumentedLineWriter records every InfluxDB write attempt in LoadStats.
+type instrumentedLineWriter struct {
+	writer lineWriter
+	stats  *LoadStats
+}
+
+func (w instrumentedLineWriter) WriteLines(ctx context.Context, lines []byte) error {
+	started := time.Now()
+	err := w.writer.WriteLines(ctx, lines)
+	w.stats.observe(loadWrites, bytes.Count(lines, []byte{'\n'}), time.Since(started), err)
+	return err
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLoadOptions(t *testing.T) {
+	tests := []struct {
+		name           string
+		vehicles       string
+		rate           string
+		duration       string
+		reportInterval string
+		topicPrefix    string
+		want           LoadOptions
+		wantErr        string
+	}{
+		{
+			name:     "off",
+			vehicles: "0", rate: "0", duration: "0",
+			want: LoadOptions{ReportInterval: defaultLoadReportInterval, TopicPrefix: defaultLoadTopicPrefix},
+		},
+		{
+			name:     "custom",
+			vehicles: "12", rate: "50000", duration: "5m", reportInterval: "2s", topicPrefix: "/bench/",
+			want: LoadOptions{Vehicles: 12, Rate: 50000, Duration: 5 * time.Minute, ReportInterval: 2 * time.Second, TopicPrefix: "bench"},
+		},
+		{name: "negative vehicles", vehicles: "-1", rate: "0", duration: "0", wantErr: "vehicle count must be a non-negative integer"},
+		{name: "malformed rate", vehicles: "1", rate: "fast", duration: "0", wantErr: "load rate must be a non-negative number of signals per second"},
+		{name: "infinite rate", vehicles: "1", rate: "+Inf", duration: "0", wantErr: "load rate must be a non-negative number of signals per second"},
+		{name: "malformed duration", vehicles: "1", rate: "0", duration: "5", wantErr: "load duration must be a non-negative duration"},
+		{name: "zero report interval", vehicles: "1", rate: "0", duration: "0", reportInterval: "0s", wantErr: "load report interval must be a positive duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLoadOptions(tt.vehicles, tt.rate, tt.duration, tt.reportInterval, tt.topicPrefix)
+
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadOptionsVehicleMessages(t *testing.T) {
+	messages := []SimulatedMessage{
+		{Name: "Powertrain", CycleTime: 100 * time.Millisecond, Signals: []SimulatedSignal{{Topic: "data/speed"}, {Topic: "data/rpm"}}},
+		{Name: "Battery", CycleTime: time.Second, Signals: []SimulatedSignal{{Topic: "data/soc"}}},
+	}
+	require.InDelta(t, 21, signalRate(messages), 1e-9)
+
+	// Four vehicles sharing 168 signals/s publish 42 each, twice the DBC rate.
+	options := LoadOptions{Vehicles: 4, Rate: 168, TopicPrefix: "vehicles"}
+
+	got := options.vehicleMessages(messages, 2)
+
+	require.Len(t, got, 2)
+	assert.Equal(t, 50*time.Millisecond, got[0].CycleTime)
+	assert.Equal(t, 500*time.Millisecond, got[1].CycleTime)
+	assert.Equal(t, "vehicles/003/data/speed", got[0].Signals[0].Topic)
+	assert.Equal(t, "vehicles/003/data/soc", got[1].Signals[0].Topic)
+	assert.InDelta(t, 42, signalRate(got), 1e-6)
+	assert.Equal(t, "data/speed", messages[0].Signals[0].Topic, "the DBC messages are not modified")
+
+	unscaled := LoadOptions{Vehicles: 4, TopicPrefix: "vehicles"}.vehicleMessages(messages, 0)
+	assert.Equal(t, 100*time.Millisecond, unscaled[0].CycleTime, "without a rate the DBC cycle times are kept")
+}
+
+func TestLatencyHistogramQuantile(t *testing.T) {
+	var histogram latencyHistogram
+	assert.Zero(t, histogram.quantile(0.5))
+
+	for i := 1; i <= 100; i++ {
+		histogram.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	for _, tt := range []struct {
+		q    float64
+		want time.Duration
+	}{{0.50, 50 * time.Millisecond}, {0.95, 95 * time.Millisecond}, {0.99, 99 * time.Millisecond}} {
+		got := histogram.quantile(tt.q)
+		assert.GreaterOrEqual(t, got, tt.want, "a quantile is the upper bound of its bucket")
+		assert.LessOrEqual(t, float64(got), float64(tt.want)*latencyGrowth)
+	}
+
+	histogram.observe(time.Hour)
+	assert.Equal(t, latencyBucketBound(latencyBuckets-1), histogram.quantile(1), "slower latencies land in the last bucket")
+}
+
+func TestLoadStatsReports(t *testing.T) {
+	started := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	stats := NewLoadStats(started)
+
+	for range 20 {
+		stats.observe(loadPublishes, 1, time.Millisecond, nil)
+	}
+	stats.observe(loadPublishes, 1, time.Millisecond, errors.New("connection reset"))
+	stats.observe(loadWrites, 500, 20*time.Millisecond, nil)
+
+	interval := stats.Interval(started.Add(2 * time.Second))
+
+	assert.Equal(t, 2*time.Second, interval.Elapsed)
+	assert.Equal(t, uint64(21), interval.Publishes.Requests)
+	assert.Equal(t, uint64(1), interval.Publishes.Errors)
+	assert.InDelta(t, 10, interval.Publishes.Rate, 1e-9)
+	assert.InDelta(t, 250, interval.Writes.Rate, 1e-9)
+	assert.Equal(t, uint64(1), interval.Writes.Requests)
+	assert.GreaterOrEqual(t, interval.Writes.P99, 20*time.Millisecond)
+
+	stats.observe(loadWrites, 100, 20*time.Millisecond, nil)
+	next := stats.Interval(started.Add(3 * time.Second))
+	assert.Zero(t, next.Publishes.Requests, "each interval starts empty")
+	assert.InDelta(t, 100, next.Writes.Rate, 1e-9)
+
+	total := stats.Total(started.Add(4 * time.Second))
+	assert.Equal(t, 4*time.Second, total.Elapsed)
+	assert.Equal(t, uint64(21), total.Publishes.Requests)
+	assert.Equal(t, uint64(600), total.Writes.Items)
+	assert.Contains(t, total.String(), "MQTT 5.0 msg/s")
+	assert.Contains(t, total.String(), "InfluxDB 150.0 points/s in 2 requests")
+}
+
+func TestInstrumentedWriters(t *testing.T) {
+	stats := NewLoadStats(time.Now())
+	broker := &recordingPublisher{}
+	failing := &recordingLineWriter{err: errors.New("connection refused")}
+
+	require.NoError(t, instrumentedPublisher{publisher: broker, stats: stats}.Publish(context.Background(), "data/a", []byte("1"), WithQoS(1)))
+	require.Error(t, instrumentedLineWriter{writer: failing, stats: stats}.WriteLines(context.Background(), []byte("a 1\nb 2\n")))
+	require.NoError(t, instrumentedLineWriter{writer: &recordingLineWriter{}, stats: stats}.WriteLines(context.Background(), []byte("a 1\nb 2\n")))
+
+	report := stats.Total(time.Now())
+	assert.Equal(t, uint64(1), report.Publishes.Items)
+	assert.Equal(t, byte(1), broker.published[0].Options.QoS, "options reach the wrapped publisher")
+	assert.Equal(t, uint64(2), report.Writes.Requests)
+	assert.Equal(t, uint64(1), report.Writes.Errors)
+	assert.Equal(t, uint64(2), report.Writes.Items, "failed writes do not count as written points")
+}
+
+func TestRunLoad(t *testing.T) {
+	messages := []SimulatedMessage{{Name: "Powertrain", CycleTime: time.Millisecond, Signals: []SimulatedSignal{{Topic: "data/speed"}}}}
+	options := LoadOptions{Vehicles: 3, TopicPrefix: "vehicles"}
+	vehicles := make([]loadVehicle, 0, options.Vehicles)
+	for index := range options.Vehicles {
+		vehicles = append(vehicles, loadVehicle{ID: vehicleID(index), Messages: options.vehicleMessages(messages, index)})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		counts = make(map[string]int)
+	)
+	err := runLoad(ctx, vehicles, NewLoadStats(time.Now()), time.Millisecond, func(_ context.Context, vehicle loadVehicle, message SimulatedMessage, _ time.Time) error {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[message.Signals[0].Topic]++
+		if len(counts) == len(vehicles) {
+			cancel()
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Len(t, counts, 3, "every vehicle publishes under its own prefix")
+	assert.Contains(t, counts, "vehicles/001/data/speed")
+	assert.Contains(t, counts, "vehicles/003/data/speed")
+}
+
+func TestRunLoadStopsOnPublishError(t *testing.T) {
+	messages := []SimulatedMessage{{Name: "Powertrain", CycleTime: time.Millisecond, Signals: []SimulatedSignal{{Topic: "data/speed"}}}}
+	vehicles := []loadVehicle{{ID: "001", Messages: messages}, {ID: "002", Messages: messages}}
+	failure := errors.New("broker gone")
+
+	err := runLoad(context.Background(), vehicles, NewLoadStats(time.Now()), time.Second, func(context.Context, loadVehicle, SimulatedMessage, time.Time) error {
+		return failure
+	})
+
+	require.ErrorIs(t, err, failure)
+	assert.Contains(t, err.Error(), "vehicle 00")
+}
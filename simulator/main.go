@@ -2,19 +2,22 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"math/rand"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/ApexCorse/ephoros/schema"
 	"github.com/ApexCorse/vera"
 	"github.com/eclipse/paho.golang/autopaho"
 	"github.com/eclipse/paho.golang/paho"
@@ -23,6 +26,45 @@ import (
 func main() {
 	dbcFilePath := flag.String("dbc-file", os.Getenv("DBC_FILE_PATH"), "path to the DBC file")
 	catalogOutput := flag.String("catalog-output", "", "write a C topic catalog to this file and exit")
+	scenarioPath := flag.String("scenario", os.Getenv("SIMULATOR_SCENARIO"), "path to a YAML or JSON scenario scripting topic values over time")
+	replayPath := flag.String("replay", os.Getenv("SIMULATOR_REPLAY"), "replay a candump .log or Vector .asc capture instead of generating data")
+	replayFormat := flag.String("replay-format", os.Getenv("SIMULATOR_REPLAY_FORMAT"), "capture format: candump or asc (default: from the file extension)")
+	replaySpeed := flag.String("replay-speed", environmentOrDefault("SIMULATOR_REPLAY_SPEED", "realtime"), "replay pace: realtime, max, or a multiplier such as 4x")
+	replayRewriteTime := flag.Bool("replay-rewrite-time", os.Getenv("SIMULATOR_REPLAY_REWRITE_TIME") == "true", "stamp replayed frames with the current time instead of the recorded time")
+	payloadEncodingName := flag.String("payload-encoding", environmentOrDefault("SIMULATOR_PAYLOAD_ENCODING", defaultPayloadEncoding), "MQTT payload encoding: json, cbor, msgpack or protobuf")
+	messageMode := flag.Bool("message-mode", os.Getenv("SIMULATOR_MESSAGE_MODE") == "true", "publish one payload per CAN message instead of one per signal")
+	fanoutMode := flag.Bool("fanout", os.Getenv("SIMULATOR_FANOUT") == "true", "split message-mode payloads back into per-signal topics instead of simulating")
+	messageTopicPrefix := flag.String("message-topic-prefix", environmentOrDefault("SIMULATOR_MESSAGE_TOPIC_PREFIX", defaultMessageTopicPrefix), "topic prefix of message-mode payloads, followed by the DBC message name")
+	mqttQoS := flag.String("qos", environmentOrDefault("SIMULATOR_MQTT_QOS", "0"), "MQTT QoS of every publish: 0, 1 or 2")
+	mqttRetain := flag.Bool("retain", os.Getenv("SIMULATOR_MQTT_RETAIN") == "true", "publish retained messages, so new subscribers get the last value of each topic")
+	mqttMessageExpiry := flag.String("message-expiry", environmentOrDefault("SIMULATOR_MQTT_MESSAGE_EXPIRY", "0"), "MQTT v5 message expiry, such as 5m; 0 keeps messages until replaced")
+	mqttUsername := flag.String("mqtt-username", os.Getenv("MQTT_USERNAME"), "MQTT username")
+	mqttPasswordFile := flag.String("mqtt-password-file", os.Getenv("MQTT_PASSWORD_FILE"), "file holding the MQTT password, instead of MQTT_PASSWORD")
+	mqttTLS := registerTLSFlags(flag.CommandLine, "mqtt", "MQTT")
+	influxTokenFile := flag.String("influxdb-token-file", os.Getenv("INFLUXDB_TOKEN_FILE"), "file holding the InfluxDB token, instead of INFLUXDB_TOKEN")
+	influxTLS := registerTLSFlags(flag.CommandLine, "influxdb", "INFLUXDB")
+	loadVehicles := flag.String("vehicles", environmentOrDefault("SIMULATOR_LOAD_VEHICLES", "0"), "run a load test with this many simulated vehicles")
+	loadRate := flag.String("load-rate", environmentOrDefault("SIMULATOR_LOAD_RATE", "0"), "total signals per second across all vehicles (default: the DBC cycle times)")
+	loadDuration := flag.String("load-duration", environmentOrDefault("SIMULATOR_LOAD_DURATION", "0"), "stop the load test after this long, such as 5m (default: until interrupted)")
+	loadReportInterval := flag.String("load-report-interval", environmentOrDefault("SIMULATOR_LOAD_REPORT_INTERVAL", defaultLoadReportInterval.String()), "how often the load test logs its rates")
+	loadTopicPrefix := flag.String("load-topic-prefix", environmentOrDefault("SIMULATOR_LOAD_TOPIC_PREFIX", defaultLoadTopicPrefix), "topic prefix of the simulated vehicles, followed by the vehicle number")
+	controlAddr := flag.String("control-addr", os.Getenv("SIMULATOR_CONTROL_ADDR"), "serve the HTTP control API on this address, such as :8080")
+	metricsAddr := flag.String("metrics-addr", os.Getenv("SIMULATOR_METRICS_ADDR"), "serve Prometheus metrics on /metrics at this address, such as :9100")
+	seedFlag := flag.String("seed", os.Getenv("SIMULATOR_SEED"), "seed of the random values, so runs can be repeated (default: a new seed every run)")
+	outputPath := flag.String("output", os.Getenv("SIMULATOR_OUTPUT"), "write the generated stream to this file, or - for stdout, instead of MQTT and InfluxDB")
+	outputStart := flag.String("start-time", os.Getenv("SIMULATOR_START_TIME"), "RFC 3339 time the --output stream starts at (default: "+defaultSimulatedStart.Format(time.RFC3339)+")")
+	outputDuration := flag.String("duration", os.Getenv("SIMULATOR_DURATION"), "simulated time covered by the --output stream, such as 10m (default: the scenario duration, or 1m)")
+	backfillFrom := flag.String("backfill-from", os.Getenv("SIMULATOR_BACKFILL_FROM"), "write past data from this RFC 3339 time or duration ago, such as 24h, straight to InfluxDB and exit")
+	backfillTo := flag.String("backfill-to", os.Getenv("SIMULATOR_BACKFILL_TO"), "end of the backfill, as an RFC 3339 time or duration ago (default: now)")
+	backfillRate := flag.String("backfill-rate", environmentOrDefault("SIMULATOR_BACKFILL_RATE", strconv.Itoa(defaultBackfillRate)), "backfill points per topic per second; 0 keeps the DBC cycle times")
+	backfillOutput := flag.String("backfill-output", os.Getenv("SIMULATOR_BACKFILL_OUTPUT"), "write the backfill to this line protocol file for influx write instead of InfluxDB")
+	impairmentName := flag.String("impairment", os.Getenv("SIMULATOR_IMPAIRMENT"), "emulate a radio link on MQTT publishes: good, lossy, degraded, outages or a profile file")
+	impairInflux := flag.Bool("impair-influx", os.Getenv("SIMULATOR_IMPAIR_INFLUX") == "true", "send InfluxDB writes over the impaired link too")
+	bridgeMode := flag.Bool("bridge", os.Getenv("SIMULATOR_BRIDGE") == "true", "write every publish on "+bridgeFilter+" to InfluxDB instead of simulating")
+	gatewaySource := flag.String("gateway", os.Getenv("SIMULATOR_GATEWAY"), "decode live CAN frames instead of simulating: socketcan:<interface>, tcp://host:port, udp://host:port or - for stdin")
+	embeddedBroker := flag.String("embedded-broker", os.Getenv("SIMULATOR_EMBEDDED_BROKER"), "start an in-process MQTT v5 broker on this address, such as :1883, and publish to it instead of BROKER_URL")
+	skipInflux := flag.Bool("skip-influxdb", os.Getenv("SIMULATOR_SKIP_INFLUXDB") == "true", "publish to MQTT only, without writing to InfluxDB")
+	cycleTimeAttribute := flag.String("cycle-time-attribute", environmentOrDefault("SIMULATOR_CYCLE_TIME_ATTRIBUTE", defaultCycleTimeAttribute), "DBC message attribute holding the cycle time in milliseconds")
 	flag.Parse()
 
 	if *dbcFilePath == "" {
@@ -41,17 +83,103 @@ func main() {
 		return
 	}
 
+	payloadEncoding, err := payloadEncodingByName(*payloadEncodingName)
+	if err != nil {
+		log.Fatalf("[SIMULATOR_MAIN] %s\n", err.Error())
+	}
+
+	qos, err := strconv.Atoi(*mqttQoS)
+	if err != nil || qos < 0 || qos > 2 {
+		log.Fatalln("[SIMULATOR_MAIN] SIMULATOR_MQTT_QOS or --qos must be 0, 1 or 2")
+	}
+	messageExpiry, err := time.ParseDuration(*mqttMessageExpiry)
+	if err != nil || messageExpiry < 0 {
+		log.Fatalln("[SIMULATOR_MAIN] SIMULATOR_MQTT_MESSAGE_EXPIRY or --message-expiry must be a non-negative duration")
+	}
+
+	seed := time.Now().UnixNano()
+	if *seedFlag != "" {
+		seed, err = strconv.ParseInt(*seedFlag, 10, 64)
+		if err != nil {
+			log.Fatalln("[SIMULATOR_MAIN] SIMULATOR_SEED or --seed must be an integer")
+		}
+	}
+	log.Printf("[SIMULATOR_MAIN] random seed %d\n", seed)
+	rng := newRand(seed)
+
+	loadOptions, err := parseLoadOptions(*loadVehicles, *loadRate, *loadDuration, *loadReportInterval, *loadTopicPrefix)
+	if err != nil {
+		log.Fatalf("[SIMULATOR_MAIN] %s\n", err.Error())
+	}
+	if loadOptions.Vehicles > 0 && (*fanoutMode || *replayPath != "" || *scenarioPath != "" || *controlAddr != "") {
+		log.Fatalln("[SIMULATOR_MAIN] load mode cannot be combined with fan-out, replay, scenarios or the control API")
+	}
+	if *outputPath != "" && (loadOptions.Vehicles > 0 || *fanoutMode || *replayPath != "" || *controlAddr != "") {
+		log.Fatalln("[SIMULATOR_MAIN] file output cannot be combined with load mode, fan-out, replay or the control API")
+	}
+	if *backfillFrom != "" && (loadOptions.Vehicles > 0 || *fanoutMode || *replayPath != "" || *controlAddr != "" || *outputPath != "") {
+		log.Fatalln("[SIMULATOR_MAIN] backfill cannot be combined with load mode, fan-out, replay, the control API or file output")
+	}
+
+	if *gatewaySource != "" && (loadOptions.Vehicles > 0 || *fanoutMode || *replayPath != "" || *scenarioPath != "" || *controlAddr != "" || *outputPath != "" || *backfillFrom != "" || *messageMode) {
+		log.Fatalln("[SIMULATOR_MAIN] the gateway cannot be combined with load mode, fan-out, replay, scenarios, the control API, file output, backfill or message mode")
+	}
+
+	if *bridgeMode && (loadOptions.Vehicles > 0 || *fanoutMode || *replayPath != "" || *scenarioPath != "" || *controlAddr != "" || *outputPath != "" || *backfillFrom != "" || *gatewaySource != "" || *impairmentName != "" || *skipInflux) {
+		log.Fatalln("[SIMULATOR_MAIN] the bridge cannot be combined with load mode, fan-out, replay, scenarios, the control API, file output, backfill, the gateway, impairment or --skip-influxdb")
+	}
+
+	var impairment *ImpairmentProfile
+	if *impairmentName != "" {
+		if loadOptions.Vehicles > 0 || *outputPath != "" || *backfillFrom != "" {
+			log.Fatalln("[SIMULATOR_MAIN] link impairment cannot be combined with load mode, file output or backfill")
+		}
+		profile, err := LoadImpairmentProfile(*impairmentName)
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] couldn't load impairment profile: %s\n", err.Error())
+		}
+		impairment = &profile
+	}
+
+	if *embeddedBroker != "" && (*outputPath != "" || *backfillFrom != "") {
+		log.Fatalln("[SIMULATOR_MAIN] the embedded broker cannot be combined with file output or backfill")
+	}
+	if *embeddedBroker != "" && mqttTLS.configured() {
+		log.Fatalln("[SIMULATOR_MAIN] the embedded broker only serves plain MQTT, so MQTT TLS cannot be configured")
+	}
+	if *skipInflux && *backfillFrom != "" && *backfillOutput == "" {
+		log.Fatalln("[SIMULATOR_MAIN] a backfill without InfluxDB needs --backfill-output")
+	}
+
+	mqttPassword := os.Getenv("MQTT_PASSWORD")
+	if *mqttPasswordFile != "" {
+		mqttPassword, err = readSecretFile(*mqttPasswordFile)
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] couldn't read MQTT password file: %s\n", err.Error())
+		}
+	}
+
 	brokerUrl := os.Getenv("BROKER_URL")
-	if brokerUrl == "" {
+	if *embeddedBroker != "" {
+		broker, err := StartEmbeddedBroker(*embeddedBroker, *mqttUsername, mqttPassword)
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] couldn't start the embedded broker: %s\n", err.Error())
+		}
+		defer broker.Close()
+		brokerUrl = broker.URL().String()
+		log.Printf("[SIMULATOR_MAIN] embedded MQTT broker listening on %s\n", brokerUrl)
+	}
+	if brokerUrl == "" && *outputPath == "" && *backfillFrom == "" {
 		log.Fatalln("[SIMULATOR_MAIN] missing env variables")
 		os.Exit(1)
 	}
 
+	// SIMULATOR_INTERVAL is the cycle time of messages without a DBC cycle time.
 	intervalStr := os.Getenv("SIMULATOR_INTERVAL")
 	interval := 200
 	if intervalStr != "" {
 		newInterval, err := strconv.Atoi(intervalStr)
-		if err == nil {
+		if err == nil && newInterval > 0 {
 			interval = newInterval
 		}
 	}
@@ -62,98 +190,547 @@ func main() {
 		os.Exit(1)
 	}
 
-	topics := getTopicsFromConfig(config)
-	if len(topics) == 0 {
+	mqttTLSConfig, err := mqttTLS.Config()
+	if err != nil {
+		log.Fatalf("[SIMULATOR_MAIN] couldn't configure MQTT TLS: %s\n", err.Error())
+	}
+
+	cycleTimes, err := getMessageCycleTimes(*dbcFilePath, *cycleTimeAttribute)
+	if err != nil {
+		log.Fatalf("[SIMULATOR_MAIN] couldn't read message cycle times: %s\n", err.Error())
+	}
+
+	messages := getMessagesFromConfig(config, cycleTimes, time.Duration(interval)*time.Millisecond)
+	if len(messages) == 0 {
 		log.Fatalln("[SIMULATOR_MAIN] DBC config contains no MQTT topics")
 	}
-	log.Printf("[SIMULATOR_MAIN] got %d topics: %v\n", len(topics), topics)
+	topics := getTopicsFromConfig(config)
+	log.Printf("[SIMULATOR_MAIN] got %d topics in %d messages: %v\n", len(topics), len(messages), topics)
+	for _, message := range messages {
+		log.Printf("[SIMULATOR_MAIN] message %s publishes %d signals every %s\n", message.Name, len(message.Signals), message.CycleTime)
+	}
+
+	var replayFrames []CANFrame
+	var replayOptions ReplayOptions
+	if *replayPath != "" {
+		replayFrames, err = ReadCANLog(*replayPath, *replayFormat)
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] couldn't read CAN log: %s\n", err.Error())
+		}
+		replayOptions.Speed, err = parseReplaySpeed(*replaySpeed)
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] %s\n", err.Error())
+		}
+		replayOptions.RewriteTimestamps = *replayRewriteTime
+		log.Printf("[SIMULATOR_MAIN] loaded %d frames from %s\n", len(replayFrames), *replayPath)
+	}
+
+	var scenario *Scenario
+	if *scenarioPath != "" {
+		scenario, err = LoadScenario(*scenarioPath, getSignalsFromConfig(config))
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] couldn't load scenario: %s\n", err.Error())
+		}
+		log.Printf("[SIMULATOR_MAIN] loaded scenario %q scripting %d topics\n", scenario.Name, len(scenario.Topics))
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	if *outputPath != "" {
+		outputOptions, err := parseOutputOptions(*outputStart, *outputDuration, scenario)
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] %s\n", err.Error())
+		}
+		if *messageMode {
+			outputOptions.MessageTopicPrefix = *messageTopicPrefix
+		}
+		output := os.Stdout
+		if *outputPath != "-" {
+			output, err = os.Create(*outputPath)
+			if err != nil {
+				log.Fatalf("[SIMULATOR_MAIN] couldn't create output file: %s\n", err.Error())
+			}
+		}
+		err = writeOutput(ctx, output, outputOptions, messages, scenario, rng, payloadEncoding)
+		if closeErr := output.Close(); err == nil && *outputPath != "-" {
+			err = closeErr
+		}
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] couldn't write output: %s\n", err.Error())
+		}
+		log.Printf("[SIMULATOR_MAIN] wrote %s from %s to %s\n", outputOptions.Duration, outputOptions.Start.Format(time.RFC3339), *outputPath)
+		return
+	}
+
+	if *backfillFrom != "" {
+		backfillOptions, err := parseBackfillOptions(*backfillFrom, *backfillTo, *backfillRate, time.Now())
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] %s\n", err.Error())
+		}
+		log.Printf("[SIMULATOR_MAIN] backfilling %s to %s\n", backfillOptions.From.Format(time.RFC3339), backfillOptions.To.Format(time.RFC3339))
+
+		var points int
+		if *backfillOutput != "" {
+			file, err := os.Create(*backfillOutput)
+			if err != nil {
+				log.Fatalf("[SIMULATOR_MAIN] couldn't create backfill file: %s\n", err.Error())
+			}
+			lines := NewLineProtocolFile(file)
+			points, err = runBackfill(ctx, backfillOptions, messages, scenario, rng, payloadEncoding, lines)
+			if err == nil {
+				err = lines.Flush()
+			}
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				log.Fatalf("[SIMULATOR_MAIN] backfill failed: %s\n", err.Error())
+			}
+		} else {
+			retryPolicy, err := RetryPolicyFromEnvironment()
+			if err != nil {
+				log.Fatalf("[SIMULATOR_MAIN] couldn't configure retries: %s\n", err.Error())
+			}
+			directWriter, err := NewInfluxWriterFromEnvironment(*influxTokenFile, *influxTLS)
+			if err != nil {
+				log.Fatalf("[SIMULATOR_MAIN] couldn't create InfluxDB writer: %s\n", err.Error())
+			}
+			batchOptions, err := InfluxBatchOptionsFromEnvironment()
+			if err != nil {
+				log.Fatalf("[SIMULATOR_MAIN] couldn't configure InfluxDB batching: %s\n", err.Error())
+			}
+			batchWriter := NewInfluxBatchWriter(NewResilientLineWriter(directWriter, retryPolicy, nil), batchOptions)
+			points, err = runBackfill(ctx, backfillOptions, messages, scenario, rng, payloadEncoding, batchWriter)
+			closeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if closeErr := batchWriter.Close(closeCtx); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				log.Fatalf("[SIMULATOR_MAIN] backfill failed: %s\n", err.Error())
+			}
+		}
+		log.Printf("[SIMULATOR_MAIN] backfilled %d points\n", points)
+		return
+	}
+
 	log.Println("[SIMULATOR_MAIN] starting MQTT simulator")
-	client, err := NewMQTTClientBuilder(nil).
-		AddServers([]*url.URL{parsedUrl}).
-		AddKeepAlive(20).
-		AddCleanStartOnInitialConnection(false).
-		AddOnConnectionUp(func(cm *autopaho.ConnectionManager, connAck *paho.Connack) {
-			log.Println("[SIMULATOR_MAIN] MQTT connection up")
-		}).
-		AddOnConnectionError(func(err error) {
-			log.Printf("[SIMULATOR_MAIN] MQTT connection error: %s\n", err.Error())
+	metrics := NewMetrics()
+	// newBuilder configures a client with the shared settings. onConnectionUp,
+	// if set, runs after every connection, such as to subscribe.
+	newBuilder := func(clientID string, onConnectionUp func(*autopaho.ConnectionManager)) *MQTTClientBuilder {
+		var connected atomic.Bool
+		return NewMQTTClientBuilder(nil).
+			AddServers([]*url.URL{parsedUrl}).
+			AddKeepAlive(20).
+			AddCleanStartOnInitialConnection(false).
+			AddOnConnectionUp(func(cm *autopaho.ConnectionManager, connAck *paho.Connack) {
+				log.Printf("[SIMULATOR_MAIN] MQTT connection up for %s\n", clientID)
+				metrics.ConnectionUp(!connected.Swap(true))
+				if onConnectionUp != nil {
+					onConnectionUp(cm)
+				}
+			}).
+			AddOnConnectionError(func(err error) {
+				log.Printf("[SIMULATOR_MAIN] MQTT connection error for %s: %s\n", clientID, err.Error())
+				metrics.ConnectionError()
+			}).
+			AddClientId(clientID).
+			AddTLSConfig(mqttTLSConfig).
+			AddCredentials(*mqttUsername, mqttPassword).
+			AddPayloadEncoding(payloadEncoding).
+			AddQoS(byte(qos)).
+			AddRetain(*mqttRetain).
+			AddMessageExpiry(messageExpiry)
+	}
+
+	retryPolicy, err := RetryPolicyFromEnvironment()
+	if err != nil {
+		log.Fatalf("[SIMULATOR_MAIN] couldn't configure retries: %s\n", err.Error())
+	}
+	var directWriter lineWriter = discardLineWriter{}
+	if !*skipInflux {
+		directWriter, err = NewInfluxWriterFromEnvironment(*influxTokenFile, *influxTLS)
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] couldn't create InfluxDB writer: %s\n", err.Error())
+		}
+	}
+	batchOptions, err := InfluxBatchOptionsFromEnvironment()
+	if err != nil {
+		log.Fatalf("[SIMULATOR_MAIN] couldn't configure InfluxDB batching: %s\n", err.Error())
+	}
+
+	var controller *Controller
+	var rate schedulerRate
+	if *controlAddr != "" {
+		controller = NewController(messages)
+		rate = controller
+	}
+	// The metrics and the control API share one server when their addresses
+	// are the same.
+	muxes := make(map[string]*http.ServeMux)
+	route := func(addr string, pattern string, handler http.Handler) {
+		if addr == "" {
+			return
+		}
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		muxes[addr].Handle(pattern, handler)
+	}
+	route(*metricsAddr, "GET /metrics", metrics.Handler())
+	if controller != nil {
+		route(*controlAddr, "/", controller.Handler())
+	}
+	for addr, mux := range muxes {
+		server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("[SIMULATOR_MAIN] HTTP server on %s failed: %s\n", addr, err.Error())
+			}
+		}()
+		defer server.Close()
+		log.Printf("[SIMULATOR_MAIN] HTTP server listening on %s\n", addr)
+	}
+
+	if loadOptions.Vehicles > 0 {
+		stats := NewLoadStats(time.Now())
+		batchWriter := NewInfluxBatchWriter(NewResilientLineWriter(instrumentedLineWriter{writer: meteredLineWriter{writer: directWriter, metrics: metrics}, stats: stats}, retryPolicy, nil), batchOptions)
+		influxWriter := meteredPointWriter{writer: batchWriter, metrics: metrics}
+		vehicles := make([]loadVehicle, 0, loadOptions.Vehicles)
+		for index := range loadOptions.Vehicles {
+			client, err := newBuilder("simulator-vehicle-"+vehicleID(index), nil).Build(ctx)
+			if err != nil {
+				log.Fatalf("[SIMULATOR_MAIN] couldn't connect vehicle %s: %s\n", vehicleID(index), err.Error())
+			}
+			vehicles = append(vehicles, loadVehicle{
+				ID:          vehicleID(index),
+				TopicPrefix: loadOptions.vehicleTopicPrefix(index),
+				Messages:    loadOptions.vehicleMessages(messages, index),
+				Publisher:   NewResilientPublisher(instrumentedPublisher{publisher: meteredPublisher{publisher: client, metrics: metrics}, stats: stats}, retryPolicy, nil),
+			})
+		}
+		log.Printf("[SIMULATOR_MAIN] load test with %d vehicles at %.1f signals/s\n", len(vehicles), signalRate(vehicles[0].Messages)*float64(len(vehicles)))
+
+		if loadOptions.Duration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, loadOptions.Duration)
+			defer cancel()
+		}
+		publish := func(ctx context.Context, vehicle loadVehicle, message SimulatedMessage, timestamp time.Time) error {
+			values := simulatedValues(message, timestamp, rng, nil, nil)
+			if *messageMode {
+				return sendMessage(ctx, vehicle.Publisher, influxWriter, payloadEncoding, vehicle.TopicPrefix+"/"+messageTopic(*messageTopicPrefix, message), values, timestamp)
+			}
+			for _, value := range values {
+				if err := sendSignal(ctx, vehicle.Publisher, influxWriter, payloadEncoding, value.Signal, value.Value, timestamp); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		err := runLoad(ctx, vehicles, stats, loadOptions.ReportInterval, publish)
+		closeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := batchWriter.Close(closeCtx); err != nil {
+			log.Printf("[SIMULATOR_MAIN] InfluxDB writes failed: %s\n", err.Error())
+		}
+		log.Printf("[SIMULATOR_LOAD] total %s\n", stats.Total(time.Now()))
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] load test failed: %s\n", err.Error())
+		}
+		return
+	}
+
+	builder := newBuilder("simulator", nil)
+
+	var fanout *MessageFanout
+	var bridge *InfluxBridge
+	received := make(chan receivedMessage, 1024)
+	if *fanoutMode || *bridgeMode {
+		clientID, filter := "simulator-bridge", bridgeFilter
+		if *fanoutMode {
+			fanout = NewMessageFanout(messages, *messageTopicPrefix, payloadEncoding)
+			clientID, filter = "simulator-fanout", fanout.Filter()
+		} else {
+			bridge = NewInfluxBridge(messages)
+		}
+		builder = newBuilder(clientID, func(cm *autopaho.ConnectionManager) {
+			log.Printf("[SIMULATOR_MAIN] subscribing to %s\n", filter)
+			subscription := &paho.Subscribe{Subscriptions: []paho.SubscribeOptions{{Topic: filter}}}
+			if _, err := cm.Subscribe(context.Background(), subscription); err != nil {
+				log.Printf("[SIMULATOR_MAIN] couldn't subscribe to %s: %s\n", filter, err.Error())
+			}
 		}).
-		AddClientId("simulator").
-		Build(ctx)
+			AddOnPublishReceived(func(pr paho.PublishReceived) (bool, error) {
+				message := receivedMessage{Topic: pr.Packet.Topic, Payload: pr.Packet.Payload}
+				if pr.Packet.Properties != nil {
+					message.ContentType = pr.Packet.Properties.ContentType
+				}
+				select {
+				case received <- message:
+				case <-ctx.Done():
+				}
+				return true, nil
+			})
+	}
+
+	client, err := builder.Build(ctx)
 	if err != nil {
 		log.Fatalf("[SIMULATOR_MAIN] couldn't create MQTT simulator: %s\n", err.Error())
 		os.Exit(1)
 	}
 	log.Println("[SIMULATOR_MAIN] MQTT simulator started")
 
-	influxWriter, err := NewInfluxWriterFromEnvironment()
+	spoolOptions, err := SpoolOptionsFromEnvironment()
+	if err != nil {
+		log.Fatalf("[SIMULATOR_MAIN] couldn't configure the spool: %s\n", err.Error())
+	}
+	mqttSpool, err := spoolOptions.open("mqtt", ".jsonl")
+	if err != nil {
+		log.Fatalf("[SIMULATOR_MAIN] couldn't open MQTT spool: %s\n", err.Error())
+	}
+	influxSpool, err := spoolOptions.open("influxdb", ".lp")
 	if err != nil {
-		log.Fatalf("[SIMULATOR_MAIN] couldn't create InfluxDB writer: %s\n", err.Error())
+		log.Fatalf("[SIMULATOR_MAIN] couldn't open InfluxDB spool: %s\n", err.Error())
 	}
-	log.Println("[SIMULATOR_MAIN] InfluxDB writer started")
+	if spoolOptions.Dir != "" {
+		log.Printf("[SIMULATOR_MAIN] spooling undelivered writes to %s (%d MQTT and %d InfluxDB bytes pending)\n", spoolOptions.Dir, mqttSpool.Size(), influxSpool.Size())
+	}
+	metrics.WatchSpool("mqtt", mqttSpool)
+	metrics.WatchSpool("influxdb", influxSpool)
+	publisher := NewResilientPublisher(meteredPublisher{publisher: client, metrics: metrics}, retryPolicy, mqttSpool)
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			data, err := generateRandomData()
-			if err != nil {
-				log.Fatalf("[SIMULATOR_MAIN] couldn't generate data: %s\n", err.Error())
-			}
+	if fanout != nil {
+		log.Printf("[SIMULATOR_MAIN] fanning out %d messages from %s\n", len(messages), fanout.Filter())
+		if err := runFanout(ctx, received, fanout, publisher); err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] fan-out failed: %s\n", err.Error())
+		}
+		return
+	}
+
+	// The impaired link sits between the simulated car and the broker, so
+	// fan-out, which runs on the pit side, is not affected.
+	var link *Link
+	var impaired *ImpairedPublisher
+	livePublisher := Publisher(publisher)
+	var influxLines lineWriter = directWriter
+	if impairment != nil {
+		link = NewLink(*impairment, rng)
+		impaired = NewImpairedPublisher(publisher, link)
+		livePublisher = impaired
+		if *impairInflux {
+			influxLines = impairedLineWriter{writer: directWriter, link: link}
+		}
+		log.Printf("[SIMULATOR_MAIN] impairing the link to the broker (InfluxDB too: %t) with %s\n", *impairInflux, impairment)
+	}
 
-			i := rand.Intn(len(topics))
-			topic := topics[i]
-			writeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	batchWriter := NewInfluxBatchWriter(NewResilientLineWriter(meteredLineWriter{writer: influxLines, metrics: metrics}, retryPolicy, influxSpool), batchOptions)
+	influxWriter := meteredPointWriter{writer: batchWriter, metrics: metrics}
+	closeWriters := func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if impaired != nil {
+			if err := impaired.Close(closeCtx); err != nil {
+				log.Printf("[SIMULATOR_MAIN] %s\n", err.Error())
+			}
+		}
+		if err := batchWriter.Close(closeCtx); err != nil {
+			log.Printf("[SIMULATOR_MAIN] InfluxDB writes failed: %s\n", err.Error())
+		}
+	}
+	if !*skipInflux {
+		log.Println("[SIMULATOR_MAIN] InfluxDB writer started")
+	}
 
-			if err := client.Publish(writeCtx, topic, data); err != nil {
-				cancel()
-				log.Fatalf("[SIMULATOR_MAIN] couldn't send data: %s\n", err.Error())
+	if *replayPath != "" {
+		publish := func(ctx context.Context, signal SimulatedSignal, value float64, timestamp time.Time) error {
+			if controller != nil {
+				var ok bool
+				if value, ok = controller.Adjust(signal.Topic, value); !ok {
+					return nil
+				}
 			}
-			if err := influxWriter.Write(writeCtx, topic, data); err != nil {
-				cancel()
-				log.Fatalf("[SIMULATOR_MAIN] couldn't write data to InfluxDB: %s\n", err.Error())
+			return publishSignal(ctx, livePublisher, influxWriter, payloadEncoding, signal, value, link.skew(timestamp))
+		}
+		_, err := runReplay(ctx, replayFrames, NewMessageDecoder(messages), replayOptions, publish)
+		closeWriters()
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] replay failed: %s\n", err.Error())
+		}
+		return
+	}
+
+	if bridge != nil {
+		log.Printf("[SIMULATOR_MAIN] bridging %d topics from %s to InfluxDB\n", len(bridge.signals), bridgeFilter)
+		_, err := runBridge(ctx, received, bridge, influxWriter, metrics)
+		closeWriters()
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] bridge failed: %s\n", err.Error())
+		}
+		return
+	}
+
+	if *gatewaySource != "" {
+		source, err := OpenCANSource(*gatewaySource)
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] couldn't open CAN source: %s\n", err.Error())
+		}
+		log.Printf("[SIMULATOR_MAIN] decoding CAN frames from %s\n", *gatewaySource)
+		publish := func(ctx context.Context, signal SimulatedSignal, value float64, timestamp time.Time) error {
+			return sendSignal(ctx, livePublisher, influxWriter, payloadEncoding, signal, value, link.skew(timestamp))
+		}
+		_, err = runGateway(ctx, source, NewMessageDecoder(messages), publish)
+		closeWriters()
+		if err != nil {
+			log.Fatalf("[SIMULATOR_MAIN] gateway failed: %s\n", err.Error())
+		}
+		return
+	}
+
+	var player *ScenarioPlayer
+	if scenario != nil {
+		player = NewScenarioPlayer(scenario, time.Now(), rng)
+		if scenario.Duration > 0 && !scenario.Loop {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, scenario.Duration)
+			defer cancel()
+		}
+	}
+
+	publish := func(ctx context.Context, message SimulatedMessage, timestamp time.Time) error {
+		values := simulatedValues(message, timestamp, rng, player, controller)
+		timestamp = link.skew(timestamp)
+		if *messageMode {
+			return publishMessage(ctx, livePublisher, influxWriter, payloadEncoding, messageTopic(*messageTopicPrefix, message), values, timestamp)
+		}
+		for _, value := range values {
+			if err := publishSignal(ctx, livePublisher, influxWriter, payloadEncoding, value.Signal, value.Value, timestamp); err != nil {
+				return err
 			}
-			cancel()
-			log.Printf("[SIMULATOR_MAIN] sent data to topic: %s\n", topic)
 		}
+		return nil
+	}
+	err = runAdjustableScheduler(ctx, messages, rate, publish)
+	closeWriters()
+	if err != nil {
+		log.Fatalf("[SIMULATOR_MAIN] %s\n", err.Error())
+	}
+}
 
-		time.Sleep(time.Duration(interval) * time.Millisecond)
+// simulatedValues draws the next value of every signal of message from the
+// scenario player, if any, or at random, then applies the control API
+// overrides. Signals that must stay silent are left out.
+func simulatedValues(message SimulatedMessage, timestamp time.Time, rng *rand.Rand, player *ScenarioPlayer, controller *Controller) []DecodedSignal {
+	values := make([]DecodedSignal, 0, len(message.Signals))
+	for _, simulated := range message.Signals {
+		var value float64
+		ok := true
+		if player != nil {
+			value, ok = player.Next(simulated, timestamp)
+		} else {
+			value = simulated.randomValue(rng)
+		}
+		if ok && controller != nil {
+			value, ok = controller.Adjust(simulated.Topic, value)
+		}
+		if ok {
+			values = append(values, DecodedSignal{Signal: simulated, Value: value})
+		}
+	}
+	return values
+}
+
+// publishSignal sends one simulated sample to MQTT and stores the same payload
+// in InfluxDB.
+func publishSignal(ctx context.Context, publisher Publisher, influxWriter PointWriter, encoding PayloadEncoding, signal SimulatedSignal, value float64, timestamp time.Time) error {
+	if err := sendSignal(ctx, publisher, influxWriter, encoding, signal, value, timestamp); err != nil {
+		return err
 	}
+	log.Printf("[SIMULATOR_MAIN] sent data to topic: %s\n", signal.Topic)
+
+	return nil
 }
 
-func generateRandomData() ([]byte, error) {
-	value := rand.Float32()*1000 - 500
+// sendSignal is publishSignal without the log line, for load tests.
+func sendSignal(ctx context.Context, publisher Publisher, influxWriter PointWriter, encoding PayloadEncoding, signal SimulatedSignal, value float64, timestamp time.Time) error {
+	data, err := encoding.Encode(SignalSample{Value: value, Time: timestamp, Unit: signal.Unit})
+	if err != nil {
+		return fmt.Errorf("couldn't generate data: %w", err)
+	}
+
+	writeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
 
-	jsonPayload := struct {
-		Value float32   `json:"value"`
-		Time  time.Time `json:"time"`
-		Unit  string    `json:"unit"`
-	}{
-		Value: value,
-		Time:  time.Now(),
-		Unit:  "V",
+	if err := publisher.Publish(writeCtx, signal.Topic, data, signal.publishOptions()...); err != nil {
+		return fmt.Errorf("couldn't send data: %w", err)
 	}
+	if err := influxWriter.Write(writeCtx, signal, encoding, data); err != nil {
+		return fmt.Errorf("couldn't write data to InfluxDB: %w", err)
+	}
+
+	return nil
+}
 
-	data, err := json.Marshal(jsonPayload)
+// publishMessage sends the values of one CAN message as a single
+// message-mode payload and stores each signal in InfluxDB.
+func publishMessage(ctx context.Context, publisher Publisher, influxWriter PointWriter, encoding PayloadEncoding, topic string, values []DecodedSignal, timestamp time.Time) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if err := sendMessage(ctx, publisher, influxWriter, encoding, topic, values, timestamp); err != nil {
+		return err
+	}
+	log.Printf("[SIMULATOR_MAIN] sent %d signals to topic: %s\n", len(values), topic)
+
+	return nil
+}
+
+// sendMessage is publishMessage without the log line, for load tests.
+func sendMessage(ctx context.Context, publisher Publisher, influxWriter PointWriter, encoding PayloadEncoding, topic string, values []DecodedSignal, timestamp time.Time) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	sample := MessageSample{Time: timestamp, Values: make(map[string]float64, len(values))}
+	for _, value := range values {
+		sample.Values[value.Signal.Name] = value.Value
+	}
+	data, err := encoding.EncodeMessage(sample)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("couldn't generate data: %w", err)
+	}
+
+	writeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var options []PublishOption
+	if signal := values[0].Signal; signal.Message != "" {
+		options = append(options,
+			WithUserProperty("message", signal.Message),
+			WithUserProperty("can_id", schema.FormatMessageID(signal.MessageID)),
+		)
+	}
+	if err := publisher.Publish(writeCtx, topic, data, options...); err != nil {
+		return fmt.Errorf("couldn't send data: %w", err)
+	}
+	for _, value := range values {
+		signalData, err := encoding.Encode(SignalSample{Value: value.Value, Time: timestamp, Unit: value.Signal.Unit})
+		if err != nil {
+			return fmt.Errorf("couldn't generate data: %w", err)
+		}
+		if err := influxWriter.Write(writeCtx, value.Signal, encoding, signalData); err != nil {
+			return fmt.Errorf("couldn't write data to InfluxDB: %w", err)
+		}
 	}
 
-	return data, nil
+	return nil
 }
 
 // getDbcConfig reads and parses the config.dbc file
 func getDbcConfig(dbcFilePath string) (*vera.Config, error) {
-	dbcFile, err := os.Open(dbcFilePath)
-	if os.IsNotExist(err) && filepath.Base(dbcFilePath) == "config.dbc" {
-		dbcFilePath = filepath.Join(filepath.Dir(dbcFilePath), "config.example.dbc")
-		dbcFile, err = os.Open(dbcFilePath)
-	}
+	dbcFile, err := openDbcFile(dbcFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("error while opening DBC file: %w", err)
 	}
@@ -167,6 +744,16 @@ func getDbcConfig(dbcFilePath string) (*vera.Config, error) {
 	return config, nil
 }
 
+// openDbcFile opens the requested DBC file, falling back to the tracked
+// config.example.dbc when the ignored config.dbc has not been created.
+func openDbcFile(dbcFilePath string) (*os.File, error) {
+	dbcFile, err := os.Open(dbcFilePath)
+	if os.IsNotExist(err) && filepath.Base(dbcFilePath) == "config.dbc" {
+		dbcFile, err = os.Open(filepath.Join(filepath.Dir(dbcFilePath), "config.example.dbc"))
+	}
+	return dbcFile, err
+}
+
 // writeTopicCatalog exports the same DBC topic set used by the MQTT simulator
 // as a C header consumable by the embedded telemetry simulator.
 func writeTopicCatalog(outputPath string, topics []string) error {
@@ -1,9 +1,10 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -17,37 +18,6 @@ const validDBC = `BO_ 123 Vehicle: 8 ECU
 BA_DEF_ SG_ "VeraMqttTopic" STRING ;
 BA_ "VeraMqttTopic" SG_ 123 Speed "vehicle/speed";`
 
-func TestGenerateRandomData(t *testing.T) {
-	tests := []struct {
-		name string
-	}{
-		{name: "first payload"},
-		{name: "second payload"},
-		{name: "third payload"},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			before := time.Now()
-			data, err := generateRandomData()
-			after := time.Now()
-
-			require.NoError(t, err)
-			var payload struct {
-				Value float32   `json:"value"`
-				Time  time.Time `json:"time"`
-				Unit  string    `json:"unit"`
-			}
-			require.NoError(t, json.Unmarshal(data, &payload))
-			assert.GreaterOrEqual(t, payload.Value, float32(-500))
-			assert.Less(t, payload.Value, float32(500))
-			assert.Equal(t, "V", payload.Unit)
-			assert.False(t, payload.Time.Before(before))
-			assert.False(t, payload.Time.After(after))
-		})
-	}
-}
-
 func TestGetDbcConfig(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -189,3 +159,41 @@ func TestGetTopicsFromConfig(t *testing.T) {
 		})
 	}
 }
+
+type recordingPointWriter struct {
+	mu     sync.Mutex
+	topics []string
+}
+
+func (w *recordingPointWriter) Write(_ context.Context, signal SimulatedSignal, encoding PayloadEncoding, payload []byte) error {
+	if _, err := encoding.Decode(payload); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.topics = append(w.topics, signal.Topic)
+	return nil
+}
+
+func TestPublishMessage(t *testing.T) {
+	timestamp := time.Date(2026, 8, 10, 12, 30, 0, 0, time.UTC)
+	signals := fanoutFixture()[0].Signals
+	broker := &recordingPublisher{}
+	influx := &recordingPointWriter{}
+
+	err := publishMessage(context.Background(), broker, influx, msgpackEncoding{}, "frames/Powertrain", []DecodedSignal{
+		{Signal: signals[0], Value: 900},
+		{Signal: signals[1], Value: 85},
+	}, timestamp)
+
+	require.NoError(t, err)
+	require.Len(t, broker.published, 1, "one publish carries the whole message")
+	assert.Equal(t, "frames/Powertrain", broker.published[0].Topic)
+	sample, err := msgpackEncoding{}.DecodeMessage(broker.published[0].Payload)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"EngineSpeed": 900, "CoolantTemp": 85}, sample.Values)
+	assert.Equal(t, []string{"data/powertrain/engine/speed", "data/powertrain/engine/temperature"}, influx.topics, "InfluxDB still stores each signal")
+
+	require.NoError(t, publishMessage(context.Background(), broker, influx, msgpackEncoding{}, "frames/Powertrain", nil, timestamp))
+	assert.Len(t, broker.published, 1, "a message without values is not published")
+}
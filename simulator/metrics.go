@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are the simulator's own Prometheus metrics, served on /metrics so
+// its health can be graphed next to the telemetry it produces.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	publishes       *prometheus.CounterVec
+	publishFailures *prometheus.CounterVec
+	publishDuration prometheus.Histogram
+
+	points        *prometheus.CounterVec
+	writes        prometheus.Counter
+	writeFailures *prometheus.CounterVec
+	writeDuration prometheus.Histogram
+
+	connections      prometheus.Counter
+	reconnects       prometheus.Counter
+	connectionErrors prometheus.Counter
+
+	bridgeRejected *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	latencyBuckets := prometheus.ExponentialBuckets(0.0005, 2, 16)
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		publishes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simulator_mqtt_publishes_total",
+			Help: "MQTT messages published, by topic.",
+		}, []string{"topic"}),
+		publishFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simulator_mqtt_publish_failures_total",
+			Help: "Failed MQTT publish attempts, by kind of failure.",
+		}, []string{"kind"}),
+		publishDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "simulator_mqtt_publish_duration_seconds",
+			Help:    "Duration of successful MQTT publish attempts.",
+			Buckets: latencyBuckets,
+		}),
+		points: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simulator_influxdb_points_total",
+			Help: "Points handed to the InfluxDB writer, by topic.",
+		}, []string{"topic"}),
+		writes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "simulator_influxdb_writes_total",
+			Help: "Successful InfluxDB write requests.",
+		}),
+		writeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simulator_influxdb_write_failures_total",
+			Help: "Failed InfluxDB write attempts, by kind of failure.",
+		}, []string{"kind"}),
+		writeDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "simulator_influxdb_write_duration_seconds",
+			Help:    "Duration of successful InfluxDB write requests.",
+			Buckets: latencyBuckets,
+		}),
+		connections: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "simulator_mqtt_connections_total",
+			Help: "MQTT connections established, including the first.",
+		}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "simulator_mqtt_reconnects_total",
+			Help: "MQTT connections established after the first.",
+		}),
+		connectionErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "simulator_mqtt_connection_errors_total",
+			Help: "Failed MQTT connection attempts.",
+		}),
+		bridgeRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simulator_bridge_rejected_total",
+			Help: "MQTT messages the InfluxDB bridge skipped, by reason.",
+		}, []string{"reason"}),
+	}
+	m.registry.MustRegister(
+		m.publishes, m.publishFailures, m.publishDuration,
+		m.points, m.writes, m.writeFailures, m.writeDuration,
+		m.connections, m.reconnects, m.connectionErrors,
+		m.bridgeRejected,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ConnectionUp counts an established MQTT connection. Every connection after
+// the first of a client is a reconnect.
+func (m *Metrics) ConnectionUp(first bool) {
+	m.connections.Inc()
+	if !first {
+		m.reconnects.Inc()
+	}
+}
+
+func (m *Metrics) ConnectionError() {
+	m.connectionErrors.Inc()
+}
+
+// BridgeRejected counts a message the bridge skipped: an unknown_topic or a
+// bad_payload.
+func (m *Metrics) BridgeRejected(reason string) {
+	m.bridgeRejected.WithLabelValues(reason).Inc()
+}
+
+// WatchSpool exports the bytes and segments waiting in a spool. A nil spool
+// is not exported.
+func (m *Metrics) WatchSpool(name string, spool *Spool) {
+	if spool == nil {
+		return
+	}
+	labels := prometheus.Labels{"spool": name}
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "simulator_spool_bytes",
+			Help:        "Bytes waiting in the on-disk spool.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(spool.Size()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "simulator_spool_segments",
+			Help:        "Segment files waiting in the on-disk spool.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(spool.Len()) }),
+	)
+}
+
+// failureKind groups errors into a small set of label values.
+func failureKind(err error) string {
+	var status *InfluxStatusError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &status) && status.Temporary():
+		return "unavailable"
+	case errors.As(err, &status):
+		return "rejected"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &netErr):
+		return "network"
+	case !isRetryable(err):
+		return "invalid"
+	default:
+		return "other"
+	}
+}
+
+// meteredPublisher records every publish attempt in Metrics.
+type meteredPublisher struct {
+	publisher Publisher
+	metrics   *Metrics
+}
+
+func (p meteredPublisher) Publish(ctx context.Context, topic string, payload []byte, options ...PublishOption) error {
+	started := time.Now()
+	err := p.publisher.Publish(ctx, topic, payload, options...)
+	if err != nil {
+		p.metrics.publishFailures.WithLabelValues(failureKind(err)).Inc()
+		return err
+	}
+	p.metrics.publishDuration.Observe(time.Since(started).Seconds())
+	p.metrics.publishes.WithLabelValues(topic).Inc()
+	return nil
+}
+
+// meteredPointWriter counts the points of every topic handed to InfluxDB.
+type meteredPointWriter struct {
+	writer  PointWriter
+	metrics *Metrics
+}
+
+func (w meteredPointWriter) Write(ctx context.Context, signal SimulatedSignal, encoding PayloadEncoding, payload []byte) error {
+	if err := w.writer.Write(ctx, signal, encoding, payload); err != nil {
+		return err
+	}
+	w.metrics.points.WithLabelValues(signal.Topic).Inc()
+	return nil
+}
+
+// meteredLineWriter records every InfluxDB write attempt in Metrics.
+type meteredLineWriter struct {
+	writer  lineWriter
+	metrics *Metrics
+}
+
+func (w meteredLineWriter) WriteLines(ctx context.Context, lines []byte) error {
+	started := time.Now()
+	err := w.writer.WriteLines(ctx, lines)
+	if err != nil {
+		w.metrics.writeFailures.WithLabelValues(failureKind(err)).Inc()
+		return err
+	}
+	w.metrics.writeDuration.Observe(time.Since(started).Seconds())
+	w.metrics.writes.Inc()
+	return nil
+}
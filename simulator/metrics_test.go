@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailureKind(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "deadline", err: fmt.Errorf("publish: %w", context.DeadlineExceeded), want: "timeout"},
+		{name: "canceled", err: context.Canceled, want: "canceled"},
+		{name: "server error", err: &InfluxStatusError{StatusCode: http.StatusServiceUnavailable}, want: "unavailable"},
+		{name: "rate limited", err: &InfluxStatusError{StatusCode: http.StatusTooManyRequests}, want: "unavailable"},
+		{name: "bad request", err: &InfluxStatusError{StatusCode: http.StatusBadRequest}, want: "rejected"},
+		{name: "permanent", err: permanent(errors.New("QoS must be 0, 1 or 2")), want: "invalid"},
+		{name: "network timeout", err: &net.OpError{Op: "dial", Err: timeoutError{}}, want: "timeout"},
+		{name: "network", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: "network"},
+		{name: "other", err: errors.New("broker gone"), want: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, failureKind(tt.err))
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestMeteredPublisher(t *testing.T) {
+	metrics := NewMetrics()
+	broker := &recordingPublisher{}
+
+	require.NoError(t, meteredPublisher{publisher: broker, metrics: metrics}.Publish(context.Background(), "data/a", []byte("1"), WithQoS(1)))
+	require.NoError(t, meteredPublisher{publisher: broker, metrics: metrics}.Publish(context.Background(), "data/a", []byte("2")))
+	require.Error(t, meteredPublisher{publisher: &recordingPublisher{err: context.DeadlineExceeded}, metrics: metrics}.Publish(context.Background(), "data/b", []byte("3")))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.publishes.WithLabelValues("data/a")))
+	assert.Zero(t, testutil.ToFloat64(metrics.publishes.WithLabelValues("data/b")), "failed publishes are not counted per topic")
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.publishFailures.WithLabelValues("timeout")))
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.publishDuration))
+	assert.Equal(t, byte(1), broker.published[0].Options.QoS, "options reach the wrapped publisher")
+}
+
+func TestMeteredInfluxWriters(t *testing.T) {
+	metrics := NewMetrics()
+	points := &recordingPointWriter{}
+	signal := SimulatedSignal{Topic: "data/powertrain/engine/speed"}
+	payload, err := jsonEncoding{}.Encode(SignalSample{Value: 1})
+	require.NoError(t, err)
+
+	require.NoError(t, meteredPointWriter{writer: points, metrics: metrics}.Write(context.Background(), signal, jsonEncoding{}, payload))
+	require.NoError(t, meteredLineWriter{writer: &recordingLineWriter{}, metrics: metrics}.WriteLines(context.Background(), []byte("a 1\n")))
+	require.Error(t, meteredLineWriter{writer: &recordingLineWriter{err: &InfluxStatusError{StatusCode: http.StatusBadRequest}}, metrics: metrics}.WriteLines(context.Background(), []byte("a\n")))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.points.WithLabelValues(signal.Topic)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.writes))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.writeFailures.WithLabelValues("rejected")))
+}
+
+func TestMetricsConnections(t *testing.T) {
+	metrics := NewMetrics()
+
+	metrics.ConnectionUp(true)
+	metrics.ConnectionError()
+	metrics.ConnectionUp(false)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.connections))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.reconnects))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.connectionErrors))
+}
+
+func TestMetricsWatchSpool(t *testing.T) {
+	metrics := NewMetrics()
+	spool, err := OpenSpool(t.TempDir(), ".lp", 0)
+	require.NoError(t, err)
+	require.NoError(t, spool.Append([]byte("a 1\n")))
+
+	metrics.WatchSpool("influxdb", spool)
+	metrics.WatchSpool("mqtt", nil)
+
+	families, err := metrics.registry.Gather()
+	require.NoError(t, err)
+	gauges := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "spool" {
+					gauges[family.GetName()+"/"+label.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"simulator_spool_bytes/influxdb":    float64(spool.Size()),
+		"simulator_spool_segments/influxdb": float64(spool.Len()),
+	}, gauges, "a nil spool is not exported")
+	assert.Positive(t, gauges["simulator_spool_bytes/influxdb"])
+}
+
+func TestMetricsHandler(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.publishes.WithLabelValues("data/a").Inc()
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(body), `simulator_mqtt_publishes_total{topic="data/a"} 1`)
+	assert.Contains(t, string(body), "simulator_influxdb_write_duration_seconds_bucket")
+	assert.Contains(t, string(body), "go_goroutines")
+	problems, err := testutil.GatherAndLint(metrics.registry)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// outputRecord is one line of the --output file. JSON payloads are embedded
+// as they are; the binary encodings are base64 encoded.
+type outputRecord struct {
+	Time          time.Time       `json:"time"`
+	Topic         string          `json:"topic"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+	PayloadBase64 []byte          `json:"payload_base64,omitempty"`
+}
+
+// OutputPublisher writes every publish to a file as a JSON line stamped with
+// the simulator clock instead of sending it to the broker.
+type OutputPublisher struct {
+	clock    Clock
+	encoding PayloadEncoding
+
+	mu     sync.Mutex
+	writer *bufio.Writer
+}
+
+func NewOutputPublisher(w io.Writer, clock Clock, encoding PayloadEncoding) *OutputPublisher {
+	return &OutputPublisher{clock: clock, encoding: encoding, writer: bufio.NewWriter(w)}
+}
+
+func (p *OutputPublisher) Publish(_ context.Context, topic string, payload []byte, _ ...PublishOption) error {
+	record := outputRecord{Time: p.clock.Now().UTC(), Topic: topic}
+	if p.encoding.Name() == "json" {
+		record.Payload = payload
+	} else {
+		record.PayloadBase64 = payload
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode output record: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.writer.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write output: %w", err)
+	}
+	return nil
+}
+
+// Flush writes the buffered records to the underlying writer.
+func (p *OutputPublisher) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.writer.Flush()
+}
+
+// discardPointWriter drops every point, for runs that write to a file
+// instead of InfluxDB.
+type discardPointWriter struct{}
+
+func (discardPointWriter) Write(context.Context, SimulatedSignal, PayloadEncoding, []byte) error {
+	return nil
+}
+
+// discardLineWriter drops every batch, for runs with --skip-influxdb.
+type discardLineWriter struct{}
+
+func (discardLineWriter) WriteLines(context.Context, []byte) error {
+	return nil
+}
+
+const defaultOutputDuration = time.Minute
+
+// OutputOptions configures a file output run: the simulated clock starts at
+// Start and runs for Duration. A MessageTopicPrefix writes message-mode
+// payloads under that prefix instead of one payload per signal.
+type OutputOptions struct {
+	Start              time.Time
+	Duration           time.Duration
+	MessageTopicPrefix string
+}
+
+// parseOutputOptions validates the output flags. Without a duration the
+// output covers a non-looping scenario once, or defaultOutputDuration.
+func parseOutputOptions(start string, duration string, scenario *Scenario) (OutputOptions, error) {
+	options := OutputOptions{Start: defaultSimulatedStart, Duration: defaultOutputDuration}
+	if scenario != nil && !scenario.Loop && scenario.Duration > 0 {
+		options.Duration = scenario.Duration
+	}
+
+	var err error
+	if start != "" {
+		if options.Start, err = time.Parse(time.RFC3339Nano, start); err != nil {
+			return OutputOptions{}, errors.New("start time must be an RFC 3339 time, such as 2026-01-01T00:00:00Z")
+		}
+	}
+	if duration != "" {
+		if options.Duration, err = time.ParseDuration(duration); err != nil || options.Duration <= 0 {
+			return OutputOptions{}, errors.New("duration must be a positive duration")
+		}
+	}
+
+	return options, nil
+}
+
+// writeOutput generates options.Duration of simulated data on a simulated
+// clock and writes every publish to w. The same options, messages, scenario,
+// rng seed and encoding always produce the same bytes.
+func writeOutput(ctx context.Context, w io.Writer, options OutputOptions, messages []SimulatedMessage, scenario *Scenario, rng *rand.Rand, encoding PayloadEncoding) error {
+	clock := newSimulatedClock(options.Start)
+	publisher := NewOutputPublisher(w, clock, encoding)
+	var player *ScenarioPlayer
+	if scenario != nil {
+		player = NewScenarioPlayer(scenario, options.Start, rng)
+	}
+
+	err := runSimulatedScheduler(ctx, messages, clock, options.Duration, func(ctx context.Context, message SimulatedMessage, timestamp time.Time) error {
+		values := simulatedValues(message, timestamp, rng, player, nil)
+		if options.MessageTopicPrefix != "" {
+			return sendMessage(ctx, publisher, discardPointWriter{}, encoding, messageTopic(options.MessageTopicPrefix, message), values, timestamp)
+		}
+		for _, value := range values {
+			if err := sendSignal(ctx, publisher, discardPointWriter{}, encoding, value.Signal, value.Value, timestamp); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return publisher.Flush()
+}
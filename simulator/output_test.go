@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func outputFixture() []SimulatedMessage {
+	return []SimulatedMessage{
+		{ID: 256, Name: "Powertrain", CycleTime: 250 * time.Millisecond, Signals: []SimulatedSignal{
+			{Topic: "data/powertrain/engine/speed", Name: "EngineSpeed", Unit: "rpm", Length: 16, Factor: 0.25, Max: 16000},
+			{Topic: "data/powertrain/engine/temperature", Name: "CoolantTemp", Unit: "degC", Length: 8, Factor: 1, Offset: -40, Min: -40, Max: 215},
+		}},
+		{ID: 512, Name: "Battery", CycleTime: 500 * time.Millisecond, Signals: []SimulatedSignal{
+			{Topic: "data/battery/voltage", Name: "PackVoltage", Unit: "V", Length: 16, Factor: 0.01, Max: 600},
+		}},
+	}
+}
+
+func TestParseOutputOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    string
+		duration string
+		scenario *Scenario
+		want     OutputOptions
+		wantErr  string
+	}{
+		{name: "defaults", want: OutputOptions{Start: defaultSimulatedStart, Duration: defaultOutputDuration}},
+		{
+			name:  "custom",
+			start: "2026-08-10T12:00:00Z", duration: "10m",
+			want: OutputOptions{Start: time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC), Duration: 10 * time.Minute},
+		},
+		{
+			name:     "scenario duration",
+			scenario: &Scenario{Duration: 90 * time.Second},
+			want:     OutputOptions{Start: defaultSimulatedStart, Duration: 90 * time.Second},
+		},
+		{
+			name:     "looping scenario",
+			scenario: &Scenario{Duration: 90 * time.Second, Loop: true},
+			want:     OutputOptions{Start: defaultSimulatedStart, Duration: defaultOutputDuration},
+		},
+		{name: "malformed start", start: "yesterday", wantErr: "start time must be an RFC 3339 time, such as 2026-01-01T00:00:00Z"},
+		{name: "zero duration", duration: "0s", wantErr: "duration must be a positive duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOutputOptions(tt.start, tt.duration, tt.scenario)
+
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOutputPublisher(t *testing.T) {
+	clock := newSimulatedClock(time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC))
+	var output bytes.Buffer
+	publisher := NewOutputPublisher(&output, clock, jsonEncoding{})
+
+	require.NoError(t, publisher.Publish(context.Background(), "data/a", []byte(`{"value":1}`)))
+	clock.set(clock.Now().Add(time.Second))
+	require.NoError(t, publisher.Publish(context.Background(), "data/b", []byte(`{"value":2}`)))
+	assert.Empty(t, output.String(), "records are buffered until Flush")
+	require.NoError(t, publisher.Flush())
+
+	assert.Equal(t, `{"time":"2026-08-10T12:00:00Z","topic":"data/a","payload":{"value":1}}
+{"time":"2026-08-10T12:00:01Z","topic":"data/b","payload":{"value":2}}
+`, output.String())
+
+	output.Reset()
+	binary := NewOutputPublisher(&output, clock, cborEncoding{})
+	require.NoError(t, binary.Publish(context.Background(), "data/a", []byte{0x83, 0x01}))
+	require.NoError(t, binary.Flush())
+	assert.Equal(t, `{"time":"2026-08-10T12:00:01Z","topic":"data/a","payload_base64":"gwE="}`+"\n", output.String())
+}
+
+func TestWriteOutputIsDeterministic(t *testing.T) {
+	options := OutputOptions{Start: defaultSimulatedStart, Duration: 10 * time.Second}
+	generate := func(seed int64, encoding PayloadEncoding, options OutputOptions) []byte {
+		var output bytes.Buffer
+		require.NoError(t, writeOutput(context.Background(), &output, options, outputFixture(), nil, newRand(seed), encoding))
+		return output.Bytes()
+	}
+
+	for name, encoding := range payloadEncodings {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, generate(7, encoding, options), generate(7, encoding, options))
+			assert.NotEqual(t, generate(7, encoding, options), generate(8, encoding, options))
+
+			messageOptions := options
+			messageOptions.MessageTopicPrefix = "frames"
+			assert.Equal(t, generate(7, encoding, messageOptions), generate(7, encoding, messageOptions))
+		})
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(generate(7, jsonEncoding{}, options))), "\n")
+	// 40 Powertrain ticks of two signals and 20 Battery ticks of one.
+	assert.Len(t, lines, 100)
+}
+
+func TestWriteOutputGolden(t *testing.T) {
+	scenario := &Scenario{Duration: 2 * time.Second, Topics: map[string][]ScenarioSegment{
+		"data/powertrain/engine/temperature": {
+			{Type: segmentRamp, Start: 0, Duration: 4 * time.Second, From: 80, To: 100},
+		},
+	}}
+	options, err := parseOutputOptions("", "", scenario)
+	require.NoError(t, err)
+	options.MessageTopicPrefix = "frames"
+
+	var output bytes.Buffer
+	require.NoError(t, writeOutput(context.Background(), &output, options, outputFixture(), scenario, newRand(1), jsonEncoding{}))
+
+	golden := filepath.Join("testdata", "output.golden.jsonl")
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(golden, output.Bytes(), 0o644))
+	}
+	want, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), output.String(), "run go test -update to accept a deliberate change")
+
+	var first outputRecord
+	require.NoError(t, json.Unmarshal(bytes.SplitN(output.Bytes(), []byte("\n"), 2)[0], &first))
+	assert.Equal(t, "frames/Powertrain", first.Topic)
+	assert.Equal(t, defaultSimulatedStart.Add(250*time.Millisecond), first.Time)
+}
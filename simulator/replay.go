@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplayOptions controls how recorded frames are paced and timestamped.
+type ReplayOptions struct {
+	// Speed multiplies the recorded pace; zero replays as fast as possible.
+	Speed float64
+	// RewriteTimestamps moves every frame to the wall-clock time at which it
+	// is replayed, so the capture appears live. Unpaced frames are stamped
+	// with the time they are sent.
+	RewriteTimestamps bool
+}
+
+// ReplayStats summarises one replay run.
+type ReplayStats struct {
+	Frames        int
+	UnknownFrames int
+	DecodeErrors  int
+	Signals       int
+}
+
+// parseReplaySpeed accepts "realtime", "max", or a multiplier such as "4x".
+func parseReplaySpeed(value string) (float64, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "realtime", "real-time":
+		return 1, nil
+	case "max", "fast":
+		return 0, nil
+	}
+
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("replay speed must be realtime, max, or a positive multiplier such as 4x: %q", value)
+	}
+	return speed, nil
+}
+
+// runReplay decodes frames with decoder and hands every published signal to
+// publish, pacing frames by their recorded timestamps.
+func runReplay(
+	ctx context.Context,
+	frames []CANFrame,
+	decoder *MessageDecoder,
+	options ReplayOptions,
+	publish func(context.Context, SimulatedSignal, float64, time.Time) error,
+) (ReplayStats, error) {
+	stats := ReplayStats{}
+	if len(frames) == 0 {
+		return stats, nil
+	}
+
+	wallStart := time.Now()
+	captureStart := frames[0].Time
+	for _, frame := range frames {
+		offset := frame.Time.Sub(captureStart)
+		if options.Speed > 0 {
+			wait := time.Until(wallStart.Add(time.Duration(float64(offset) / options.Speed)))
+			if wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return stats, nil
+				case <-timer.C:
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return stats, nil
+		}
+
+		timestamp := frame.Time
+		if options.RewriteTimestamps {
+			// An unpaced replay runs ahead of the capture, so its frames are
+			// stamped when they are sent rather than in the future.
+			timestamp = time.Now()
+			if options.Speed > 0 {
+				timestamp = wallStart.Add(time.Duration(float64(offset) / options.Speed))
+			}
+		}
+
+		stats.Frames++
+		decoded, known, err := decoder.Decode(frame)
+		if err != nil {
+			// A truncated frame on the bench must not end a long replay.
+			stats.DecodeErrors++
+			log.Printf("[SIMULATOR_REPLAY] skipping frame 0x%X: %s\n", frame.ID, err.Error())
+			continue
+		}
+		if !known {
+			stats.UnknownFrames++
+			continue
+		}
+		for _, signal := range decoded {
+			if err := publish(ctx, signal.Signal, signal.Value, timestamp); err != nil {
+				return stats, err
+			}
+			stats.Signals++
+		}
+	}
+
+	log.Printf("[SIMULATOR_REPLAY] replayed %d frames (%d unknown, %d undecodable), %d signals\n", stats.Frames, stats.UnknownFrames, stats.DecodeErrors, stats.Signals)
+	return stats, nil
+}
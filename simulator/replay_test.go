@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReplaySpeed(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{value: "", want: 1},
+		{value: "realtime", want: 1},
+		{value: "max", want: 0},
+		{value: "4x", want: 4},
+		{value: "0.5", want: 0.5},
+		{value: "0x", wantErr: true},
+		{value: "-2x", wantErr: true},
+		{value: "quick", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseReplaySpeed(tt.value)
+
+			if tt.wantErr {
+				require.ErrorContains(t, err, "replay speed must be")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+type replayedSignal struct {
+	topic     string
+	value     float64
+	timestamp time.Time
+}
+
+func replayFixture() ([]CANFrame, *MessageDecoder) {
+	start := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	frames := []CANFrame{
+		{Time: start, ID: 256, Data: []byte{0x10, 0x27}},
+		{Time: start.Add(20 * time.Millisecond), ID: 0x7FF, Data: []byte{0}},
+		{Time: start.Add(40 * time.Millisecond), ID: 256, Data: []byte{0x01}},
+		{Time: start.Add(60 * time.Millisecond), ID: 256, Data: []byte{0x20, 0x4E}},
+	}
+	decoder := NewMessageDecoder([]SimulatedMessage{{
+		ID: 256, Name: "Powertrain",
+		Signals: []SimulatedSignal{{Topic: "data/powertrain/engine/speed", Name: "EngineSpeed", Length: 16, Factor: 0.25}},
+	}})
+	return frames, decoder
+}
+
+func TestRunReplay(t *testing.T) {
+	frames, decoder := replayFixture()
+	tests := []struct {
+		name        string
+		options     ReplayOptions
+		minDuration time.Duration
+	}{
+		{name: "as fast as possible keeps recorded timestamps", options: ReplayOptions{Speed: 0}},
+		{name: "real time", options: ReplayOptions{Speed: 1}, minDuration: 60 * time.Millisecond},
+		{name: "double speed rewrites timestamps", options: ReplayOptions{Speed: 2, RewriteTimestamps: true}, minDuration: 30 * time.Millisecond},
+		{name: "as fast as possible stamps frames when sent", options: ReplayOptions{Speed: 0, RewriteTimestamps: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var published []replayedSignal
+			before := time.Now()
+
+			stats, err := runReplay(context.Background(), frames, decoder, tt.options, func(_ context.Context, signal SimulatedSignal, value float64, timestamp time.Time) error {
+				published = append(published, replayedSignal{topic: signal.Topic, value: value, timestamp: timestamp})
+				return nil
+			})
+
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, time.Since(before), tt.minDuration)
+			assert.Equal(t, ReplayStats{Frames: 4, UnknownFrames: 1, DecodeErrors: 1, Signals: 2}, stats)
+			require.Len(t, published, 2)
+			assert.Equal(t, 2500.0, published[0].value)
+			assert.Equal(t, 5000.0, published[1].value)
+			assert.Equal(t, "data/powertrain/engine/speed", published[0].topic)
+			if tt.options.RewriteTimestamps {
+				assert.False(t, published[0].timestamp.Before(before))
+				assert.False(t, published[1].timestamp.After(time.Now()), "no frame is stamped in the future")
+				if tt.options.Speed > 0 {
+					assert.Equal(t, 30*time.Millisecond, published[1].timestamp.Sub(published[0].timestamp))
+				}
+			} else {
+				assert.Equal(t, frames[0].Time, published[0].timestamp)
+				assert.Equal(t, frames[3].Time, published[1].timestamp)
+			}
+		})
+	}
+}
+
+func TestRunReplayStopsOnPublishError(t *testing.T) {
+	frames, decoder := replayFixture()
+	publishErr := errors.New("broker unavailable")
+
+	stats, err := runReplay(context.Background(), frames, decoder, ReplayOptions{}, func(context.Context, SimulatedSignal, float64, time.Time) error {
+		return publishErr
+	})
+
+	require.ErrorIs(t, err, publishErr)
+	assert.Equal(t, 1, stats.Frames)
+}
+
+func TestRunReplayStopsWhenCanceled(t *testing.T) {
+	frames, decoder := replayFixture()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	stats, err := runReplay(ctx, frames, decoder, ReplayOptions{Speed: 0.01}, func(context.Context, SimulatedSignal, float64, time.Time) error {
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Frames)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Publisher publishes one payload to an MQTT topic. MQTTClient and
+// ResilientPublisher implement it.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, payload []byte, options ...PublishOption) error
+}
+
+// spoolDisabled as SIMULATOR_SPOOL_DIR turns spooling off.
+const spoolDisabled = "off"
+
+// SpoolOptions configures where undeliverable writes are kept. An empty Dir
+// disables spooling, so writes fail once their retries are exhausted.
+type SpoolOptions struct {
+	Dir      string
+	MaxBytes int64
+}
+
+// SpoolOptionsFromEnvironment reads SIMULATOR_SPOOL_DIR and
+// SIMULATOR_SPOOL_MAX_BYTES, the limit applied to each spool. The spool is
+// kept in the temporary directory by default, so a broker or InfluxDB
+// restart does not stop the simulator; "off" disables it.
+func SpoolOptionsFromEnvironment() (SpoolOptions, error) {
+	options := SpoolOptions{
+		Dir:      environmentOrDefault("SIMULATOR_SPOOL_DIR", filepath.Join(os.TempDir(), "ephoros-simulator-spool")),
+		MaxBytes: defaultSpoolMaxBytes,
+	}
+	if strings.EqualFold(options.Dir, spoolDisabled) {
+		options.Dir = ""
+	}
+	if raw := os.Getenv("SIMULATOR_SPOOL_MAX_BYTES"); raw != "" {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || value <= 0 {
+			return SpoolOptions{}, errors.New("SIMULATOR_SPOOL_MAX_BYTES must be a positive integer")
+		}
+		options.MaxBytes = value
+	}
+	return options, nil
+}
+
+// open returns the spool kept in the named subdirectory, or nil when
+// spooling is disabled.
+func (o SpoolOptions) open(name string, extension string) (*Spool, error) {
+	if o.Dir == "" {
+		return nil, nil
+	}
+	return OpenSpool(filepath.Join(o.Dir, name), extension, o.MaxBytes)
+}
+
+// ResilientLineWriter retries failed InfluxDB writes and, once the retries
+// are exhausted, keeps the lines in a spool that is replayed in order ahead
+// of the next batch.
+type ResilientLineWriter struct {
+	writer lineWriter
+	policy RetryPolicy
+	spool  *Spool
+
+	mu sync.Mutex
+}
+
+func NewResilientLineWriter(writer lineWriter, policy RetryPolicy, spool *Spool) *ResilientLineWriter {
+	return &ResilientLineWriter{writer: writer, policy: policy, spool: spool}
+}
+
+func (w *ResilientLineWriter) WriteLines(ctx context.Context, lines []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.drain(ctx); err != nil {
+		// InfluxDB is still unavailable: queue behind the spooled lines so
+		// they keep their order.
+		return w.keep(lines, err)
+	}
+
+	err := w.policy.Do(ctx, func(ctx context.Context) error {
+		return w.writer.WriteLines(ctx, lines)
+	})
+	if err == nil || !isRetryable(err) {
+		return err
+	}
+	return w.keep(lines, err)
+}
+
+// drain replays spooled lines with a single attempt per segment, so an
+// outage does not cost a full retry cycle on every batch. Segments InfluxDB
+// rejects outright are dropped rather than blocking the spool forever.
+func (w *ResilientLineWriter) drain(ctx context.Context) error {
+	if w.spool == nil || w.spool.Len() == 0 {
+		return nil
+	}
+	return w.spool.Drain(ctx, func(ctx context.Context, lines []byte) error {
+		err := w.writer.WriteLines(ctx, lines)
+		if err != nil && !isRetryable(err) {
+			log.Printf("[SIMULATOR_INFLUX] dropping spooled lines InfluxDB rejected: %s\n", err.Error())
+			return nil
+		}
+		return err
+	})
+}
+
+func (w *ResilientLineWriter) keep(lines []byte, cause error) error {
+	if w.spool == nil {
+		return cause
+	}
+	if err := w.spool.Append(lines); err != nil {
+		return errors.Join(cause, err)
+	}
+	log.Printf("[SIMULATOR_INFLUX] spooled %d bytes until InfluxDB is reachable: %s\n", len(lines), cause.Error())
+	return nil
+}
+
+// spooledPublish is one line of the MQTT spool. Options holds what the
+// publish changed from the client defaults.
+type spooledPublish struct {
+	Topic   string         `json:"topic"`
+	Payload []byte         `json:"payload"`
+	Options PublishOptions `json:"options,omitzero"`
+}
+
+// spoolDrainTimeout bounds one attempt to republish the MQTT spool. It is
+// longer than a publish timeout, so a full segment can be sent in one go
+// once the broker is back instead of being restarted on every attempt.
+const spoolDrainTimeout = 2 * time.Minute
+
+// ResilientPublisher retries failed MQTT publishes and, once the retries are
+// exhausted, spools them. While the spool holds messages, new ones queue
+// behind them and one background goroutine republishes them in order, so
+// callers never wait for an outage to end.
+type ResilientPublisher struct {
+	publisher Publisher
+	policy    RetryPolicy
+	spool     *Spool
+
+	// mu guards the spool bookkeeping: appending and starting the drain.
+	mu       sync.Mutex
+	draining bool
+	drains   sync.WaitGroup
+}
+
+func NewResilientPublisher(publisher Publisher, policy RetryPolicy, spool *Spool) *ResilientPublisher {
+	return &ResilientPublisher{publisher: publisher, policy: policy, spool: spool}
+}
+
+func (p *ResilientPublisher) Publish(ctx context.Context, topic string, payload []byte, options ...PublishOption) error {
+	if p.spool != nil {
+		p.mu.Lock()
+		if p.draining || p.spool.Len() > 0 {
+			// Queue behind the spooled messages so they keep their order.
+			defer p.mu.Unlock()
+			err := p.keep(topic, payload, options, nil)
+			p.startDrain()
+			return err
+		}
+		p.mu.Unlock()
+	}
+
+	err := p.policy.Do(ctx, func(ctx context.Context) error {
+		return p.publisher.Publish(ctx, topic, payload, options...)
+	})
+	if err == nil || !isRetryable(err) || p.spool == nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.keep(topic, payload, options, err); err != nil {
+		return err
+	}
+	p.startDrain()
+	return nil
+}
+
+// startDrain starts the drain goroutine unless it is running. The caller
+// holds p.mu.
+func (p *ResilientPublisher) startDrain() {
+	if p.draining {
+		return
+	}
+	p.draining = true
+	p.drains.Add(1)
+	go func() {
+		defer p.drains.Done()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), spoolDrainTimeout)
+			err := p.drain(ctx)
+			cancel()
+
+			p.mu.Lock()
+			if err != nil || p.spool.Len() == 0 {
+				// After a failure the next publish starts another attempt.
+				p.draining = false
+				p.mu.Unlock()
+				if err != nil {
+					log.Printf("[SIMULATOR_MQTT] spooled messages wait for the broker: %s\n", err.Error())
+				}
+				return
+			}
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// wait blocks until the drain goroutine has stopped.
+func (p *ResilientPublisher) wait() {
+	p.drains.Wait()
+}
+
+// drain republishes spooled messages once each. A segment that fails part
+// way through is replayed from its start next time, so subscribers may see
+// a message twice but never lose one. Messages the broker rejects outright
+// are dropped, like malformed records.
+func (p *ResilientPublisher) drain(ctx context.Context) error {
+	return p.spool.Drain(ctx, func(ctx context.Context, segment []byte) error {
+		scanner := bufio.NewScanner(bytes.NewReader(segment))
+		scanner.Buffer(make([]byte, 0, 64<<10), spoolSegmentBytes)
+		for scanner.Scan() {
+			var record spooledPublish
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				log.Printf("[SIMULATOR_MQTT] skipping malformed spooled message: %s\n", err.Error())
+				continue
+			}
+			if err := p.publisher.Publish(ctx, record.Topic, record.Payload, withPublishOptions(record.Options)); err != nil {
+				if !isRetryable(err) {
+					// No retry will ever deliver it, so it must not block
+					// the messages behind it.
+					log.Printf("[SIMULATOR_MQTT] dropping spooled message to %s: %s\n", record.Topic, err.Error())
+					continue
+				}
+				return err
+			}
+		}
+		return scanner.Err()
+	})
+}
+
+// keep appends one message to the spool. cause is the publish failure that
+// led here, or nil for a message queued behind the spool.
+func (p *ResilientPublisher) keep(topic string, payload []byte, options []PublishOption, cause error) error {
+	record, err := json.Marshal(spooledPublish{Topic: topic, Payload: payload, Options: resolvePublishOptions(PublishOptions{}, options)})
+	if err != nil {
+		return errors.Join(cause, fmt.Errorf("encode spooled message: %w", err))
+	}
+	if err := p.spool.Append(append(record, '\n')); err != nil {
+		return errors.Join(cause, err)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRetryPolicy = RetryPolicy{Attempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func TestSpoolOptionsFromEnvironment(t *testing.T) {
+	t.Setenv("SIMULATOR_SPOOL_DIR", "/var/lib/ephoros/spool")
+	t.Setenv("SIMULATOR_SPOOL_MAX_BYTES", "1024")
+
+	got, err := SpoolOptionsFromEnvironment()
+	require.NoError(t, err)
+	assert.Equal(t, SpoolOptions{Dir: "/var/lib/ephoros/spool", MaxBytes: 1024}, got)
+
+	t.Setenv("SIMULATOR_SPOOL_DIR", "")
+	got, err = SpoolOptionsFromEnvironment()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(os.TempDir(), "ephoros-simulator-spool"), got.Dir, "spooling is on by default")
+
+	t.Setenv("SIMULATOR_SPOOL_DIR", "off")
+	got, err = SpoolOptionsFromEnvironment()
+	require.NoError(t, err)
+	assert.Empty(t, got.Dir)
+
+	t.Setenv("SIMULATOR_SPOOL_MAX_BYTES", "lots")
+	_, err = SpoolOptionsFromEnvironment()
+	require.EqualError(t, err, "SIMULATOR_SPOOL_MAX_BYTES must be a positive integer")
+
+	disabled, err := SpoolOptions{}.open("influxdb", ".lp")
+	require.NoError(t, err)
+	assert.Nil(t, disabled)
+}
+
+func TestResilientLineWriterSpoolsUntilInfluxDBReturns(t *testing.T) {
+	lines := &recordingLineWriter{err: &InfluxStatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}}
+	spool, err := OpenSpool(t.TempDir(), ".lp", 0)
+	require.NoError(t, err)
+	writer := NewResilientLineWriter(lines, testRetryPolicy, spool)
+
+	require.NoError(t, writer.WriteLines(context.Background(), []byte("a 1\n")))
+	require.NoError(t, writer.WriteLines(context.Background(), []byte("b 2\n")))
+	assert.Equal(t, int64(8), spool.Size())
+	assert.Len(t, lines.recorded(), 3, "two attempts for the first batch and one drain attempt before the second is spooled")
+
+	lines.mu.Lock()
+	lines.err = nil
+	lines.batches = nil
+	lines.mu.Unlock()
+	require.NoError(t, writer.WriteLines(context.Background(), []byte("c 3\n")))
+
+	assert.Equal(t, []string{"a 1\nb 2\n", "c 3\n"}, lines.recorded())
+	assert.Equal(t, 0, spool.Len())
+}
+
+func TestResilientLineWriterDoesNotSpoolRejectedLines(t *testing.T) {
+	rejected := &InfluxStatusError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request"}
+	lines := &recordingLineWriter{err: rejected}
+	spool, err := OpenSpool(t.TempDir(), ".lp", 0)
+	require.NoError(t, err)
+
+	err = NewResilientLineWriter(lines, testRetryPolicy, spool).WriteLines(context.Background(), []byte("bad\n"))
+
+	require.ErrorIs(t, err, rejected)
+	assert.Len(t, lines.recorded(), 1)
+	assert.Equal(t, 0, spool.Len())
+}
+
+func TestResilientLineWriterWithoutSpoolReturnsError(t *testing.T) {
+	unavailable := errors.New("connection refused")
+
+	err := NewResilientLineWriter(&recordingLineWriter{err: unavailable}, testRetryPolicy, nil).WriteLines(context.Background(), []byte("a 1\n"))
+
+	require.ErrorIs(t, err, unavailable)
+}
+
+type recordingPublisher struct {
+	mu        sync.Mutex
+	err       error
+	published []spooledPublish
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, topic string, payload []byte, options ...PublishOption) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, spooledPublish{Topic: topic, Payload: payload, Options: resolvePublishOptions(PublishOptions{}, options)})
+	return nil
+}
+
+func TestResilientPublisherReplaysSpoolInOrder(t *testing.T) {
+	broker := &recordingPublisher{err: errors.New("connection down")}
+	directory := t.TempDir()
+	spool, err := OpenSpool(directory, ".jsonl", 0)
+	require.NoError(t, err)
+	publisher := NewResilientPublisher(broker, testRetryPolicy, spool)
+
+	require.NoError(t, publisher.Publish(context.Background(), "data/a", []byte(`{"value":1}`)))
+	require.NoError(t, publisher.Publish(context.Background(), "data/b", []byte("binary\n\x00"), WithRetain(true), WithUserProperty("unit", "rpm")))
+	publisher.wait()
+
+	// A restarted simulator finds the spooled messages and sends them first.
+	reopened, err := OpenSpool(directory, ".jsonl", 0)
+	require.NoError(t, err)
+	broker.mu.Lock()
+	broker.err = nil
+	broker.mu.Unlock()
+	restarted := NewResilientPublisher(broker, testRetryPolicy, reopened)
+	require.NoError(t, restarted.Publish(context.Background(), "data/c", []byte(`{"value":3}`)))
+	restarted.wait()
+
+	assert.Equal(t, []spooledPublish{
+		{Topic: "data/a", Payload: []byte(`{"value":1}`)},
+		{Topic: "data/b", Payload: []byte("binary\n\x00"), Options: PublishOptions{
+			Retain:         true,
+			UserProperties: paho.UserProperties{{Key: "unit", Value: "rpm"}},
+		}},
+		{Topic: "data/c", Payload: []byte(`{"value":3}`)},
+	}, broker.published)
+	assert.Equal(t, 0, reopened.Len())
+}
+
+// blockingPublisher fails while the broker is down, and otherwise blocks
+// until released, like a client waiting for its connection to come back.
+type blockingPublisher struct {
+	recordingPublisher
+	release chan struct{}
+}
+
+func (p *blockingPublisher) Publish(ctx context.Context, topic string, payload []byte, options ...PublishOption) error {
+	p.mu.Lock()
+	down := p.err != nil
+	p.mu.Unlock()
+	if !down {
+		select {
+		case <-p.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return p.recordingPublisher.Publish(ctx, topic, payload, options...)
+}
+
+func TestResilientPublisherDoesNotBlockPublishersWhileDraining(t *testing.T) {
+	broker := &blockingPublisher{recordingPublisher: recordingPublisher{err: errors.New("connection down")}, release: make(chan struct{})}
+	spool, err := OpenSpool(t.TempDir(), ".jsonl", 0)
+	require.NoError(t, err)
+	publisher := NewResilientPublisher(broker, testRetryPolicy, spool)
+	require.NoError(t, publisher.Publish(context.Background(), "data/a", []byte("1")))
+	publisher.wait()
+
+	broker.mu.Lock()
+	broker.err = nil
+	broker.mu.Unlock()
+	// The drain blocks on the broker; later publishes queue behind it at
+	// once instead of waiting, even with a context that has expired.
+	require.NoError(t, publisher.Publish(context.Background(), "data/b", []byte("2")))
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan error, 1)
+	go func() { done <- publisher.Publish(expired, "data/c", []byte("3")) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("publish waited for the drain")
+	}
+
+	close(broker.release)
+	publisher.wait()
+
+	var topics []string
+	for _, published := range broker.published {
+		topics = append(topics, published.Topic)
+	}
+	assert.Equal(t, []string{"data/a", "data/b", "data/c"}, topics)
+	assert.Equal(t, 0, spool.Len())
+}
+
+// rejectingPublisher rejects publishes to one topic as no retry could fix.
+type rejectingPublisher struct {
+	recordingPublisher
+	rejected string
+}
+
+func (p *rejectingPublisher) Publish(ctx context.Context, topic string, payload []byte, options ...PublishOption) error {
+	if topic == p.rejected {
+		return permanent(errors.New("topic not authorized"))
+	}
+	return p.recordingPublisher.Publish(ctx, topic, payload, options...)
+}
+
+func TestResilientPublisherDropsSpooledMessagesTheBrokerRejects(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), ".jsonl", 0)
+	require.NoError(t, err)
+	for _, topic := range []string{"data/a", "data/forbidden", "data/b"} {
+		record, err := json.Marshal(spooledPublish{Topic: topic, Payload: []byte("1")})
+		require.NoError(t, err)
+		require.NoError(t, spool.Append(append(record, '\n')))
+	}
+	broker := &rejectingPublisher{rejected: "data/forbidden"}
+	publisher := NewResilientPublisher(broker, testRetryPolicy, spool)
+
+	require.NoError(t, publisher.Publish(context.Background(), "data/c", []byte("2")))
+	publisher.wait()
+
+	var topics []string
+	for _, published := range broker.published {
+		topics = append(topics, published.Topic)
+	}
+	assert.Equal(t, []string{"data/a", "data/b", "data/c"}, topics)
+	assert.Equal(t, 0, spool.Len())
+}
+
+func TestResilientPublisherDoesNotSpoolPermanentErrors(t *testing.T) {
+	invalid := permanent(errors.New("QoS must be 0, 1 or 2"))
+	spool, err := OpenSpool(t.TempDir(), ".jsonl", 0)
+	require.NoError(t, err)
+
+	err = NewResilientPublisher(&recordingPublisher{err: invalid}, testRetryPolicy, spool).Publish(context.Background(), "data/a", []byte(`{"value":1}`), WithQoS(3))
+
+	require.ErrorIs(t, err, invalid)
+	assert.Equal(t, 0, spool.Len())
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryAttempts       = 5
+	defaultRetryInitialBackoff = 200 * time.Millisecond
+	defaultRetryMaxBackoff     = 30 * time.Second
+)
+
+// RetryPolicy retries an operation with exponential backoff: the n-th retry
+// waits InitialBackoff*2^(n-1), capped at MaxBackoff, or longer when the
+// server asks for it with Retry-After.
+type RetryPolicy struct {
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// RetryPolicyFromEnvironment reads SIMULATOR_RETRY_ATTEMPTS and the
+// millisecond SIMULATOR_RETRY_INITIAL_BACKOFF and SIMULATOR_RETRY_MAX_BACKOFF.
+func RetryPolicyFromEnvironment() (RetryPolicy, error) {
+	policy := RetryPolicy{
+		Attempts:       defaultRetryAttempts,
+		InitialBackoff: defaultRetryInitialBackoff,
+		MaxBackoff:     defaultRetryMaxBackoff,
+	}
+
+	for _, setting := range []struct {
+		name   string
+		assign func(int)
+	}{
+		{"SIMULATOR_RETRY_ATTEMPTS", func(value int) { policy.Attempts = value }},
+		{"SIMULATOR_RETRY_INITIAL_BACKOFF", func(value int) { policy.InitialBackoff = time.Duration(value) * time.Millisecond }},
+		{"SIMULATOR_RETRY_MAX_BACKOFF", func(value int) { policy.MaxBackoff = time.Duration(value) * time.Millisecond }},
+	} {
+		raw := os.Getenv(setting.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			return RetryPolicy{}, fmt.Errorf("%s must be a positive integer", setting.name)
+		}
+		setting.assign(value)
+	}
+
+	return policy, nil
+}
+
+// Do runs op until it succeeds, fails permanently, runs out of attempts or
+// ctx is done, and returns the last error.
+func (p RetryPolicy) Do(ctx context.Context, op func(context.Context) error) error {
+	attempts := max(p.Attempts, 1)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = op(ctx); err == nil || !isRetryable(err) || attempt >= attempts {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		var hinted interface{ RetryAfter() time.Duration }
+		if errors.As(err, &hinted) && hinted.RetryAfter() > delay {
+			delay = hinted.RetryAfter()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
+
+// isRetryable treats every failure as transient unless it reports otherwise
+// through a Temporary method, like rejected InfluxDB line protocol does.
+func isRetryable(err error) bool {
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) {
+		return temporary.Temporary()
+	}
+	return true
+}
+
+// permanentError marks a failure that no retry can fix, such as an invalid
+// request.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string   { return e.err.Error() }
+func (e permanentError) Unwrap() error   { return e.err }
+func (e permanentError) Temporary() bool { return false }
+
+func permanent(err error) error {
+	return permanentError{err: err}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyFromEnvironment(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment map[string]string
+		want        RetryPolicy
+		wantErr     string
+	}{
+		{
+			name: "defaults",
+			want: RetryPolicy{Attempts: defaultRetryAttempts, InitialBackoff: defaultRetryInitialBackoff, MaxBackoff: defaultRetryMaxBackoff},
+		},
+		{
+			name:        "custom values",
+			environment: map[string]string{"SIMULATOR_RETRY_ATTEMPTS": "3", "SIMULATOR_RETRY_INITIAL_BACKOFF": "50", "SIMULATOR_RETRY_MAX_BACKOFF": "1000"},
+			want:        RetryPolicy{Attempts: 3, InitialBackoff: 50 * time.Millisecond, MaxBackoff: time.Second},
+		},
+		{name: "invalid", environment: map[string]string{"SIMULATOR_RETRY_ATTEMPTS": "often"}, wantErr: "SIMULATOR_RETRY_ATTEMPTS must be a positive integer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"SIMULATOR_RETRY_ATTEMPTS", "SIMULATOR_RETRY_INITIAL_BACKOFF", "SIMULATOR_RETRY_MAX_BACKOFF"} {
+				t.Setenv(name, tt.environment[name])
+			}
+
+			got, err := RetryPolicyFromEnvironment()
+
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	var got []time.Duration
+	for attempt := 1; attempt <= 6; attempt++ {
+		got = append(got, policy.backoff(attempt))
+	}
+
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}, got)
+}
+
+type permanentTestError struct{}
+
+func (permanentTestError) Error() string   { return "rejected" }
+func (permanentTestError) Temporary() bool { return false }
+
+type retryAfterTestError struct{ delay time.Duration }
+
+func (e retryAfterTestError) Error() string             { return "slow down" }
+func (e retryAfterTestError) RetryAfter() time.Duration { return e.delay }
+
+func TestRetryPolicyDo(t *testing.T) {
+	unavailable := errors.New("unavailable")
+	tests := []struct {
+		name         string
+		failures     []error
+		wantAttempts int
+		wantErr      error
+		minDuration  time.Duration
+	}{
+		{name: "first attempt succeeds", wantAttempts: 1},
+		{name: "succeeds after transient failures", failures: []error{unavailable, unavailable}, wantAttempts: 3},
+		{name: "gives up after all attempts", failures: []error{unavailable, unavailable, unavailable}, wantAttempts: 3, wantErr: unavailable},
+		{name: "permanent error is not retried", failures: []error{permanentTestError{}}, wantAttempts: 1, wantErr: permanentTestError{}},
+		{name: "honors retry after", failures: []error{retryAfterTestError{delay: 30 * time.Millisecond}}, wantAttempts: 2, minDuration: 30 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+			attempts := 0
+			before := time.Now()
+
+			err := policy.Do(context.Background(), func(context.Context) error {
+				attempts++
+				if attempts <= len(tt.failures) {
+					return tt.failures[attempts-1]
+				}
+				return nil
+			})
+
+			assert.Equal(t, tt.wantAttempts, attempts)
+			assert.GreaterOrEqual(t, time.Since(before), tt.minDuration)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRetryPolicyDoStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	unavailable := errors.New("unavailable")
+
+	err := RetryPolicy{Attempts: 10, InitialBackoff: time.Hour}.Do(ctx, func(context.Context) error {
+		return unavailable
+	})
+
+	require.ErrorIs(t, err, unavailable)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, isRetryable(err), "an interrupted retry can still be spooled")
+}
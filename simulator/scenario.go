@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario scripts the values of individual topics over time. Topics without
+// an active segment keep producing random values within their DBC range.
+//
+// Scenario files are YAML (or JSON, which YAML accepts):
+//
+//	name: coolant overheat, then battery silent
+//	duration: 90s
+//	topics:
+//	  data/powertrain/engine/coolant:
+//	    - {type: ramp, start: 0s, duration: 30s, from: 80, to: 125}
+//	    - {type: step, start: 30s, value: 125}
+//	  data/battery/voltage:
+//	    - {type: dropout, start: 40s, duration: 20s}
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Duration stops the simulator once elapsed, unless Loop restarts the
+	// timeline. Zero runs until interrupted.
+	Duration time.Duration                `yaml:"duration"`
+	Loop     bool                         `yaml:"loop"`
+	Topics   map[string][]ScenarioSegment `yaml:"topics"`
+}
+
+// ScenarioSegment is one behaviour of a topic, active from Start for Duration,
+// or until the next open-ended segment when Duration is zero.
+type ScenarioSegment struct {
+	Type     string        `yaml:"type"`
+	Start    time.Duration `yaml:"start"`
+	Duration time.Duration `yaml:"duration"`
+
+	// Value is the constant of step and spike, and the centre of noise.
+	Value *float64 `yaml:"value"`
+	// From and To bound a ramp.
+	From float64 `yaml:"from"`
+	To   float64 `yaml:"to"`
+	// Offset, Amplitude and Period shape a sine; Amplitude also bounds noise.
+	Offset    float64       `yaml:"offset"`
+	Amplitude float64       `yaml:"amplitude"`
+	Period    time.Duration `yaml:"period"`
+}
+
+const (
+	// segmentStep publishes a constant value.
+	segmentStep = "step"
+	// segmentRamp moves linearly from From to To over the segment duration.
+	segmentRamp = "ramp"
+	// segmentSine oscillates around Offset.
+	segmentSine = "sine"
+	// segmentHold repeats the last published value, like a stuck sensor.
+	segmentHold = "hold"
+	// segmentDropout publishes nothing, so the topic goes stale.
+	segmentDropout = "dropout"
+	// segmentNoise adds uniform noise of ±Amplitude around Value, or around
+	// the last published value when Value is unset.
+	segmentNoise = "noise"
+	// segmentSpike publishes Value as is, even outside the DBC range.
+	segmentSpike = "spike"
+)
+
+// LoadScenario reads and validates a scenario file against the DBC signals.
+func LoadScenario(path string, signals []SimulatedSignal) (*Scenario, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read scenario: %w", err)
+	}
+
+	return parseScenario(contents, signals)
+}
+
+func parseScenario(contents []byte, signals []SimulatedSignal) (*Scenario, error) {
+	scenario := &Scenario{}
+	if err := yaml.Unmarshal(contents, scenario); err != nil {
+		return nil, fmt.Errorf("decode scenario: %w", err)
+	}
+	if err := scenario.validate(signals); err != nil {
+		return nil, err
+	}
+
+	for _, segments := range scenario.Topics {
+		sort.SliceStable(segments, func(i, j int) bool { return segments[i].Start < segments[j].Start })
+	}
+	return scenario, nil
+}
+
+func (s *Scenario) validate(signals []SimulatedSignal) error {
+	if s.Duration < 0 {
+		return errors.New("scenario duration cannot be negative")
+	}
+	if s.Loop && s.Duration == 0 {
+		return errors.New("a looping scenario needs a duration")
+	}
+
+	known := make(map[string]struct{}, len(signals))
+	for _, signal := range signals {
+		known[signal.Topic] = struct{}{}
+	}
+	for topic, segments := range s.Topics {
+		if _, ok := known[topic]; !ok {
+			return fmt.Errorf("scenario topic %q is not defined in the DBC", topic)
+		}
+		for i, segment := range segments {
+			if err := segment.validate(); err != nil {
+				return fmt.Errorf("segment %d of topic %q: %w", i, topic, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s ScenarioSegment) validate() error {
+	if s.Start < 0 || s.Duration < 0 {
+		return errors.New("start and duration cannot be negative")
+	}
+
+	switch s.Type {
+	case segmentStep, segmentSpike:
+		if s.Value == nil {
+			return fmt.Errorf("%s needs a value", s.Type)
+		}
+	case segmentRamp:
+		if s.Duration == 0 {
+			return errors.New("ramp needs a duration")
+		}
+	case segmentSine:
+		if s.Period <= 0 {
+			return errors.New("sine needs a positive period")
+		}
+	case segmentNoise:
+		if s.Amplitude < 0 {
+			return errors.New("noise amplitude cannot be negative")
+		}
+	case segmentHold, segmentDropout:
+	default:
+		return fmt.Errorf("unknown segment type %q", s.Type)
+	}
+	return nil
+}
+
+// activeSegment returns the latest segment that has started and not yet ended
+// at elapsed. An open-ended segment lasts until the next open-ended one
+// starts, so once a bounded segment ends, the segment it interrupted takes
+// over again, such as a ramp or a step interrupted by a spike.
+func (s *Scenario) activeSegment(topic string, elapsed time.Duration) (ScenarioSegment, bool) {
+	segments := s.Topics[topic]
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		if segment.Start > elapsed {
+			continue
+		}
+		// The latest open-ended segment that has started is active, as are
+		// bounded segments until their end.
+		if segment.Duration == 0 || elapsed < segment.Start+segment.Duration {
+			return segment, true
+		}
+	}
+	return ScenarioSegment{}, false
+}
+
+// ScenarioPlayer evaluates a scenario against the simulator clock, drawing
+// random values from rng. It is safe for concurrent use by the per-message
+// scheduler goroutines.
+type ScenarioPlayer struct {
+	scenario *Scenario
+	start    time.Time
+	rng      *rand.Rand
+
+	mu         sync.Mutex
+	lastValues map[string]float64
+}
+
+func NewScenarioPlayer(scenario *Scenario, start time.Time, rng *rand.Rand) *ScenarioPlayer {
+	return &ScenarioPlayer{
+		scenario:   scenario,
+		start:      start,
+		rng:        rng,
+		lastValues: make(map[string]float64),
+	}
+}
+
+// Elapsed returns the position on the scenario timeline, wrapped for looping
+// scenarios.
+func (p *ScenarioPlayer) Elapsed(now time.Time) time.Duration {
+	elapsed := now.Sub(p.start)
+	if elapsed < 0 {
+		return 0
+	}
+	if p.scenario.Loop {
+		elapsed %= p.scenario.Duration
+	}
+	return elapsed
+}
+
+// Next returns the value to publish for signal at now, and false when the
+// signal must stay silent.
+func (p *ScenarioPlayer) Next(signal SimulatedSignal, now time.Time) (float64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	last, ok := p.lastValues[signal.Topic]
+	if !ok {
+		last = signal.randomValue(p.rng)
+	}
+	segment, active := p.scenario.activeSegment(signal.Topic, p.Elapsed(now))
+
+	var value float64
+	switch {
+	case !active:
+		value = signal.randomValue(p.rng)
+	case segment.Type == segmentDropout:
+		return 0, false
+	case segment.Type == segmentSpike:
+		value = *segment.Value
+		p.lastValues[signal.Topic] = value
+		return value, true
+	case segment.Type == segmentHold:
+		value = last
+	default:
+		value = segment.value(p.Elapsed(now)-segment.Start, last, p.rng)
+	}
+
+	value = signal.quantize(value)
+	p.lastValues[signal.Topic] = value
+	return value, true
+}
+
+// value evaluates the time-dependent segment types at offset into the segment.
+func (s ScenarioSegment) value(offset time.Duration, last float64, rng *rand.Rand) float64 {
+	switch s.Type {
+	case segmentStep:
+		return *s.Value
+	case segmentRamp:
+		progress := math.Min(float64(offset)/float64(s.Duration), 1)
+		return s.From + (s.To-s.From)*progress
+	case segmentSine:
+		return s.Offset + s.Amplitude*math.Sin(2*math.Pi*float64(offset)/float64(s.Period))
+	case segmentNoise:
+		centre := last
+		if s.Value != nil {
+			centre = *s.Value
+		}
+		return centre + (rng.Float64()*2-1)*s.Amplitude
+	}
+	return last
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var scenarioSignals = []SimulatedSignal{
+	{Topic: "data/powertrain/engine/coolant", Length: 8, Factor: 1, Offset: -40, Min: -40, Max: 215, Unit: "degC"},
+	{Topic: "data/battery/voltage", Length: 16, Factor: 0.01, Max: 65.535, Unit: "V"},
+}
+
+func float64PointerForScenario(value float64) *float64 { return &value }
+
+func TestParseScenario(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{
+			name: "yaml",
+			contents: `name: overheat
+duration: 90s
+topics:
+  data/powertrain/engine/coolant:
+    - {type: step, start: 30s, value: 125}
+    - {type: ramp, start: 0s, duration: 30s, from: 80, to: 125}
+  data/battery/voltage:
+    - {type: dropout, start: 40s, duration: 20s}`,
+		},
+		{
+			name:     "json",
+			contents: `{"name":"overheat","duration":"90s","topics":{"data/battery/voltage":[{"type":"sine","period":"10s","offset":12,"amplitude":1}]}}`,
+		},
+		{name: "malformed", contents: `topics: [`, wantErr: "decode scenario"},
+		{name: "unknown topic", contents: "topics:\n  data/unknown:\n    - {type: hold}", wantErr: `scenario topic "data/unknown" is not defined in the DBC`},
+		{name: "unknown type", contents: "topics:\n  data/battery/voltage:\n    - {type: wobble}", wantErr: `unknown segment type "wobble"`},
+		{name: "step without value", contents: "topics:\n  data/battery/voltage:\n    - {type: step}", wantErr: "step needs a value"},
+		{name: "ramp without duration", contents: "topics:\n  data/battery/voltage:\n    - {type: ramp, to: 10}", wantErr: "ramp needs a duration"},
+		{name: "sine without period", contents: "topics:\n  data/battery/voltage:\n    - {type: sine}", wantErr: "sine needs a positive period"},
+		{name: "negative start", contents: "topics:\n  data/battery/voltage:\n    - {type: hold, start: -1s}", wantErr: "cannot be negative"},
+		{name: "loop without duration", contents: "loop: true", wantErr: "a looping scenario needs a duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scenario, err := parseScenario([]byte(tt.contents), scenarioSignals)
+
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "overheat", scenario.Name)
+			assert.Equal(t, 90*time.Second, scenario.Duration)
+			for _, segments := range scenario.Topics {
+				for i := 1; i < len(segments); i++ {
+					assert.LessOrEqual(t, segments[i-1].Start, segments[i].Start)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("name: file\ntopics:\n  data/battery/voltage:\n    - {type: hold}\n"), 0o600))
+
+	scenario, err := LoadScenario(path, scenarioSignals)
+	require.NoError(t, err)
+	assert.Equal(t, "file", scenario.Name)
+
+	_, err = LoadScenario(filepath.Join(t.TempDir(), "missing.yaml"), scenarioSignals)
+	require.ErrorContains(t, err, "read scenario")
+}
+
+func TestScenarioPlayerNext(t *testing.T) {
+	coolant, voltage := scenarioSignals[0], scenarioSignals[1]
+	scenario := &Scenario{Topics: map[string][]ScenarioSegment{
+		coolant.Topic: {
+			{Type: segmentRamp, Start: 0, Duration: 30 * time.Second, From: 80, To: 120},
+			{Type: segmentStep, Start: 30 * time.Second, Duration: 10 * time.Second, Value: float64PointerForScenario(125)},
+			{Type: segmentHold, Start: 40 * time.Second, Duration: 5 * time.Second},
+			{Type: segmentSpike, Start: 45 * time.Second, Duration: time.Second, Value: float64PointerForScenario(900)},
+			{Type: segmentSine, Start: 50 * time.Second, Duration: 10 * time.Second, Offset: 90, Amplitude: 10, Period: 4 * time.Second},
+			{Type: segmentStep, Start: 60 * time.Second, Duration: time.Second, Value: float64PointerForScenario(1000)},
+		},
+		voltage.Topic: {
+			{Type: segmentDropout, Start: 10 * time.Second, Duration: 5 * time.Second},
+			{Type: segmentNoise, Start: 20 * time.Second, Duration: 5 * time.Second, Value: float64PointerForScenario(12), Amplitude: 0.5},
+		},
+	}}
+	start := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	player := NewScenarioPlayer(scenario, start, newRand(1))
+	at := func(offset time.Duration) time.Time { return start.Add(offset) }
+	next := func(signal SimulatedSignal, offset time.Duration) float64 {
+		value, ok := player.Next(signal, at(offset))
+		require.True(t, ok)
+		return value
+	}
+
+	assert.Equal(t, 80.0, next(coolant, 0))
+	assert.Equal(t, 100.0, next(coolant, 15*time.Second))
+	assert.Equal(t, 125.0, next(coolant, 35*time.Second))
+	assert.Equal(t, 125.0, next(coolant, 42*time.Second), "hold repeats the last value")
+	assert.Equal(t, 900.0, next(coolant, 45*time.Second), "spikes bypass the DBC range")
+	assert.Equal(t, 100.0, next(coolant, 51*time.Second))
+	assert.Equal(t, 215.0, next(coolant, 60*time.Second), "steps are clamped to the DBC range")
+	random := next(coolant, 70*time.Second)
+	assert.GreaterOrEqual(t, random, coolant.Min)
+	assert.LessOrEqual(t, random, coolant.Max)
+
+	_, ok := player.Next(voltage, at(12*time.Second))
+	assert.False(t, ok, "dropouts publish nothing")
+	_, ok = player.Next(voltage, at(15*time.Second))
+	assert.True(t, ok, "dropouts end after their duration")
+	noisy := next(voltage, 21*time.Second)
+	assert.InDelta(t, 12, noisy, 0.5)
+}
+
+func TestScenarioActiveSegmentResumesInterruptedSegment(t *testing.T) {
+	ramp := ScenarioSegment{Type: segmentRamp, Start: 0, Duration: 60 * time.Second, From: 0, To: 60}
+	spike := ScenarioSegment{Type: segmentSpike, Start: 10 * time.Second, Duration: time.Second, Value: float64PointerForScenario(900)}
+	step := ScenarioSegment{Type: segmentStep, Start: 30 * time.Second, Value: float64PointerForScenario(5)}
+	stepSpike := ScenarioSegment{Type: segmentSpike, Start: 60 * time.Second, Duration: 2 * time.Second, Value: float64PointerForScenario(900)}
+	hold := ScenarioSegment{Type: segmentHold, Start: 90 * time.Second}
+	scenario := &Scenario{Topics: map[string][]ScenarioSegment{"data/a/b": {ramp, spike, step, stepSpike, hold}}}
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    ScenarioSegment
+	}{
+		{name: "ramp", elapsed: 5 * time.Second, want: ramp},
+		{name: "spike inside the ramp", elapsed: 10 * time.Second, want: spike},
+		{name: "ramp after the spike", elapsed: 11 * time.Second, want: ramp},
+		{name: "open-ended step", elapsed: 45 * time.Second, want: step},
+		{name: "spike inside the step", elapsed: 61 * time.Second, want: stepSpike},
+		{name: "step after the spike", elapsed: 62 * time.Second, want: step},
+		{name: "next open-ended segment ends the step", elapsed: 90 * time.Second, want: hold},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			segment, active := scenario.activeSegment("data/a/b", test.elapsed)
+
+			assert.True(t, active)
+			assert.Equal(t, test.want, segment)
+		})
+	}
+
+	_, active := (&Scenario{Topics: map[string][]ScenarioSegment{"data/a/b": {ramp}}}).activeSegment("data/a/b", 61*time.Second)
+	assert.False(t, active, "nothing is active after the last bounded segment")
+}
+
+func TestScenarioPlayerStepResumesAfterSpike(t *testing.T) {
+	coolant := scenarioSignals[0]
+	scenario := &Scenario{Topics: map[string][]ScenarioSegment{coolant.Topic: {
+		{Type: segmentStep, Start: 30 * time.Second, Value: float64PointerForScenario(95)},
+		{Type: segmentSpike, Start: 60 * time.Second, Duration: 2 * time.Second, Value: float64PointerForScenario(900)},
+	}}}
+	start := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	player := NewScenarioPlayer(scenario, start, newRand(1))
+
+	for _, test := range []struct {
+		offset time.Duration
+		want   float64
+	}{{30 * time.Second, 95}, {60 * time.Second, 900}, {62 * time.Second, 95}, {10 * time.Minute, 95}} {
+		value, ok := player.Next(coolant, start.Add(test.offset))
+		require.True(t, ok)
+		assert.Equal(t, test.want, value, "at %s", test.offset)
+	}
+}
+
+func TestScenarioPlayerElapsedLoops(t *testing.T) {
+	start := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		scenario *Scenario
+		offset   time.Duration
+		want     time.Duration
+	}{
+		{name: "linear", scenario: &Scenario{Duration: time.Minute}, offset: 90 * time.Second, want: 90 * time.Second},
+		{name: "looping", scenario: &Scenario{Duration: time.Minute, Loop: true}, offset: 90 * time.Second, want: 30 * time.Second},
+		{name: "before start", scenario: &Scenario{}, offset: -time.Second, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			player := NewScenarioPlayer(tt.scenario, start, newRand(1))
+			assert.Equal(t, tt.want, player.Elapsed(start.Add(tt.offset)))
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ApexCorse/vera"
+)
+
+const defaultCycleTimeAttribute = "GenMsgCycleTime"
+
+// SimulatedMessage groups the published signals of one DBC message, which a
+// real ECU transmits together in a single frame every CycleTime.
+type SimulatedMessage struct {
+	ID        uint32
+	Name      string
+	CycleTime time.Duration
+	Signals   []SimulatedSignal
+}
+
+// getMessagesFromConfig returns the messages that carry at least one MQTT
+// topic. Messages without an entry in cycleTimes use defaultCycleTime.
+func getMessagesFromConfig(config *vera.Config, cycleTimes map[uint32]time.Duration, defaultCycleTime time.Duration) []SimulatedMessage {
+	messages := make([]SimulatedMessage, 0)
+	for _, message := range config.Messages {
+		signals := getSignalsFromConfig(&vera.Config{Messages: []vera.Message{message}})
+		if len(signals) == 0 {
+			continue
+		}
+
+		cycleTime, ok := cycleTimes[message.ID]
+		if !ok {
+			cycleTime = defaultCycleTime
+		}
+		messages = append(messages, SimulatedMessage{
+			ID:        message.ID,
+			Name:      message.Name,
+			CycleTime: cycleTime,
+			Signals:   signals,
+		})
+	}
+
+	return messages
+}
+
+// getMessageCycleTimes reads a numeric millisecond message attribute, such as
+// GenMsgCycleTime, straight from the DBC file. Vera only models the
+// signal-scoped attributes Ephoros defines, so message attributes are scanned
+// here instead.
+func getMessageCycleTimes(dbcFilePath string, attribute string) (map[uint32]time.Duration, error) {
+	dbcFile, err := openDbcFile(dbcFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening DBC file: %w", err)
+	}
+	defer dbcFile.Close()
+
+	return parseMessageCycleTimes(dbcFile, attribute)
+}
+
+func parseMessageCycleTimes(r io.Reader, attribute string) (map[uint32]time.Duration, error) {
+	cycleTimes := make(map[uint32]time.Duration)
+	values, err := parseMessageAttribute(r, attribute)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, value := range values {
+		milliseconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || milliseconds < 0 {
+			return nil, fmt.Errorf("%s for message %d must be a non-negative number of milliseconds: %q", attribute, id, value)
+		}
+		if milliseconds == 0 {
+			// Event-triggered messages declare a zero cycle time.
+			continue
+		}
+		cycleTimes[id] = time.Duration(milliseconds * float64(time.Millisecond))
+	}
+
+	return cycleTimes, nil
+}
+
+// parseMessageAttribute collects the raw values of `BA_ "<attribute>" BO_ <id>
+// <value>;` assignments, keyed by message ID.
+func parseMessageAttribute(r io.Reader, attribute string) (map[uint32]string, error) {
+	values := make(map[uint32]string)
+	prefix := "BA_ " + strconv.Quote(attribute) + " BO_ "
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(line, prefix), ";"))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed %s assignment: %s", attribute, line)
+		}
+		id, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed message ID in %s assignment: %s", attribute, line)
+		}
+		values[uint32(id)] = strings.Trim(fields[1], `"`)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read DBC file: %w", err)
+	}
+
+	return values, nil
+}
+
+// runMessageScheduler publishes every message on its own ticker until ctx is
+// done or publish fails. All signals of one message share the timestamp of the
+// tick, just like the values of a single CAN frame.
+func runMessageScheduler(ctx context.Context, messages []SimulatedMessage, publish func(context.Context, SimulatedMessage, time.Time) error) error {
+	return runAdjustableScheduler(ctx, messages, nil, publish)
+}
+
+// schedulerRate is the rate multiplier runAdjustableScheduler divides cycle
+// times by. Controller implements it.
+type schedulerRate interface {
+	RateMultiplier() float64
+	// RateChanged returns a channel that is closed at the next change of the
+	// rate or of the paused state.
+	RateChanged() <-chan struct{}
+}
+
+// runAdjustableScheduler is runMessageScheduler with every cycle time divided
+// by the rate multiplier. Every ticker restarts as soon as the rate changes,
+// so a slowed down message does not finish its long period first. A nil rate
+// keeps the DBC cycle times.
+func runAdjustableScheduler(ctx context.Context, messages []SimulatedMessage, rate schedulerRate, publish func(context.Context, SimulatedMessage, time.Time) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		speed    func() float64
+	)
+	for _, message := range messages {
+		if message.CycleTime <= 0 {
+			return fmt.Errorf("cycle time for message %q must be positive", message.Name)
+		}
+	}
+	if rate != nil {
+		speed = rate.RateMultiplier
+	}
+
+	for _, message := range messages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// A nil channel never fires, so without a rate only ticks do.
+			var changed <-chan struct{}
+			if rate != nil {
+				changed = rate.RateChanged()
+			}
+			ticker := time.NewTicker(scaledCycleTime(message.CycleTime, speed))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-changed:
+					changed = rate.RateChanged()
+					ticker.Reset(scaledCycleTime(message.CycleTime, speed))
+				case tick := <-ticker.C:
+					if err := publish(ctx, message, tick); err != nil {
+						if ctx.Err() != nil {
+							return
+						}
+						once.Do(func() {
+							firstErr = fmt.Errorf("publish message %q: %w", message.Name, err)
+							cancel()
+						})
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+func scaledCycleTime(cycleTime time.Duration, speed func() float64) time.Duration {
+	if speed == nil {
+		return cycleTime
+	}
+	return max(time.Duration(float64(cycleTime)/speed()), time.Microsecond)
+}
+
+// runSimulatedScheduler publishes duration worth of messages as fast as
+// possible, in time order and from a single goroutine, setting clock to each
+// tick before publishing it. Messages due at the same tick publish in the
+// order given, so the same messages always produce the same sequence.
+func runSimulatedScheduler(ctx context.Context, messages []SimulatedMessage, clock *simulatedClock, duration time.Duration, publish func(context.Context, SimulatedMessage, time.Time) error) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	start := clock.Now()
+	end := start.Add(duration)
+	next := make([]time.Time, len(messages))
+	for i, message := range messages {
+		if message.CycleTime <= 0 {
+			return fmt.Errorf("cycle time for message %q must be positive", message.Name)
+		}
+		next[i] = start.Add(message.CycleTime)
+	}
+
+	for ctx.Err() == nil {
+		due := 0
+		for i := range next {
+			if next[i].Before(next[due]) {
+				due = i
+			}
+		}
+		if next[due].After(end) {
+			return nil
+		}
+		clock.set(next[due])
+		if err := publish(ctx, messages[due], next[due]); err != nil {
+			return fmt.Errorf("publish message %q: %w", messages[due].Name, err)
+		}
+		next[due] = next[due].Add(messages[due].CycleTime)
+	}
+	return nil
+}
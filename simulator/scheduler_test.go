@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ApexCorse/vera"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMessagesFromConfig(t *testing.T) {
+	config := &vera.Config{Messages: []vera.Message{
+		{ID: 256, Name: "Powertrain", Signals: []vera.Signal{
+			{Name: "EngineSpeed", Metadata: vera.SignalMetadata{MQTTTopic: "data/powertrain/engine/speed"}},
+			{Name: "OilPressure", Metadata: vera.SignalMetadata{MQTTTopic: "data/powertrain/engine/oil-pressure"}},
+		}},
+		{ID: 257, Name: "Unpublished", Signals: []vera.Signal{{Name: "Debug"}}},
+		{ID: 258, Name: "Battery", Signals: []vera.Signal{
+			{Name: "BatteryVoltage", Metadata: vera.SignalMetadata{MQTTTopic: "data/battery/voltage"}},
+		}},
+	}}
+
+	messages := getMessagesFromConfig(config, map[uint32]time.Duration{256: 10 * time.Millisecond}, time.Second)
+
+	require.Len(t, messages, 2)
+	assert.Equal(t, "Powertrain", messages[0].Name)
+	assert.Equal(t, uint32(256), messages[0].ID)
+	assert.Equal(t, 10*time.Millisecond, messages[0].CycleTime)
+	require.Len(t, messages[0].Signals, 2)
+	assert.Equal(t, "data/powertrain/engine/oil-pressure", messages[0].Signals[1].Topic)
+	assert.Equal(t, "Battery", messages[1].Name)
+	assert.Equal(t, time.Second, messages[1].CycleTime)
+}
+
+func TestParseMessageCycleTimes(t *testing.T) {
+	tests := []struct {
+		name      string
+		attribute string
+		dbc       string
+		want      map[uint32]time.Duration
+		wantErr   string
+	}{
+		{
+			name:      "reads message attribute",
+			attribute: defaultCycleTimeAttribute,
+			dbc: `BA_DEF_ BO_ "GenMsgCycleTime" INT 0 10000;
+BA_ "GenMsgCycleTime" BO_ 256 10;
+  BA_ "GenMsgCycleTime" BO_ 257 1000;
+BA_ "GenMsgCycleTime" BO_ 258 0;
+BA_ "VeraMqttTopic" SG_ 256 EngineSpeed "data/powertrain/engine/speed";`,
+			want: map[uint32]time.Duration{256: 10 * time.Millisecond, 257: time.Second},
+		},
+		{
+			name:      "custom attribute name",
+			attribute: "CycleTime",
+			dbc:       `BA_ "GenMsgCycleTime" BO_ 256 10;` + "\n" + `BA_ "CycleTime" BO_ 256 2.5;`,
+			want:      map[uint32]time.Duration{256: 2500 * time.Microsecond},
+		},
+		{name: "no attribute", attribute: defaultCycleTimeAttribute, dbc: `BO_ 256 Powertrain: 8 ECU`, want: map[uint32]time.Duration{}},
+		{name: "malformed assignment", attribute: defaultCycleTimeAttribute, dbc: `BA_ "GenMsgCycleTime" BO_ 256;`, wantErr: "malformed GenMsgCycleTime assignment"},
+		{name: "malformed ID", attribute: defaultCycleTimeAttribute, dbc: `BA_ "GenMsgCycleTime" BO_ abc 10;`, wantErr: "malformed message ID"},
+		{name: "negative value", attribute: defaultCycleTimeAttribute, dbc: `BA_ "GenMsgCycleTime" BO_ 256 -5;`, wantErr: "non-negative number of milliseconds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMessageCycleTimes(strings.NewReader(tt.dbc), tt.attribute)
+
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetMessageCycleTimesUsesExampleFallback(t *testing.T) {
+	directory := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "config.example.dbc"), []byte(`BA_ "GenMsgCycleTime" BO_ 1 20;`), 0o600))
+
+	got, err := getMessageCycleTimes(filepath.Join(directory, "config.dbc"), defaultCycleTimeAttribute)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[uint32]time.Duration{1: 20 * time.Millisecond}, got)
+
+	_, err = getMessageCycleTimes(filepath.Join(directory, "missing.dbc"), defaultCycleTimeAttribute)
+	require.ErrorContains(t, err, "error while opening DBC file")
+}
+
+func TestRunMessageSchedulerPublishesAtCycleTime(t *testing.T) {
+	messages := []SimulatedMessage{
+		{Name: "Fast", CycleTime: 5 * time.Millisecond, Signals: []SimulatedSignal{{Topic: "data/fast/a"}, {Topic: "data/fast/b"}}},
+		{Name: "Slow", CycleTime: 50 * time.Millisecond, Signals: []SimulatedSignal{{Topic: "data/slow/a"}}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 160*time.Millisecond)
+	defer cancel()
+
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	err := runMessageScheduler(ctx, messages, func(_ context.Context, message SimulatedMessage, timestamp time.Time) error {
+		assert.False(t, timestamp.IsZero())
+		mu.Lock()
+		defer mu.Unlock()
+		counts[message.Name]++
+		return nil
+	})
+
+	require.NoError(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Greater(t, counts["Fast"], 3*counts["Slow"])
+	assert.GreaterOrEqual(t, counts["Slow"], 1)
+}
+
+func TestRunMessageSchedulerStopsOnPublishError(t *testing.T) {
+	publishErr := errors.New("broker unavailable")
+	messages := []SimulatedMessage{
+		{Name: "Failing", CycleTime: time.Millisecond},
+		{Name: "Healthy", CycleTime: time.Millisecond},
+	}
+
+	err := runMessageScheduler(context.Background(), messages, func(_ context.Context, message SimulatedMessage, _ time.Time) error {
+		if message.Name == "Failing" {
+			return publishErr
+		}
+		return nil
+	})
+
+	require.ErrorIs(t, err, publishErr)
+	assert.Contains(t, err.Error(), `publish message "Failing"`)
+}
+
+func TestRunMessageSchedulerRejectsNonPositiveCycleTime(t *testing.T) {
+	err := runMessageScheduler(context.Background(), []SimulatedMessage{{Name: "EventDriven"}}, func(context.Context, SimulatedMessage, time.Time) error {
+		t.Fatal("publish must not be called")
+		return nil
+	})
+
+	require.EqualError(t, err, `cycle time for message "EventDriven" must be positive`)
+}
+
+// testRate is a schedulerRate the test changes directly.
+type testRate struct {
+	mu         sync.Mutex
+	multiplier float64
+	changed    chan struct{}
+}
+
+func newTestRate(multiplier float64) *testRate {
+	return &testRate{multiplier: multiplier, changed: make(chan struct{})}
+}
+
+func (r *testRate) RateMultiplier() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.multiplier
+}
+
+func (r *testRate) RateChanged() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.changed
+}
+
+func (r *testRate) set(multiplier float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.multiplier = multiplier
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func TestRunAdjustableSchedulerAppliesNewSpeed(t *testing.T) {
+	messages := []SimulatedMessage{{Name: "Powertrain", CycleTime: 20 * time.Millisecond}}
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	rate := newTestRate(1)
+
+	var (
+		mu    sync.Mutex
+		ticks int
+	)
+	err := runAdjustableScheduler(ctx, messages, rate, func(context.Context, SimulatedMessage, time.Time) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ticks++
+		if ticks == 1 {
+			rate.set(10)
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Greater(t, ticks, 10, "after the first tick the message publishes every 2ms")
+}
+
+func TestRunAdjustableSchedulerRestartsSlowedDownTicker(t *testing.T) {
+	messages := []SimulatedMessage{{Name: "Powertrain", CycleTime: 100 * time.Millisecond}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rate := newTestRate(minControlRateMultiplier)
+	published := make(chan time.Time, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runAdjustableScheduler(ctx, messages, rate, func(_ context.Context, _ SimulatedMessage, tick time.Time) error {
+			select {
+			case published <- tick:
+			default:
+			}
+			return nil
+		})
+	}()
+
+	// At 0.01x the message waits 10s; back at 1x it publishes within 100ms.
+	time.Sleep(20 * time.Millisecond)
+	rate.set(1)
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("the new rate waited for the slowed down tick")
+	}
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestScaledCycleTime(t *testing.T) {
+	assert.Equal(t, time.Second, scaledCycleTime(time.Second, nil))
+	assert.Equal(t, 250*time.Millisecond, scaledCycleTime(time.Second, func() float64 { return 4 }))
+	assert.Equal(t, 2*time.Second, scaledCycleTime(time.Second, func() float64 { return 0.5 }))
+	assert.Equal(t, time.Microsecond, scaledCycleTime(time.Millisecond, func() float64 { return 1e6 }))
+}
+
+func TestRunSimulatedSchedulerPublishesInTimeOrder(t *testing.T) {
+	messages := []SimulatedMessage{
+		{Name: "Slow", CycleTime: 100 * time.Millisecond},
+		{Name: "Fast", CycleTime: 50 * time.Millisecond},
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := newSimulatedClock(start)
+
+	var published []string
+	err := runSimulatedScheduler(context.Background(), messages, clock, 200*time.Millisecond, func(_ context.Context, message SimulatedMessage, timestamp time.Time) error {
+		assert.Equal(t, timestamp, clock.Now(), "the clock is at the tick being published")
+		published = append(published, fmt.Sprintf("%s@%s", message.Name, timestamp.Sub(start)))
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Fast@50ms", "Slow@100ms", "Fast@100ms", "Fast@150ms", "Slow@200ms", "Fast@200ms"}, published,
+		"messages due together publish in DBC order")
+}
+
+func TestRunSimulatedSchedulerStopsOnPublishError(t *testing.T) {
+	publishErr := errors.New("disk full")
+	messages := []SimulatedMessage{{Name: "Powertrain", CycleTime: time.Millisecond}}
+
+	err := runSimulatedScheduler(context.Background(), messages, newSimulatedClock(time.Now()), time.Second, func(context.Context, SimulatedMessage, time.Time) error {
+		return publishErr
+	})
+
+	require.ErrorIs(t, err, publishErr)
+	assert.Contains(t, err.Error(), `publish message "Powertrain"`)
+}
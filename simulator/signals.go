@@ -0,0 +1,216 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ApexCorse/ephoros/schema"
+	"github.com/ApexCorse/vera"
+)
+
+// SimulatedSignal is the part of a DBC signal definition needed to produce
+// values that a real ECU could have put on the bus for its MQTT topic.
+type SimulatedSignal struct {
+	Topic     string
+	Name      string
+	Message   string
+	MessageID uint32
+	Unit      string
+
+	Min    float64
+	Max    float64
+	Factor float64
+	Offset float64
+
+	StartBit  uint8
+	Length    uint8
+	BigEndian bool
+	Signed    bool
+}
+
+// getSignalsFromConfig extracts the published signals from the vera config,
+// in the same order as getTopicsFromConfig.
+func getSignalsFromConfig(config *vera.Config) []SimulatedSignal {
+	signals := make([]SimulatedSignal, 0)
+	for _, message := range config.Messages {
+		for _, signal := range message.Signals {
+			topic := strings.TrimSpace(signal.Metadata.MQTTTopic)
+			if topic == "" {
+				continue
+			}
+
+			signals = append(signals, SimulatedSignal{
+				Topic:     topic,
+				Name:      signal.Name,
+				Message:   message.Name,
+				MessageID: message.ID,
+				Unit:      signal.Unit,
+				Min:       widenFloat32(signal.Min),
+				Max:       widenFloat32(signal.Max),
+				Factor:    widenFloat32(signal.Factor),
+				Offset:    widenFloat32(signal.Offset),
+				StartBit:  signal.StartBit,
+				Length:    signal.Length,
+				BigEndian: signal.Endianness == vera.BigEndian,
+				Signed:    signal.Signed,
+			})
+		}
+	}
+
+	return signals
+}
+
+// widenFloat32 converts DBC values parsed as float32 through their shortest
+// decimal form, so a 0.1 factor stays 0.1 instead of 0.10000000149011612.
+func widenFloat32(value float32) float64 {
+	widened, err := strconv.ParseFloat(strconv.FormatFloat(float64(value), 'g', -1, 32), 64)
+	if err != nil {
+		return float64(value)
+	}
+	return widened
+}
+
+// influxTags returns the tags the signal's InfluxDB points carry. unit comes
+// from the payload and replaces the DBC unit when set.
+func (s SimulatedSignal) influxTags(unit string) schema.Tags {
+	if unit == "" {
+		unit = s.Unit
+	}
+	tags := schema.Tags{Topic: s.Topic, Name: s.Name, Unit: unit, Message: s.Message}
+	if s.Message != "" {
+		tags.MessageID = schema.FormatMessageID(s.MessageID)
+	}
+	return tags
+}
+
+// publishOptions labels a per-signal publish with MQTT v5 user properties,
+// so subscribers can read the unit and origin without the DBC.
+func (s SimulatedSignal) publishOptions() []PublishOption {
+	options := []PublishOption{WithUserProperty("signal", s.Name)}
+	if s.Unit != "" {
+		options = append(options, WithUserProperty("unit", s.Unit))
+	}
+	if s.Message != "" {
+		options = append(options,
+			WithUserProperty("message", s.Message),
+			WithUserProperty("can_id", schema.FormatMessageID(s.MessageID)),
+		)
+	}
+	return options
+}
+
+// rawRange returns the raw integer interval that both fits in the signal's
+// bit length and decodes inside its DBC [min|max] range. A [0|0] range is
+// the DBC convention for "unspecified", so only the bit length applies then.
+func (s SimulatedSignal) rawRange() (int64, int64) {
+	length := s.Length
+	if length == 0 || length > 63 {
+		length = 63
+	}
+
+	var rawMin, rawMax int64
+	if s.Signed {
+		rawMin = -(int64(1) << (length - 1))
+		rawMax = int64(1)<<(length-1) - 1
+	} else {
+		rawMin = 0
+		rawMax = int64(1)<<length - 1
+	}
+
+	factor := s.factor()
+	if s.Min == 0 && s.Max == 0 || s.Min > s.Max {
+		return rawMin, rawMax
+	}
+
+	low := (s.Min - s.Offset) / factor
+	high := (s.Max - s.Offset) / factor
+	if low > high {
+		low, high = high, low
+	}
+	// A small tolerance absorbs the float32 rounding of DBC ranges such as
+	// [0|65.535] with a 0.01 factor.
+	const epsilon = 1e-6
+	if bounded := int64(math.Ceil(low - epsilon)); bounded > rawMin {
+		rawMin = bounded
+	}
+	if bounded := int64(math.Floor(high + epsilon)); bounded < rawMax {
+		rawMax = bounded
+	}
+	if rawMin > rawMax {
+		return rawMax, rawMax
+	}
+
+	return rawMin, rawMax
+}
+
+func (s SimulatedSignal) factor() float64 {
+	if s.Factor == 0 {
+		return 1
+	}
+	return s.Factor
+}
+
+// physical converts a raw bus value to engineering units.
+func (s SimulatedSignal) physical(raw int64) float64 {
+	return float64(raw)*s.factor() + s.Offset
+}
+
+// quantize snaps an arbitrary physical value to the nearest value the signal
+// can actually encode.
+func (s SimulatedSignal) quantize(value float64) float64 {
+	rawMin, rawMax := s.rawRange()
+	raw := int64(math.Round((value - s.Offset) / s.factor()))
+	if raw < rawMin {
+		raw = rawMin
+	}
+	if raw > rawMax {
+		raw = rawMax
+	}
+	return s.physical(raw)
+}
+
+// newRand returns a generator seeded with seed that is safe for concurrent
+// use, unlike the ones rand.New returns.
+func newRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{source: rand.NewSource(seed).(rand.Source64)})
+}
+
+type lockedSource struct {
+	mu     sync.Mutex
+	source rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.source.Seed(seed)
+}
+
+// randomValue draws a uniformly distributed raw value from rng and scales it,
+// so the result always has the resolution and range a real ECU would produce.
+func (s SimulatedSignal) randomValue(rng *rand.Rand) float64 {
+	rawMin, rawMax := s.rawRange()
+	span := uint64(rawMax - rawMin)
+	var offset uint64
+	if span < math.MaxInt64 {
+		offset = uint64(rng.Int63n(int64(span) + 1))
+	} else {
+		offset = rng.Uint64() % (span + 1)
+	}
+	return s.physical(rawMin + int64(offset))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/ApexCorse/ephoros/schema"
+	"github.com/ApexCorse/vera"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSignalsFromConfig(t *testing.T) {
+	config := &vera.Config{Messages: []vera.Message{
+		{Name: "Powertrain", Signals: []vera.Signal{
+			{
+				Name: "EngineSpeed", Length: 16, Factor: 0.25, Min: 0, Max: 16000, Unit: "rpm",
+				Metadata: vera.SignalMetadata{MQTTTopic: " data/powertrain/engine/speed "},
+			},
+			{Name: "NoTopic", Length: 8, Factor: 1},
+		}},
+		{ID: 0x200, Name: "Battery", Signals: []vera.Signal{
+			{
+				Name: "BatteryCurrent", Length: 16, Signed: true, Factor: 0.1, Min: -3200, Max: 3200, Unit: "A",
+				Metadata: vera.SignalMetadata{MQTTTopic: "data/battery/current"},
+			},
+		}},
+	}}
+
+	assert.Equal(t, []SimulatedSignal{
+		{Topic: "data/powertrain/engine/speed", Name: "EngineSpeed", Message: "Powertrain", Unit: "rpm", Max: 16000, Factor: 0.25, Length: 16},
+		{Topic: "data/battery/current", Name: "BatteryCurrent", Message: "Battery", MessageID: 0x200, Unit: "A", Min: -3200, Max: 3200, Factor: 0.1, Length: 16, Signed: true},
+	}, getSignalsFromConfig(config))
+}
+
+func TestSimulatedSignalInfluxTags(t *testing.T) {
+	signal := SimulatedSignal{Topic: "data/battery/current", Name: "BatteryCurrent", Message: "Battery", MessageID: 0x200, Unit: "A"}
+
+	assert.Equal(t, schema.Tags{Topic: "data/battery/current", Name: "BatteryCurrent", Unit: "A", Message: "Battery", MessageID: "0x200"}, signal.influxTags(""))
+	assert.Equal(t, "mA", signal.influxTags("mA").Unit, "the payload unit wins")
+	assert.Equal(t, schema.Tags{Topic: "data/speed"}, SimulatedSignal{Topic: "data/speed"}.influxTags(""), "signals without a DBC message carry the topic only")
+}
+
+func TestSimulatedSignalRawRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		signal  SimulatedSignal
+		wantMin int64
+		wantMax int64
+	}{
+		{name: "range narrower than bit length", signal: SimulatedSignal{Length: 16, Factor: 0.25, Max: 16000}, wantMin: 0, wantMax: 64000},
+		{name: "bit length narrower than range", signal: SimulatedSignal{Length: 8, Factor: 1, Offset: -40, Min: -40, Max: 500}, wantMin: 0, wantMax: 255},
+		{name: "signed", signal: SimulatedSignal{Length: 16, Signed: true, Factor: 0.1, Min: -3276.8, Max: 3276.7}, wantMin: -32768, wantMax: 32767},
+		{name: "float32 rounded range", signal: SimulatedSignal{Length: 16, Factor: float64(float32(0.01)), Max: float64(float32(65.535))}, wantMin: 0, wantMax: 6553},
+		{name: "unspecified range", signal: SimulatedSignal{Length: 4, Factor: 1}, wantMin: 0, wantMax: 15},
+		{name: "negative factor", signal: SimulatedSignal{Length: 8, Factor: -0.5, Min: -10, Max: 0}, wantMin: 0, wantMax: 20},
+		{name: "zero factor treated as one", signal: SimulatedSignal{Length: 8, Min: 10, Max: 20}, wantMin: 10, wantMax: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotMin, gotMax := tt.signal.rawRange()
+			assert.Equal(t, tt.wantMin, gotMin)
+			assert.Equal(t, tt.wantMax, gotMax)
+		})
+	}
+}
+
+func TestSimulatedSignalQuantize(t *testing.T) {
+	signal := SimulatedSignal{Length: 8, Factor: 1, Offset: -40, Min: -40, Max: 215}
+
+	assert.Equal(t, 90.0, signal.quantize(90.4))
+	assert.Equal(t, -40.0, signal.quantize(-100))
+	assert.Equal(t, 215.0, signal.quantize(1000))
+}
+
+func TestSimulatedSignalRandomValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		signal SimulatedSignal
+	}{
+		{name: "engine speed", signal: SimulatedSignal{Topic: "data/powertrain/engine/speed", Length: 16, Factor: 0.25, Max: 16000, Unit: "rpm"}},
+		{name: "coolant temperature", signal: SimulatedSignal{Topic: "data/powertrain/engine/coolant", Length: 8, Factor: 1, Offset: -40, Min: -40, Max: 215, Unit: "degC"}},
+		{name: "battery current", signal: SimulatedSignal{Topic: "data/battery/current", Length: 16, Signed: true, Factor: 0.1, Min: -3200, Max: 3200, Unit: "A"}},
+	}
+
+	rng := newRand(1)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				value := tt.signal.randomValue(rng)
+
+				assert.GreaterOrEqual(t, value, tt.signal.Min)
+				assert.LessOrEqual(t, value, tt.signal.Max)
+				steps := (value - tt.signal.Offset) / tt.signal.Factor
+				assert.InDelta(t, math.Round(steps), steps, 1e-6, "value %v is not a multiple of the factor", value)
+			}
+		})
+	}
+}
+
+func TestNewRandIsSeeded(t *testing.T) {
+	signal := SimulatedSignal{Length: 16, Factor: 0.25, Max: 16000}
+	draw := func(rng *rand.Rand) []float64 {
+		values := make([]float64, 20)
+		for i := range values {
+			values[i] = signal.randomValue(rng)
+		}
+		return values
+	}
+
+	assert.Equal(t, draw(newRand(42)), draw(newRand(42)))
+	assert.NotEqual(t, draw(newRand(42)), draw(newRand(43)))
+}
+
+func TestSimulatedSignalPublishOptions(t *testing.T) {
+	signal := SimulatedSignal{Name: "EngineSpeed", Unit: "rpm", Message: "Powertrain", MessageID: 0x80000123}
+
+	got := resolvePublishOptions(PublishOptions{}, signal.publishOptions())
+
+	assert.Equal(t, paho.UserProperties{
+		{Key: "signal", Value: "EngineSpeed"},
+		{Key: "unit", Value: "rpm"},
+		{Key: "message", Value: "Powertrain"},
+		{Key: "can_id", Value: "0x123"},
+	}, got.UserProperties)
+
+	got = resolvePublishOptions(PublishOptions{}, SimulatedSignal{Name: "Gear"}.publishOptions())
+	assert.Equal(t, paho.UserProperties{{Key: "signal", Value: "Gear"}}, got.UserProperties)
+}
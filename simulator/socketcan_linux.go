@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// socketCANSource reads frames from a raw SocketCAN socket.
+type socketCANSource struct {
+	file   *os.File
+	buffer [canFDMTU]byte
+}
+
+// openSocketCAN binds a raw socket to the interface called name, receiving
+// CAN FD frames too where the interface supports them.
+func openSocketCAN(name string) (CANSource, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("find CAN interface %s: %w", name, err)
+	}
+
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_RAW, unix.CAN_RAW)
+	if err != nil {
+		return nil, fmt.Errorf("open SocketCAN socket: %w", err)
+	}
+	// Classic CAN interfaces refuse the option and keep working.
+	_ = unix.SetsockoptInt(fd, unix.SOL_CAN_RAW, unix.CAN_RAW_FD_FRAMES, 1)
+	if err := unix.Bind(fd, &unix.SockaddrCAN{Ifindex: iface.Index}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("bind to %s: %w", name, err)
+	}
+	// A non-blocking descriptor goes through the runtime poller, so Close
+	// unblocks a pending read.
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("configure SocketCAN socket: %w", err)
+	}
+
+	return &socketCANSource{file: os.NewFile(uintptr(fd), name)}, nil
+}
+
+func (s *socketCANSource) ReadFrame() (CANFrame, error) {
+	for {
+		n, err := s.file.Read(s.buffer[:])
+		if err != nil {
+			return CANFrame{}, fmt.Errorf("read SocketCAN frame: %w", err)
+		}
+		frame, ok, err := parseSocketCANFrame(s.buffer[:n], time.Now())
+		if err != nil {
+			return CANFrame{}, err
+		}
+		if ok {
+			return frame, nil
+		}
+	}
+}
+
+func (s *socketCANSource) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// TestSocketCANSource needs a vcan0 interface:
+//
+//	sudo ip link add dev vcan0 type vcan && sudo ip link set up vcan0
+func TestSocketCANSource(t *testing.T) {
+	iface, err := net.InterfaceByName("vcan0")
+	if err != nil {
+		t.Skip("vcan0 is not available")
+	}
+
+	source, err := OpenCANSource("socketcan:vcan0")
+	require.NoError(t, err)
+	defer source.Close()
+
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_RAW, unix.CAN_RAW)
+	require.NoError(t, err)
+	defer unix.Close(fd)
+	require.NoError(t, unix.Bind(fd, &unix.SockaddrCAN{Ifindex: iface.Index}))
+	frame := make([]byte, canMTU)
+	binary.NativeEndian.PutUint32(frame, 0x100)
+	frame[4], frame[8], frame[9] = 2, 0x10, 0x27
+	_, err = unix.Write(fd, frame)
+	require.NoError(t, err)
+
+	received, err := source.ReadFrame()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0x100), received.ID)
+	assert.Equal(t, []byte{0x10, 0x27}, received.Data)
+	assert.WithinDuration(t, time.Now(), received.Time, time.Second)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func openSocketCAN(string) (CANSource, error) {
+	return nil, errors.New("SocketCAN is only available on Linux; use a tcp://, udp:// or stdin source")
+}
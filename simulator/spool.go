@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultSpoolMaxBytes = 256 << 20
+	// spoolSegmentBytes is the size at which the spool starts a new segment
+	// file, so a long outage produces a handful of files rather than one per
+	// write.
+	spoolSegmentBytes = 1 << 20
+)
+
+type spoolSegment struct {
+	sequence uint64
+	size     int64
+}
+
+// Spool keeps writes that could not be delivered in numbered segment files
+// under one directory. Segments are replayed oldest first and survive a
+// restart; once the spool exceeds maxBytes the oldest segments are dropped.
+type Spool struct {
+	dir       string
+	extension string
+	maxBytes  int64
+
+	// drainMu lets one Drain run at a time.
+	drainMu sync.Mutex
+
+	mu       sync.Mutex
+	segments []spoolSegment
+	size     int64
+	// open is the segment still being appended to, if any.
+	open bool
+}
+
+// OpenSpool creates dir if needed and picks up the segments a previous run
+// left behind.
+func OpenSpool(dir string, extension string, maxBytes int64) (*Spool, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultSpoolMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spool directory: %w", err)
+	}
+
+	s := &Spool{dir: dir, extension: extension, maxBytes: maxBytes}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, extension) {
+			continue
+		}
+		sequence, err := strconv.ParseUint(strings.TrimSuffix(name, extension), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("stat spool segment %s: %w", name, err)
+		}
+		s.segments = append(s.segments, spoolSegment{sequence: sequence, size: info.Size()})
+		s.size += info.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].sequence < s.segments[j].sequence })
+
+	return s, nil
+}
+
+// Append stores data at the end of the spool. It is written in one piece, so
+// a segment never holds a partial record.
+func (s *Spool) Append(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if int64(len(data)) > s.maxBytes {
+		return fmt.Errorf("%d bytes exceed the spool limit of %d bytes", len(data), s.maxBytes)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.open || s.segments[len(s.segments)-1].size+int64(len(data)) > spoolSegmentBytes {
+		var sequence uint64 = 1
+		if len(s.segments) > 0 {
+			sequence = s.segments[len(s.segments)-1].sequence + 1
+		}
+		s.segments = append(s.segments, spoolSegment{sequence: sequence})
+		s.open = true
+	}
+
+	for s.size+int64(len(data)) > s.maxBytes && len(s.segments) > 1 {
+		dropped := s.segments[0]
+		if err := os.Remove(s.path(dropped.sequence)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("drop spool segment: %w", err)
+		}
+		log.Printf("[SIMULATOR_SPOOL] spool in %s is full, dropped %d bytes of the oldest data\n", s.dir, dropped.size)
+		s.segments = s.segments[1:]
+		s.size -= dropped.size
+	}
+
+	tail := &s.segments[len(s.segments)-1]
+	file, err := os.OpenFile(s.path(tail.sequence), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open spool segment: %w", err)
+	}
+	written, err := file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	tail.size += int64(written)
+	s.size += int64(written)
+	if err != nil {
+		return fmt.Errorf("write spool segment: %w", err)
+	}
+
+	return nil
+}
+
+// Drain hands every segment to send, oldest first, and removes it once send
+// succeeds. It stops at the first failure and leaves that segment in place.
+// The spool is only locked between segments, so writers can keep appending
+// while a segment is being sent.
+func (s *Spool) Drain(ctx context.Context, send func(context.Context, []byte) error) error {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		if len(s.segments) == 0 {
+			s.open = false
+			s.mu.Unlock()
+			return nil
+		}
+		segment := s.segments[0]
+		// Appends go to a new segment while this one is sent, so none are
+		// removed with it.
+		wasOpen := s.open && len(s.segments) == 1
+		if wasOpen {
+			s.open = false
+		}
+		s.mu.Unlock()
+
+		path := s.path(segment.sequence)
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.reopen(segment, wasOpen)
+			return fmt.Errorf("read spool segment: %w", err)
+		}
+		if len(data) > 0 {
+			if err := send(ctx, data); err != nil {
+				s.reopen(segment, wasOpen)
+				return err
+			}
+		}
+
+		s.mu.Lock()
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.mu.Unlock()
+			return fmt.Errorf("remove spool segment: %w", err)
+		}
+		// Append may have dropped the segment already to stay within maxBytes.
+		if len(s.segments) > 0 && s.segments[0].sequence == segment.sequence {
+			s.size -= s.segments[0].size
+			s.segments = s.segments[1:]
+		}
+		s.mu.Unlock()
+	}
+}
+
+// reopen lets appends continue into a segment that failed to drain, as long
+// as nothing started a newer one meanwhile.
+func (s *Spool) reopen(segment spoolSegment, wasOpen bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if wasOpen && len(s.segments) == 1 && s.segments[0].sequence == segment.sequence {
+		s.open = true
+	}
+}
+
+// Len returns the number of segments waiting to be replayed.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments)
+}
+
+// Size returns the number of bytes waiting to be replayed.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+func (s *Spool) path(sequence uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%012d%s", sequence, s.extension))
+}
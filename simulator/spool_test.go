@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drainAll(t *testing.T, spool *Spool) []string {
+	t.Helper()
+	var segments []string
+	require.NoError(t, spool.Drain(context.Background(), func(_ context.Context, data []byte) error {
+		segments = append(segments, string(data))
+		return nil
+	}))
+	return segments
+}
+
+func TestSpoolAppendAndDrain(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), ".lp", 0)
+	require.NoError(t, err)
+
+	require.NoError(t, spool.Append([]byte("a 1\n")))
+	require.NoError(t, spool.Append([]byte("b 2\n")))
+	assert.Equal(t, 1, spool.Len(), "small writes share a segment")
+	assert.Equal(t, int64(8), spool.Size())
+
+	assert.Equal(t, []string{"a 1\nb 2\n"}, drainAll(t, spool))
+	assert.Equal(t, 0, spool.Len())
+	assert.Equal(t, int64(0), spool.Size())
+}
+
+func TestSpoolKeepsAppendingAfterFailedDrain(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), ".lp", 0)
+	require.NoError(t, err)
+	failure := errors.New("still down")
+
+	require.NoError(t, spool.Append([]byte("first\n")))
+	require.ErrorIs(t, spool.Drain(context.Background(), func(context.Context, []byte) error { return failure }), failure)
+	require.NoError(t, spool.Append([]byte("second\n")))
+
+	assert.Equal(t, []string{"first\nsecond\n"}, drainAll(t, spool))
+}
+
+func TestSpoolSurvivesReopen(t *testing.T) {
+	directory := t.TempDir()
+	spool, err := OpenSpool(directory, ".lp", 0)
+	require.NoError(t, err)
+	require.NoError(t, spool.Append([]byte("before restart\n")))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "notes.txt"), []byte("ignored"), 0o600))
+
+	reopened, err := OpenSpool(directory, ".lp", 0)
+	require.NoError(t, err)
+	require.NoError(t, reopened.Append([]byte("after restart\n")))
+
+	assert.Equal(t, 2, reopened.Len())
+	assert.Equal(t, []string{"before restart\n", "after restart\n"}, drainAll(t, reopened))
+}
+
+func TestSpoolDropsOldestSegmentsWhenFull(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), ".lp", 2*spoolSegmentBytes)
+	require.NoError(t, err)
+	chunk := []byte(strings.Repeat("x", spoolSegmentBytes/2))
+
+	for range 5 {
+		require.NoError(t, spool.Append(chunk))
+	}
+
+	assert.LessOrEqual(t, spool.Size(), int64(2*spoolSegmentBytes))
+	assert.Equal(t, 2, spool.Len())
+	require.ErrorContains(t, spool.Append(make([]byte, 2*spoolSegmentBytes+1)), "exceed the spool limit")
+}
+
+func TestSpoolAppendsWhileDraining(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), ".lp", 0)
+	require.NoError(t, err)
+	require.NoError(t, spool.Append([]byte("first\n")))
+
+	var sent []string
+	require.NoError(t, spool.Drain(context.Background(), func(_ context.Context, data []byte) error {
+		if len(sent) == 0 {
+			require.NoError(t, spool.Append([]byte("during\n")))
+		}
+		sent = append(sent, string(data))
+		return nil
+	}))
+
+	assert.Equal(t, []string{"first\n", "during\n"}, sent, "appends during a drain are kept in a new segment")
+	assert.Equal(t, 0, spool.Len())
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSOptions configures the TLS client side of a connection. The zero value
+// leaves TLS to the URL scheme and the system roots.
+type TLSOptions struct {
+	// CAFile is a PEM bundle trusted instead of the system roots.
+	CAFile string
+	// CertFile and KeyFile hold the PEM client certificate for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the host name the server certificate must match.
+	ServerName string
+	// InsecureSkipVerify accepts any server certificate. Lab use only.
+	InsecureSkipVerify bool
+}
+
+// registerTLSFlags adds --<name>-ca-file, --<name>-cert-file,
+// --<name>-key-file, --<name>-server-name and --<name>-insecure-skip-verify,
+// defaulting to the <ENV>_CA_FILE, <ENV>_CERT_FILE, ... environment variables.
+func registerTLSFlags(flags *flag.FlagSet, name string, env string) *TLSOptions {
+	options := &TLSOptions{}
+	flags.StringVar(&options.CAFile, name+"-ca-file", os.Getenv(env+"_CA_FILE"), "PEM CA bundle used to verify the "+name+" server")
+	flags.StringVar(&options.CertFile, name+"-cert-file", os.Getenv(env+"_CERT_FILE"), "PEM client certificate presented to the "+name+" server")
+	flags.StringVar(&options.KeyFile, name+"-key-file", os.Getenv(env+"_KEY_FILE"), "PEM private key of the "+name+" client certificate")
+	flags.StringVar(&options.ServerName, name+"-server-name", os.Getenv(env+"_SERVER_NAME"), "host name the "+name+" server certificate must match")
+	flags.BoolVar(&options.InsecureSkipVerify, name+"-insecure-skip-verify", os.Getenv(env+"_INSECURE_SKIP_VERIFY") == "true", "accept any "+name+" server certificate (lab use only)")
+	return options
+}
+
+func (o TLSOptions) configured() bool {
+	return o != TLSOptions{}
+}
+
+// Config builds the client TLS configuration, or returns nil when no option
+// is set.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	if !o.configured() {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+
+	if o.CAFile != "" {
+		bundle, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("CA file %s contains no PEM certificates", o.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return nil, errors.New("client certificate and key files must be set together")
+	}
+	if o.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// readSecretFile returns the trimmed contents of a file holding a password
+// or token, such as a mounted Docker or Kubernetes secret.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPKI is a throwaway CA with a server certificate for 127.0.0.1 and
+// "broker.test", and a client certificate, all written as PEM files.
+type testPKI struct {
+	CAFile, ServerCertFile, ServerKeyFile, ClientCertFile, ClientKeyFile string
+
+	pool   *x509.CertPool
+	server tls.Certificate
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	directory := t.TempDir()
+	pki := &testPKI{pool: x509.NewCertPool()}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ephoros test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	pki.pool.AddCert(ca)
+	pki.CAFile = writePEM(t, directory, "ca.pem", "CERTIFICATE", caDER)
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage, hosts ...string) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		for _, host := range hosts {
+			if ip := net.ParseIP(host); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else {
+				template.DNSNames = append(template.DNSNames, host)
+			}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		return writePEM(t, directory, name+".pem", "CERTIFICATE", der), writePEM(t, directory, name+"-key.pem", "EC PRIVATE KEY", keyDER)
+	}
+	pki.ServerCertFile, pki.ServerKeyFile = issue("server", 2, x509.ExtKeyUsageServerAuth, "127.0.0.1", "broker.test")
+	pki.ClientCertFile, pki.ClientKeyFile = issue("client", 3, x509.ExtKeyUsageClientAuth)
+
+	pki.server, err = tls.LoadX509KeyPair(pki.ServerCertFile, pki.ServerKeyFile)
+	require.NoError(t, err)
+	return pki
+}
+
+// serverConfig requires clients to present a certificate signed by the CA.
+func (p *testPKI) serverConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{p.server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    p.pool,
+	}
+}
+
+func writePEM(t *testing.T, directory string, name string, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(directory, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func TestTLSOptionsConfig(t *testing.T) {
+	pki := newTestPKI(t)
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+	tests := []struct {
+		name    string
+		options TLSOptions
+		check   func(*testing.T, *tls.Config)
+		wantErr string
+	}{
+		{
+			name:  "unset",
+			check: func(t *testing.T, config *tls.Config) { assert.Nil(t, config) },
+		},
+		{
+			name:    "mutual TLS",
+			options: TLSOptions{CAFile: pki.CAFile, CertFile: pki.ClientCertFile, KeyFile: pki.ClientKeyFile, ServerName: "broker.test"},
+			check: func(t *testing.T, config *tls.Config) {
+				require.NotNil(t, config)
+				assert.NotNil(t, config.RootCAs)
+				assert.Len(t, config.Certificates, 1)
+				assert.Equal(t, "broker.test", config.ServerName)
+				assert.False(t, config.InsecureSkipVerify)
+			},
+		},
+		{
+			name:    "insecure skip verify",
+			options: TLSOptions{InsecureSkipVerify: true},
+			check: func(t *testing.T, config *tls.Config) {
+				require.NotNil(t, config)
+				assert.True(t, config.InsecureSkipVerify)
+				assert.Nil(t, config.RootCAs, "the system roots are kept")
+			},
+		},
+		{name: "missing CA file", options: TLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}, wantErr: "read CA file"},
+		{name: "CA file without certificates", options: TLSOptions{CAFile: notPEM}, wantErr: "contains no PEM certificates"},
+		{name: "certificate without key", options: TLSOptions{CertFile: pki.ClientCertFile}, wantErr: "client certificate and key files must be set together"},
+		{name: "mismatched key", options: TLSOptions{CertFile: pki.ClientCertFile, KeyFile: pki.ServerKeyFile}, wantErr: "load client certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := tt.options.Config()
+
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, config)
+		})
+	}
+}
+
+func TestRegisterTLSFlags(t *testing.T) {
+	t.Setenv("MQTT_CA_FILE", "/etc/ephoros/ca.pem")
+	t.Setenv("MQTT_SERVER_NAME", "emqx.trackside")
+	t.Setenv("MQTT_INSECURE_SKIP_VERIFY", "true")
+	flags := flag.NewFlagSet("simulator", flag.ContinueOnError)
+
+	options := registerTLSFlags(flags, "mqtt", "MQTT")
+	require.NoError(t, flags.Parse([]string{"--mqtt-cert-file", "client.pem", "--mqtt-key-file", "client-key.pem", "--mqtt-insecure-skip-verify=false"}))
+
+	assert.Equal(t, TLSOptions{
+		CAFile:     "/etc/ephoros/ca.pem",
+		CertFile:   "client.pem",
+		KeyFile:    "client-key.pem",
+		ServerName: "emqx.trackside",
+	}, *options)
+}
+
+func TestReadSecretFile(t *testing.T) {
+	directory := t.TempDir()
+	secret := filepath.Join(directory, "token")
+	require.NoError(t, os.WriteFile(secret, []byte("s3cret\n"), 0o600))
+	empty := filepath.Join(directory, "empty")
+	require.NoError(t, os.WriteFile(empty, []byte("\n"), 0o600))
+
+	got, err := readSecretFile(secret)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", got)
+
+	_, err = readSecretFile(empty)
+	assert.ErrorContains(t, err, "is empty")
+
+	_, err = readSecretFile(filepath.Join(directory, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}